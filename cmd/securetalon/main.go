@@ -6,15 +6,18 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"securetalon/internal/agent"
 	"securetalon/internal/api"
+	"securetalon/internal/approval"
 	"securetalon/internal/audit"
 	"securetalon/internal/auth"
 	"securetalon/internal/broker"
 	"securetalon/internal/config"
 	"securetalon/internal/core"
 	"securetalon/internal/policy"
+	"securetalon/internal/workspace"
 )
 
 func main() {
@@ -22,29 +25,98 @@ func main() {
 	if cfg.AdminToken == "" {
 		log.Fatal("ADMIN_TOKEN is required (env or config)")
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("config: %v", err)
+	}
 	if err := cfg.EnsureDataDirs(); err != nil {
 		log.Fatalf("data dirs: %v", err)
 	}
 
-	store := core.NewStore()
+	storeBackend, err := core.NewFileBackend(cfg.StoreDir())
+	if err != nil {
+		log.Fatalf("store backend: %v", err)
+	}
+	store, err := core.OpenStore(storeBackend)
+	if err != nil {
+		log.Fatalf("store: %v", err)
+	}
 	auditStore, err := audit.NewStore(cfg.AuditDir())
 	if err != nil {
 		log.Fatalf("audit store: %v", err)
 	}
-	tokenSecret := cfg.TokenSecret
-	if tokenSecret == "" {
-		tokenSecret = cfg.AdminToken
+	approvalStore, err := approval.NewStore(cfg.ApprovalsDir())
+	if err != nil {
+		log.Fatalf("approval store: %v", err)
+	}
+	keyring, err := policy.NewKeyring(cfg.KeysDir())
+	if err != nil {
+		log.Fatalf("token keyring: %v", err)
 	}
-	issuer := policy.NewIssuer(tokenSecret)
-	verifier := policy.NewVerifier(tokenSecret)
+	go keyring.RunRotation(cfg.KeyRotationInterval, cfg.KeyRetention, time.Minute, nil, log.Printf)
+	issuer := policy.NewKeyringIssuer(keyring)
+	// The broker only gets the keyring's public keys, so it can verify but not mint tokens.
+	verifier := policy.NewKeyringVerifier(keyring.Public())
+	verifier.Leeway = cfg.TokenLeeway
 	policyEngine := policy.NewEngine(issuer)
+	// No token may outlive the retention of the key that signed it.
+	policyEngine.MaxTTL = cfg.MaxTokenTTL()
+	revisions, err := policy.NewRevisionStore(cfg.PolicyDir())
+	if err != nil {
+		log.Fatalf("policy revisions: %v", err)
+	}
+	packs, err := policy.NewPackStore(cfg.PolicyDir())
+	if err != nil {
+		log.Fatalf("policy packs: %v", err)
+	}
+	counters, err := policy.NewCounterStore(cfg.PolicyDir())
+	if err != nil {
+		log.Fatalf("policy counters: %v", err)
+	}
+	// Runs that finished (or were failed on load) while the server was down keep no per-run quotas.
+	for _, c := range counters.List("") {
+		if run := store.GetRun(c.RunID); c.RunID != "" && (run == nil || run.EndedAt != nil) {
+			if err := counters.DropRun(c.RunID); err != nil {
+				log.Fatalf("policy counters: %v", err)
+			}
+		}
+	}
+	capabilities, err := policy.NewCapabilityStore(cfg.PolicyDir())
+	if err != nil {
+		log.Fatalf("capability store: %v", err)
+	}
+	policyEngine.Revisions = revisions
+	policyEngine.Counters = counters
+	policyEngine.Packs = packs
+	policyEngine.Capabilities = capabilities
+	policyEngine.Sessions = store
+	workspaces, err := workspace.NewManager(cfg.WorkspacesDir())
+	if err != nil {
+		log.Fatalf("workspaces: %v", err)
+	}
+	policyEngine.Workspaces = workspaces
+	policyEngine.RestoreSessionPolicies()
+	globalPolicy, err := policy.LoadGlobalPolicy(cfg.GlobalPolicyFile)
+	if err != nil {
+		log.Fatalf("global policy: %v", err)
+	}
+	policyEngine.SetGlobalPolicy(globalPolicy)
+	go policyEngine.WatchGlobalPolicyFile(cfg.GlobalPolicyFile, 5*time.Second, nil, log.Printf)
 	brokerSvc := broker.NewBroker(verifier)
+	brokerSvc.Revocations = capabilities
+	brokerSvc.Delegations = capabilities
+	brokerSvc.AuditStore = auditStore
+	brokerSvc.Filters = []broker.OutputFilter{&broker.Redactor{Rules: policyEngine.RedactionRules}}
 	agentLoop := agent.NewAgent(store, policyEngine, brokerSvc, auditStore)
+	agentLoop.Approvals = approvalStore
 	handlers := &api.Handlers{
 		Store:      store,
 		Policy:     policyEngine,
 		AuditStore: auditStore,
 		Agent:      agentLoop,
+		Approvals:  approvalStore,
+		Keys:       keyring,
+		Workspaces: workspaces,
+		Broker:     brokerSvc,
 	}
 	router := api.NewRouter(handlers)
 	authed := auth.Middleware(cfg.AdminToken)(router)
@@ -2,14 +2,18 @@
 //   - ToolIntent parsing (from POST body intents or last message content as JSON array)
 //   - Policy Engine evaluation and capability token issuance
 //   - Tool Broker execution for allowed intents
-//   - Audit events: policy.intent.received, policy.decision, capability.issued, tool.executed, run.finished
+//   - Pausing on REQUIRE_APPROVAL and resuming once a human approves or rejects the intent
+//   - Audit events: policy.intent.received, policy.decision, capability.issued, tool.executed,
+//     approval.requested, run.resumed, run.finished (the broker audits capability.replay_blocked)
 package agent
 
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"time"
 
+	"securetalon/internal/approval"
 	"securetalon/internal/audit"
 	"securetalon/internal/broker"
 	"securetalon/internal/core"
@@ -22,6 +26,8 @@ type Agent struct {
 	Policy     *policy.Engine
 	Broker     *broker.Broker
 	AuditStore *audit.Store
+	// Approvals queues REQUIRE_APPROVAL intents. When nil, such intents are treated as denied.
+	Approvals *approval.Store
 }
 
 // NewAgent returns an agent with the given dependencies.
@@ -35,7 +41,8 @@ func NewAgent(store *core.Store, policyEngine *policy.Engine, b *broker.Broker,
 }
 
 // Run processes the run: resolve intents (from list or parse last message), then for each intent
-// evaluate policy, optionally execute via broker, append steps and audit events. Marks run completed/failed.
+// evaluate policy, optionally execute via broker, append steps and audit events. Marks run completed/failed,
+// or awaiting_approval if an intent requires approval (see Resume).
 // On panic, run is marked failed and run.finished is still emitted.
 func (a *Agent) Run(sessionID, runID string, intents []core.ToolIntent) {
 	run := a.Store.GetRun(runID)
@@ -47,49 +54,137 @@ func (a *Agent) Run(sessionID, runID string, intents []core.ToolIntent) {
 		return
 	}
 
-	a.Store.UpdateRunStatus(runID, "running", nil, nil)
-	var finalStatus = "completed"
-	var stepCount int
+	if err := a.Store.UpdateRunStatus(runID, "running", nil, nil); err != nil {
+		log.Printf("run %s: persist status: %v", runID, err)
+		a.finishRun(runID, sessionID, "failed", 0)
+		return
+	}
+	if len(intents) == 0 {
+		intents = a.parseIntentsFromLastMessage(sessionID)
+	}
+	a.process(sessionID, runID, intents, 0, "completed", 0, nil)
+}
+
+// Resume continues a run paused on an approval once it has been decided. An approved intent is
+// re-evaluated with EvaluateApproved and executed; a rejected one is recorded as denied and fails the run.
+// Remaining intents are then processed as in Run.
+func (a *Agent) Resume(ap *core.Approval) {
+	if ap == nil || ap.Status == approval.StatusPending {
+		return
+	}
+	run := a.Store.GetRun(ap.RunID)
+	if run == nil || run.Status != "awaiting_approval" {
+		return
+	}
+	if a.Policy == nil || a.Broker == nil {
+		a.finishRun(ap.RunID, ap.SessionID, "failed", len(run.Steps))
+		return
+	}
+	if err := a.Store.UpdateRunStatus(ap.RunID, "running", nil, nil); err != nil {
+		log.Printf("run %s: persist status: %v", ap.RunID, err)
+		a.finishRun(ap.RunID, ap.SessionID, "failed", len(run.Steps))
+		return
+	}
+	a.emitAudit(ap.RunID, ap.SessionID, "run.resumed", map[string]interface{}{
+		"approval_id": ap.ID, "status": ap.Status, "step_id": ap.StepID,
+	})
+	status := "completed"
+	for _, st := range run.Steps {
+		if st.Status == "denied" || st.Status == "error" {
+			status = "failed"
+		}
+	}
+	a.process(ap.SessionID, ap.RunID, ap.Intents, ap.Index, status, len(run.Steps), ap)
+}
+
+// process evaluates intents[start:]. decided, when set, is the approval decision for intents[start].
+// The run is finished unless it pauses on a new approval.
+func (a *Agent) process(sessionID, runID string, intents []core.ToolIntent, start int, status string, stepCount int, decided *core.Approval) {
+	var finalStatus = status
+	var paused bool
 
 	defer func() {
 		if r := recover(); r != nil {
 			finalStatus = "failed"
+			paused = false
+		}
+		if !paused {
+			a.finishRun(runID, sessionID, finalStatus, stepCount)
 		}
-		a.finishRun(runID, sessionID, finalStatus, stepCount)
 	}()
 
-	if len(intents) == 0 {
-		intents = a.parseIntentsFromLastMessage(sessionID)
+	// A step that cannot be persisted stops the run, so no tool executes unrecorded.
+	record := func(step core.Step) bool {
+		if err := a.Store.AppendRunStep(runID, step); err != nil {
+			log.Printf("run %s: persist step %s: %v", runID, step.StepID, err)
+			finalStatus = "failed"
+			return false
+		}
+		return true
 	}
 
-	for i, intent := range intents {
+	for i := start; i < len(intents); i++ {
+		// Relative file paths name workspace files; the broker gets the resolved intent the token is bound to.
+		intent := a.Policy.ResolveIntent(intents[i], sessionID)
 		stepID := core.NewStepID(i + 1)
-		a.emitAudit(runID, sessionID, "policy.intent.received", map[string]interface{}{
-			"tool": intent.Tool, "step_id": stepID,
-		})
 
-		result := a.Policy.Evaluate(intent, sessionID)
+		var result core.PolicyResult
+		if decided != nil && i == start {
+			if decided.Status != approval.StatusApproved {
+				if !record(core.Step{
+					StepID:  stepID,
+					Type:    "policy_eval",
+					Status:  "denied",
+					Tool:    intent.Tool,
+					Details: map[string]interface{}{"reason": "approval rejected", "approval_id": decided.ID},
+				}) {
+					return
+				}
+				stepCount++
+				finalStatus = "failed"
+				continue
+			}
+			result = a.Policy.EvaluateForRun(intent, sessionID, runID, true)
+			decision := decisionData(intent, result, stepID)
+			decision["approval_id"] = decided.ID
+			a.emitAudit(runID, sessionID, "policy.decision", decision)
+		} else {
+			// The audit log is append-only: record file contents by digest and redact secrets.
+			params := a.redactParams(intent.Tool, policy.SummarizeParams(intent.Params))
+			received := map[string]interface{}{
+				"tool": intent.Tool, "step_id": stepID, "params": params,
+			}
+			if intent.Subject != "" {
+				received["subject"] = intent.Subject
+			}
+			a.emitAudit(runID, sessionID, "policy.intent.received", received)
 
-		a.emitAudit(runID, sessionID, "policy.decision", map[string]interface{}{
-			"decision": string(result.Decision),
-			"tool":     intent.Tool,
-			"reason":   result.Reason,
-			"step_id":  stepID,
-		})
+			result = a.Policy.EvaluateForRun(intent, sessionID, runID, false)
+
+			a.emitAudit(runID, sessionID, "policy.decision", decisionData(intent, result, stepID))
+		}
 
 		if result.Decision == core.DecisionAllow && result.Token != nil {
-			a.Store.AppendRunStep(runID, core.Step{
+			if !record(core.Step{
 				StepID:  stepID,
 				Type:    "policy_eval",
 				Status:  "allow",
 				Tool:    intent.Tool,
 				Details: map[string]interface{}{"reason": result.Reason},
-			})
+			}) {
+				return
+			}
 			stepCount++
-			a.emitAudit(runID, sessionID, "capability.issued", map[string]interface{}{
-				"token_hash": result.Token.Signature,
-				"tool":       intent.Tool,
-			})
+			issued := map[string]interface{}{
+				"token_hash":  result.Token.Signature,
+				"tool":        intent.Tool,
+				"ttl_seconds": result.Token.Exp - result.Token.Iat,
+				"exp":         result.Token.Exp,
+			}
+			if result.Token.Kid != "" {
+				issued["kid"] = result.Token.Kid
+			}
+			a.emitAudit(runID, sessionID, "capability.issued", issued)
 
 			out, err := a.Broker.Execute(intent, result.Token)
 			step := core.Step{
@@ -107,33 +202,149 @@ func (a *Agent) Run(sessionID, runID string, intents []core.ToolIntent) {
 				step.Details["error"] = err.Error()
 				finalStatus = "failed"
 			}
-			a.Store.AppendRunStep(runID, step)
+			if !record(step) {
+				return
+			}
 			stepCount++
-			a.emitAudit(runID, sessionID, "tool.executed", map[string]interface{}{
-				"tool": intent.Tool, "step_id": stepID, "status": step.Status,
+			executed := map[string]interface{}{"tool": intent.Tool, "step_id": stepID, "status": step.Status}
+			if redactions, ok := out["redactions"]; ok {
+				executed["redactions"] = redactions
+			}
+			a.emitAudit(runID, sessionID, "tool.executed", executed)
+		} else if result.Decision == core.DecisionRequireApproval && a.Approvals != nil {
+			ap, err := a.Approvals.Enqueue(&core.Approval{
+				SessionID: sessionID,
+				RunID:     runID,
+				StepID:    stepID,
+				Intent:    intent,
+				Reason:    result.Reason,
+				Intents:   intents,
+				Index:     i,
 			})
+			if err != nil {
+				if !record(core.Step{
+					StepID:  stepID,
+					Type:    "policy_eval",
+					Status:  "denied",
+					Tool:    intent.Tool,
+					Details: map[string]interface{}{"reason": "failed to queue approval: " + err.Error()},
+				}) {
+					return
+				}
+				stepCount++
+				finalStatus = "failed"
+				continue
+			}
+			if !record(core.Step{
+				StepID:  stepID,
+				Type:    "policy_eval",
+				Status:  "awaiting_approval",
+				Tool:    intent.Tool,
+				Details: map[string]interface{}{"reason": result.Reason, "approval_id": ap.ID},
+			}) {
+				return
+			}
+			if err := a.Store.UpdateRunStatus(runID, "awaiting_approval", nil, nil); err != nil {
+				log.Printf("run %s: persist status: %v", runID, err)
+				finalStatus = "failed"
+				return
+			}
+			a.emitAudit(runID, sessionID, "approval.requested", map[string]interface{}{
+				"approval_id": ap.ID, "tool": intent.Tool, "step_id": stepID, "reason": result.Reason,
+			})
+			paused = true
+			return
 		} else {
-			a.Store.AppendRunStep(runID, core.Step{
+			details := map[string]interface{}{"reason": result.Reason}
+			if result.SuggestedFix != "" {
+				details["suggested_fix"] = result.SuggestedFix
+			}
+			if !record(core.Step{
 				StepID:  stepID,
 				Type:    "policy_eval",
 				Status:  "denied",
 				Tool:    intent.Tool,
-				Details: map[string]interface{}{"reason": result.Reason},
-			})
+				Details: details,
+			}) {
+				return
+			}
 			stepCount++
 			finalStatus = "failed"
 		}
 	}
 }
 
+// decisionData is the policy.decision audit payload, naming the deciding rule and its pack version.
+func decisionData(intent core.ToolIntent, result core.PolicyResult, stepID string) map[string]interface{} {
+	data := map[string]interface{}{
+		"decision": string(result.Decision),
+		"tool":     intent.Tool,
+		"reason":   result.Reason,
+		"rule":     result.Rule,
+		"step_id":  stepID,
+	}
+	if result.Pack != "" {
+		data["pack"] = result.Pack
+		data["pack_version"] = result.PackVersion
+	}
+	return data
+}
+
 // finishRun sets run status, emits run.finished, and appends an assistant summary message to the session.
 func (a *Agent) finishRun(runID, sessionID, status string, stepCount int) {
 	ended := time.Now().UTC()
-	a.Store.UpdateRunStatus(runID, status, &ended, nil)
+	if err := a.Store.UpdateRunStatus(runID, status, &ended, nil); err != nil {
+		log.Printf("run %s: persist status: %v", runID, err)
+	}
 	a.emitAudit(runID, sessionID, "run.finished", map[string]interface{}{"status": status})
+	// Per-run quotas end with the run.
+	if a.Policy != nil && a.Policy.Counters != nil {
+		if err := a.Policy.Counters.DropRun(runID); err != nil {
+			log.Printf("run %s: drop run counters: %v", runID, err)
+		}
+	}
 
 	summary := fmt.Sprintf("Run %s %s. Steps: %d.", runID, status, stepCount)
-	a.Store.AppendMessage(sessionID, "assistant", summary, map[string]string{"run_id": runID})
+	if _, err := a.Store.AppendMessage(sessionID, "assistant", summary, map[string]string{"run_id": runID}); err != nil {
+		log.Printf("run %s: persist summary: %v", runID, err)
+	}
+}
+
+// redactParams returns a copy of an intent's params with every string in them passed through the
+// broker's output filters, for records that outlive the run such as the audit log. A string a filter
+// blocks or fails on is replaced by [REDACTED].
+func (a *Agent) redactParams(tool string, params map[string]interface{}) map[string]interface{} {
+	if a.Broker == nil || len(a.Broker.Filters) == 0 || params == nil {
+		return params
+	}
+	return redactValue(a.Broker.Filters, tool, params).(map[string]interface{})
+}
+
+func redactValue(filters []broker.OutputFilter, tool string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		for _, f := range filters {
+			out, _, err := f.Filter(tool, v)
+			if err != nil {
+				return "[REDACTED]"
+			}
+			v = out
+		}
+		return v
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			out[k] = redactValue(filters, tool, e)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = redactValue(filters, tool, e)
+		}
+		return out
+	}
+	return v
 }
 
 func (a *Agent) emitAudit(runID, sessionID, evType string, data map[string]interface{}) {
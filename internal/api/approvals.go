@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"securetalon/internal/approval"
+)
+
+// ListApprovals handles GET /v1/approvals?session_id=...&status=pending&limit=100
+func (h *Handlers) ListApprovals(w http.ResponseWriter, r *http.Request) {
+	if h.Approvals == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Approval store not available", nil)
+		return
+	}
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, _ := parseInt(l); n > 0 && n <= 500 {
+			limit = n
+		}
+	}
+	list := h.Approvals.List(r.URL.Query().Get("session_id"), r.URL.Query().Get("status"), limit)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"approvals": list})
+}
+
+// GetApproval handles GET /v1/approvals/{approval_id}
+func (h *Handlers) GetApproval(w http.ResponseWriter, r *http.Request, approvalID string) {
+	if h.Approvals == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Approval store not available", nil)
+		return
+	}
+	ap := h.Approvals.Get(approvalID)
+	if ap == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Approval not found", map[string]interface{}{"approval_id": approvalID})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ap)
+}
+
+// DecideApproval handles POST /v1/approvals/{approval_id}/approve and /reject.
+// The decision is persisted and audited, then the paused run resumes in the background.
+func (h *Handlers) DecideApproval(w http.ResponseWriter, r *http.Request, approvalID string, approved bool) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "POST required", nil)
+		return
+	}
+	if h.Approvals == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Approval store not available", nil)
+		return
+	}
+	var body struct {
+		DecidedBy string `json:"decided_by"`
+		Note      string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body", nil)
+			return
+		}
+	}
+	if body.DecidedBy == "" {
+		body.DecidedBy = "admin"
+	}
+	ap, err := h.Approvals.Decide(approvalID, approved, body.DecidedBy, body.Note)
+	if errors.Is(err, approval.ErrNotFound) {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Approval not found", map[string]interface{}{"approval_id": approvalID})
+		return
+	}
+	if errors.Is(err, approval.ErrAlreadyDecided) {
+		WriteError(w, http.StatusConflict, "ALREADY_DECIDED", "Approval already decided", map[string]interface{}{"approval_id": approvalID})
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	h.emitApprovalDecided(ap)
+	if h.Agent != nil {
+		go h.Agent.Resume(ap)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ap)
+}
@@ -3,6 +3,7 @@ package api
 
 import (
 	"securetalon/internal/core"
+	"securetalon/internal/policy"
 )
 
 func (h *Handlers) emitSessionCreated(sess *core.Session) {
@@ -71,3 +72,219 @@ func (h *Handlers) emitRunFinished(runID string, sessionID string, status string
 	}
 	_ = h.AuditStore.Append(ev)
 }
+
+func (h *Handlers) emitApprovalDecided(ap *core.Approval) {
+	if h.AuditStore == nil {
+		return
+	}
+	ev := &core.AuditEvent{
+		SessionID: ap.SessionID,
+		RunID:     ap.RunID,
+		Type:      "approval." + ap.Status,
+		Data: map[string]interface{}{
+			"approval_id": ap.ID,
+			"tool":        ap.Intent.Tool,
+			"step_id":     ap.StepID,
+			"decided_by":  ap.DecidedBy,
+			"note":        ap.Note,
+		},
+	}
+	_ = h.AuditStore.Append(ev)
+}
+
+func (h *Handlers) emitPolicyUpdated(sessionID, author, beforeHash, afterHash string, rev *policy.Revision) {
+	if h.AuditStore == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"author":      author,
+		"before_hash": beforeHash,
+		"after_hash":  afterHash,
+	}
+	if rev != nil {
+		data["version"] = rev.Version
+		data["added"] = len(rev.Diff.Added)
+		data["removed"] = len(rev.Diff.Removed)
+		if rev.RollbackOf > 0 {
+			data["rollback_of"] = rev.RollbackOf
+		}
+	}
+	ev := &core.AuditEvent{
+		SessionID: sessionID,
+		Type:      "policy.updated",
+		Data:      data,
+	}
+	_ = h.AuditStore.Append(ev)
+}
+
+func (h *Handlers) emitPolicyLinted(sessionID, author string, report policy.LintReport, accepted bool) {
+	if h.AuditStore == nil {
+		return
+	}
+	ev := &core.AuditEvent{
+		SessionID: sessionID,
+		Type:      "policy.linted",
+		Data: map[string]interface{}{
+			"author":   author,
+			"accepted": accepted,
+			"score":    report.Score,
+			"level":    report.Level,
+			"findings": report.Findings,
+		},
+	}
+	_ = h.AuditStore.Append(ev)
+}
+
+func (h *Handlers) emitPackEvent(evType, name string, version int, author, hash string) {
+	if h.AuditStore == nil {
+		return
+	}
+	ev := &core.AuditEvent{
+		Type: evType,
+		Data: map[string]interface{}{"pack": name, "version": version, "author": author, "hash": hash},
+	}
+	_ = h.AuditStore.Append(ev)
+}
+
+func (h *Handlers) emitKeyRotated(activeKid, retiredKid string) {
+	if h.AuditStore == nil {
+		return
+	}
+	ev := &core.AuditEvent{
+		Type: "capability.key_rotated",
+		Data: map[string]interface{}{"active_kid": activeKid, "retired_kid": retiredKid},
+	}
+	_ = h.AuditStore.Append(ev)
+}
+
+func (h *Handlers) emitCapabilityRevoked(c *policy.Capability) {
+	if h.AuditStore == nil {
+		return
+	}
+	ev := &core.AuditEvent{
+		SessionID: c.SessionID,
+		Type:      "capability.revoked",
+		Data: map[string]interface{}{
+			"cap_id":  c.CapID,
+			"tool":    c.Tool,
+			"subject": c.Subject,
+			"author":  c.RevokedBy,
+			"reason":  c.RevokeReason,
+		},
+	}
+	_ = h.AuditStore.Append(ev)
+}
+
+func (h *Handlers) emitSessionClosed(sess *core.Session, author string, revoked int) {
+	if h.AuditStore == nil {
+		return
+	}
+	ev := &core.AuditEvent{
+		SessionID: sess.ID,
+		Type:      "session.closed",
+		Data:      map[string]interface{}{"author": author, "revoked": revoked},
+	}
+	_ = h.AuditStore.Append(ev)
+}
+
+// emitWorkspaceEvent appends workspace.uploaded, workspace.downloaded or workspace.wiped.
+func (h *Handlers) emitWorkspaceEvent(evType, sessionID string, data map[string]interface{}) {
+	if h.AuditStore == nil {
+		return
+	}
+	ev := &core.AuditEvent{
+		SessionID: sessionID,
+		Type:      evType,
+		Data:      data,
+	}
+	_ = h.AuditStore.Append(ev)
+}
+
+// emitCapabilityDecision appends policy.decision for a token requested through the API and, when one
+// was issued, capability.issued.
+func (h *Handlers) emitCapabilityDecision(sessionID string, intent core.ToolIntent, result core.PolicyResult) {
+	if h.AuditStore == nil {
+		return
+	}
+	ev := &core.AuditEvent{
+		SessionID: sessionID,
+		Type:      "policy.decision",
+		Data: map[string]interface{}{
+			"decision": string(result.Decision),
+			"tool":     intent.Tool,
+			"reason":   result.Reason,
+			"rule":     result.Rule,
+		},
+	}
+	_ = h.AuditStore.Append(ev)
+	if result.Token == nil {
+		return
+	}
+	issued := map[string]interface{}{
+		"token_hash":  result.Token.Signature,
+		"tool":        intent.Tool,
+		"ttl_seconds": result.Token.Exp - result.Token.Iat,
+		"exp":         result.Token.Exp,
+	}
+	if result.Token.Kid != "" {
+		issued["kid"] = result.Token.Kid
+	}
+	ev = &core.AuditEvent{
+		SessionID: sessionID,
+		Type:      "capability.issued",
+		Data:      issued,
+	}
+	_ = h.AuditStore.Append(ev)
+}
+
+// emitCapabilityDelegated appends capability.delegated for the caveat just added to tok.
+func (h *Handlers) emitCapabilityDelegated(tok *core.CapabilityToken) {
+	if h.AuditStore == nil || len(tok.Caveats) == 0 {
+		return
+	}
+	cv := tok.Caveats[len(tok.Caveats)-1]
+	data := map[string]interface{}{
+		"cap_id":      cv.CapID,
+		"root_cap_id": tok.CapID,
+		"tool":        tok.Tool,
+		"subject":     cv.Subject,
+		"exp":         cv.Exp,
+		"depth":       len(tok.Caveats),
+	}
+	if len(cv.Constraints) > 0 {
+		data["constraints"] = cv.Constraints
+	}
+	if cv.MaxUses > 0 {
+		data["max_uses"] = cv.MaxUses
+	}
+	if cv.IntentDigest != "" {
+		data["intent_digest"] = cv.IntentDigest
+	}
+	ev := &core.AuditEvent{
+		SessionID: tok.SessionID,
+		Type:      "capability.delegated",
+		Data:      data,
+	}
+	_ = h.AuditStore.Append(ev)
+}
+
+// emitCapabilityExecuted appends tool.executed for a token presented to ExecuteCapability.
+func (h *Handlers) emitCapabilityExecuted(tok *core.CapabilityToken, out map[string]interface{}, err error) {
+	if h.AuditStore == nil {
+		return
+	}
+	data := map[string]interface{}{"tool": tok.Tool, "cap_id": tok.CapID, "status": "ok"}
+	if err != nil {
+		data["status"] = "error"
+		data["error"] = err.Error()
+	}
+	if redactions, ok := out["redactions"]; ok {
+		data["redactions"] = redactions
+	}
+	ev := &core.AuditEvent{
+		SessionID: tok.SessionID,
+		Type:      "tool.executed",
+		Data:      data,
+	}
+	_ = h.AuditStore.Append(ev)
+}
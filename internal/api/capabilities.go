@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"securetalon/internal/policy"
+)
+
+// ListCapabilities handles GET /v1/capabilities?session_id=...&subject=...
+// Returns unexpired tokens (including revoked ones) with signatures redacted.
+func (h *Handlers) ListCapabilities(w http.ResponseWriter, r *http.Request) {
+	caps := []*policy.Capability{}
+	if h.Policy != nil && h.Policy.Capabilities != nil {
+		q := r.URL.Query()
+		caps = h.Policy.Capabilities.List(policy.CapabilityFilter{SessionID: q.Get("session_id"), Subject: q.Get("subject")})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"capabilities": caps})
+}
+
+// revokeBody is the optional body of the revoke endpoints.
+type revokeBody struct {
+	SessionID string `json:"session_id"`
+	Subject   string `json:"subject"`
+	Author    string `json:"author"`
+	Reason    string `json:"reason"`
+}
+
+func decodeRevokeBody(r *http.Request) (revokeBody, error) {
+	var body revokeBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		return body, err
+	}
+	if body.Author == "" {
+		body.Author = "admin"
+	}
+	return body, nil
+}
+
+// RevokeCapability handles POST /v1/capabilities/{cap_id}/revoke
+// The broker rejects the token from then on, even before it expires.
+func (h *Handlers) RevokeCapability(w http.ResponseWriter, r *http.Request, capID string) {
+	if h.Policy == nil || h.Policy.Capabilities == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Capability store not available", nil)
+		return
+	}
+	body, err := decodeRevokeBody(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body", nil)
+		return
+	}
+	c, err := h.Policy.Capabilities.Get(capID)
+	if errors.Is(err, policy.ErrCapabilityNotFound) {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Capability not found or expired", map[string]interface{}{"cap_id": capID})
+		return
+	}
+	alreadyRevoked := err == nil && c.Revoked()
+	if err == nil {
+		c, err = h.Policy.Capabilities.Revoke(capID, body.Author, body.Reason)
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	if !alreadyRevoked {
+		h.emitCapabilityRevoked(c)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"capability": c})
+}
+
+// RevokeCapabilities handles POST /v1/capabilities/revoke with session_id and/or subject.
+// Revokes every outstanding token they select; tokens issued afterwards are not affected.
+func (h *Handlers) RevokeCapabilities(w http.ResponseWriter, r *http.Request) {
+	if h.Policy == nil || h.Policy.Capabilities == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Capability store not available", nil)
+		return
+	}
+	body, err := decodeRevokeBody(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body", nil)
+		return
+	}
+	if body.SessionID == "" && body.Subject == "" {
+		WriteError(w, http.StatusBadRequest, "INVALID_REQUEST", "session_id or subject required", nil)
+		return
+	}
+	revoked, err := h.Policy.Capabilities.RevokeMatching(policy.CapabilityFilter{SessionID: body.SessionID, Subject: body.Subject}, body.Author, body.Reason)
+	for _, c := range revoked {
+		h.emitCapabilityRevoked(c)
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"revoked": len(revoked), "capabilities": revoked})
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"securetalon/internal/broker"
+	"securetalon/internal/core"
+	"securetalon/internal/policy"
+)
+
+// IssueCapability handles POST /v1/sessions/{id}/capabilities with {"tool", "params", "subject"}.
+// The intent is decided under the session's policy as in a run and, when allowed, the token is returned
+// (with its delegation proof if the deciding rule is delegable) for an orchestrator to attenuate with
+// DelegateCapability and hand to sub-agents, which present it to ExecuteCapability.
+func (h *Handlers) IssueCapability(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if h.Policy == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Policy engine not available", nil)
+		return
+	}
+	sess := h.Store.GetSession(sessionID)
+	if sess == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found", map[string]interface{}{"session_id": sessionID})
+		return
+	}
+	if sess.Status == core.SessionClosed {
+		WriteError(w, http.StatusConflict, "SESSION_CLOSED", "Session is closed", map[string]interface{}{"session_id": sessionID})
+		return
+	}
+	var body core.ToolIntent
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body", nil)
+		return
+	}
+	if body.Tool == "" {
+		WriteError(w, http.StatusBadRequest, "INVALID_REQUEST", "tool required", nil)
+		return
+	}
+	intent := h.Policy.ResolveIntent(body, sessionID)
+	result := h.Policy.Evaluate(intent, sessionID)
+	h.emitCapabilityDecision(sessionID, intent, result)
+	if result.Decision != core.DecisionAllow || result.Token == nil {
+		WriteError(w, http.StatusForbidden, "POLICY_DENIED", result.Reason, map[string]interface{}{
+			"decision": result.Decision, "rule": result.Rule, "suggested_fix": result.SuggestedFix,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"token": result.Token, "reason": result.Reason, "rule": result.Rule})
+}
+
+// DelegateCapability handles POST /v1/capabilities/delegate with
+// {"token", "subject", "constraints", "ttl_seconds", "max_uses"}. The caller presents a delegable
+// token with its proof and gets back a copy attenuated by one caveat (see policy.Delegate), still
+// bound to the intent the token was issued for.
+func (h *Handlers) DelegateCapability(w http.ResponseWriter, r *http.Request) {
+	if h.Policy == nil || h.Broker == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Broker not available", nil)
+		return
+	}
+	var body struct {
+		Token       *core.CapabilityToken  `json:"token"`
+		Subject     string                 `json:"subject"`
+		Constraints map[string]interface{} `json:"constraints"`
+		TTLSeconds  int64                  `json:"ttl_seconds"`
+		MaxUses     int                    `json:"max_uses"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body", nil)
+		return
+	}
+	tok := body.Token
+	if tok == nil {
+		WriteError(w, http.StatusBadRequest, "INVALID_REQUEST", "token required", nil)
+		return
+	}
+	if err := h.Broker.Verifier.Verify(tok); err != nil {
+		WriteError(w, http.StatusForbidden, "INVALID_TOKEN", err.Error(), nil)
+		return
+	}
+	if h.Policy.Capabilities != nil {
+		for _, capID := range lineage(tok) {
+			if h.Policy.Capabilities.IsRevoked(capID) {
+				WriteError(w, http.StatusForbidden, "REVOKED", "Capability revoked", map[string]interface{}{"cap_id": capID})
+				return
+			}
+		}
+	}
+	d := policy.Delegation{Subject: body.Subject, Constraints: body.Constraints, TTLSeconds: body.TTLSeconds, MaxUses: body.MaxUses}
+	child, err := policy.Delegate(tok, d)
+	if errors.Is(err, policy.ErrNotDelegable) {
+		WriteError(w, http.StatusBadRequest, "NOT_DELEGABLE", "Token was not issued by a delegable rule", map[string]interface{}{"cap_id": tok.CapID})
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "INVALID_DELEGATION", err.Error(), nil)
+		return
+	}
+	if h.Policy.Capabilities != nil {
+		if err := h.Policy.Capabilities.RecordDelegation(child); err != nil {
+			WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+			return
+		}
+	}
+	h.emitCapabilityDelegated(child)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"token": child})
+}
+
+// ExecuteCapability handles POST /v1/capabilities/execute with {"token", "params"}. The broker runs
+// the token's tool with params (relative paths resolved in the token's session workspace) after the
+// same checks as in a run: signature, revocation, caveats, intent binding, use budget and constraints.
+func (h *Handlers) ExecuteCapability(w http.ResponseWriter, r *http.Request) {
+	if h.Policy == nil || h.Broker == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Broker not available", nil)
+		return
+	}
+	var body struct {
+		Token  *core.CapabilityToken  `json:"token"`
+		Params map[string]interface{} `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body", nil)
+		return
+	}
+	tok := body.Token
+	if tok == nil {
+		WriteError(w, http.StatusBadRequest, "INVALID_REQUEST", "token required", nil)
+		return
+	}
+	intent := h.Policy.ResolveIntent(core.ToolIntent{Tool: tok.Tool, Params: body.Params}, tok.SessionID)
+	out, err := h.Broker.Execute(intent, tok)
+	h.emitCapabilityExecuted(tok, out, err)
+	switch {
+	case errors.Is(err, broker.ErrReplayBlocked), errors.Is(err, broker.ErrRevoked), errors.Is(err, broker.ErrOutputBlocked):
+		WriteError(w, http.StatusForbidden, "CAPABILITY_REJECTED", err.Error(), map[string]interface{}{"cap_id": tok.CapID})
+		return
+	case err != nil:
+		WriteError(w, http.StatusBadRequest, "EXECUTION_FAILED", err.Error(), map[string]interface{}{"cap_id": tok.CapID})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": out})
+}
+
+// lineage lists the cap_id of a token and of each of its caveats.
+func lineage(tok *core.CapabilityToken) []string {
+	ids := []string{tok.CapID}
+	for _, c := range tok.Caveats {
+		ids = append(ids, c.CapID)
+	}
+	return ids
+}
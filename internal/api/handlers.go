@@ -2,13 +2,17 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"securetalon/internal/agent"
+	"securetalon/internal/approval"
 	"securetalon/internal/audit"
+	"securetalon/internal/broker"
 	"securetalon/internal/core"
 	"securetalon/internal/policy"
 	"securetalon/internal/replay"
+	"securetalon/internal/workspace"
 )
 
 // Handlers holds dependencies for HTTP handlers.
@@ -17,6 +21,10 @@ type Handlers struct {
 	Policy      *policy.Engine
 	AuditStore  *audit.Store
 	Agent       *agent.Agent
+	Approvals   *approval.Store
+	Keys        *policy.Keyring
+	Workspaces  *workspace.Manager
+	Broker      *broker.Broker
 }
 
 // CreateSession handles POST /v1/sessions
@@ -33,7 +41,17 @@ func (h *Handlers) CreateSession(w http.ResponseWriter, r *http.Request) {
 		WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body", nil)
 		return
 	}
-	sess := h.Store.CreateSession(body.Label, body.Metadata)
+	sess, err := h.Store.CreateSession(body.Label, body.Metadata)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	if h.Workspaces != nil {
+		if _, err := h.Workspaces.Ensure(sess.ID); err != nil {
+			WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+			return
+		}
+	}
 	h.emitSessionCreated(sess)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -74,6 +92,47 @@ func (h *Handlers) GetSession(w http.ResponseWriter, r *http.Request, sessionID
 	json.NewEncoder(w).Encode(sess)
 }
 
+// CloseSession handles POST /v1/sessions/{id}/close?author=...
+// Marks the session closed, revokes its outstanding capability tokens and wipes its workspace; the
+// policy engine denies every further intent of the session.
+func (h *Handlers) CloseSession(w http.ResponseWriter, r *http.Request, sessionID string) {
+	author := r.URL.Query().Get("author")
+	if author == "" {
+		author = "admin"
+	}
+	sess, err := h.Store.CloseSession(sessionID)
+	if errors.Is(err, core.ErrNotFound) {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found", map[string]interface{}{"session_id": sessionID})
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	revoked := []*policy.Capability{}
+	if h.Policy != nil && h.Policy.Capabilities != nil {
+		var err error
+		revoked, err = h.Policy.Capabilities.RevokeMatching(policy.CapabilityFilter{SessionID: sessionID}, author, "session closed")
+		for _, c := range revoked {
+			h.emitCapabilityRevoked(c)
+		}
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+			return
+		}
+	}
+	if h.Workspaces != nil {
+		if err := h.Workspaces.Wipe(sessionID); err != nil {
+			WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+			return
+		}
+		h.emitWorkspaceEvent("workspace.wiped", sessionID, map[string]interface{}{"author": author})
+	}
+	h.emitSessionClosed(sess, author, len(revoked))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"session": sess, "revoked": len(revoked)})
+}
+
 // PostMessage handles POST /v1/sessions/{id}/messages (starts a run; returns run_id)
 func (h *Handlers) PostMessage(w http.ResponseWriter, r *http.Request, sessionID string) {
 	if r.Method != http.MethodPost {
@@ -85,6 +144,10 @@ func (h *Handlers) PostMessage(w http.ResponseWriter, r *http.Request, sessionID
 		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found", map[string]interface{}{"session_id": sessionID})
 		return
 	}
+	if sess.Status == core.SessionClosed {
+		WriteError(w, http.StatusConflict, "SESSION_CLOSED", "Session is closed", map[string]interface{}{"session_id": sessionID})
+		return
+	}
 	var body struct {
 		Role     string              `json:"role"`
 		Content  string              `json:"content"`
@@ -98,13 +161,19 @@ func (h *Handlers) PostMessage(w http.ResponseWriter, r *http.Request, sessionID
 	if body.Role == "" {
 		body.Role = "user"
 	}
-	msg, ok := h.Store.AppendMessage(sessionID, body.Role, body.Content, body.Metadata)
-	if !ok {
-		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Failed to append message", nil)
+	msg, err := h.Store.AppendMessage(sessionID, body.Role, body.Content, body.Metadata)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Failed to append message: "+err.Error(), nil)
+		return
+	}
+	run, err := h.Store.CreateRun(sessionID)
+	if err == nil {
+		err = h.Store.SetMessageRunID(sessionID, run.ID)
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Failed to create run: "+err.Error(), nil)
 		return
 	}
-	run := h.Store.CreateRun(sessionID)
-	h.Store.SetMessageRunID(sessionID, run.ID)
 	h.emitMessageAppended(sessionID, msg, run.ID)
 	h.emitRunStarted(run)
 	if h.Agent != nil {
@@ -154,7 +223,7 @@ func (h *Handlers) GetRun(w http.ResponseWriter, r *http.Request, runID string)
 	json.NewEncoder(w).Encode(run)
 }
 
-// PutSessionPolicy handles PUT /v1/sessions/{id}/policy
+// PutSessionPolicy handles PUT /v1/sessions/{id}/policy. Each PUT creates a new policy revision.
 func (h *Handlers) PutSessionPolicy(w http.ResponseWriter, r *http.Request, sessionID string) {
 	if h.Store.GetSession(sessionID) == nil {
 		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found", map[string]interface{}{"session_id": sessionID})
@@ -162,20 +231,128 @@ func (h *Handlers) PutSessionPolicy(w http.ResponseWriter, r *http.Request, sess
 	}
 	var body struct {
 		Overrides []policy.RuleOverride `json:"overrides"`
+		Packs     []policy.PackRef      `json:"packs"`
+		Author    string                `json:"author"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body", nil)
 		return
 	}
+	if body.Author == "" {
+		body.Author = "admin"
+	}
+	resp := map[string]interface{}{"ok": true}
 	if h.Policy != nil {
-		h.Policy.SetSessionPolicy(sessionID, &policy.SessionPolicy{Overrides: body.Overrides})
+		sp := &policy.SessionPolicy{Overrides: body.Overrides, Packs: body.Packs}
+		err := policy.ValidateRules(sp.Overrides)
+		if err == nil {
+			err = h.Policy.PinPackRefs(sp)
+		}
+		if err != nil {
+			var verr *policy.ValidationError
+			errors.As(err, &verr)
+			WriteError(w, http.StatusBadRequest, "INVALID_POLICY", verr.Error(), map[string]interface{}{"rules": verr.Rules})
+			return
+		}
+		report := policy.Lint(sp, h.Policy.GlobalPolicy())
+		if report.HasErrors() {
+			h.emitPolicyLinted(sessionID, body.Author, report, false)
+			WriteError(w, http.StatusBadRequest, "POLICY_REJECTED", "Policy has risky rules; see findings", map[string]interface{}{"lint": report})
+			return
+		}
+		beforeHash := policy.PolicyHash(h.Policy.SessionPolicy(sessionID))
+		rev, err := h.Policy.PutSessionPolicy(sessionID, body.Author, sp)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+			return
+		}
+		h.emitPolicyLinted(sessionID, body.Author, report, true)
+		h.emitPolicyUpdated(sessionID, body.Author, beforeHash, policy.PolicyHash(sp), rev)
+		if rev != nil {
+			resp["revision"] = rev
+		}
+		resp["lint"] = report
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListPolicyRevisions handles GET /v1/sessions/{id}/policy/revisions
+func (h *Handlers) ListPolicyRevisions(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if h.Store.GetSession(sessionID) == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found", map[string]interface{}{"session_id": sessionID})
+		return
+	}
+	revisions := []*policy.Revision{}
+	if h.Policy != nil && h.Policy.Revisions != nil {
+		revisions = h.Policy.Revisions.List(sessionID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"revisions": revisions})
+}
+
+// RollbackSessionPolicy handles POST /v1/sessions/{id}/policy/rollback with {"version": N}.
+// The restored policy becomes a new revision; history is never rewritten.
+func (h *Handlers) RollbackSessionPolicy(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if h.Store.GetSession(sessionID) == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found", map[string]interface{}{"session_id": sessionID})
+		return
+	}
+	var body struct {
+		Version int    `json:"version"`
+		Author  string `json:"author"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body", nil)
+		return
+	}
+	if body.Version <= 0 {
+		WriteError(w, http.StatusBadRequest, "INVALID_REQUEST", "version required", nil)
+		return
+	}
+	if body.Author == "" {
+		body.Author = "admin"
+	}
+	if h.Policy == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Policy engine not available", nil)
+		return
+	}
+	// The restored policy goes through the same validation and lint as a PUT.
+	sp, err := h.Policy.RevisionPolicy(sessionID, body.Version)
+	if errors.Is(err, policy.ErrRevisionNotFound) {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Policy revision not found", map[string]interface{}{"session_id": sessionID, "version": body.Version})
+		return
+	}
+	var verr *policy.ValidationError
+	if errors.As(err, &verr) {
+		WriteError(w, http.StatusBadRequest, "INVALID_POLICY", verr.Error(), map[string]interface{}{"rules": verr.Rules})
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	report := policy.Lint(sp, h.Policy.GlobalPolicy())
+	if report.HasErrors() {
+		h.emitPolicyLinted(sessionID, body.Author, report, false)
+		WriteError(w, http.StatusBadRequest, "POLICY_REJECTED", "Policy has risky rules; see findings", map[string]interface{}{"lint": report})
+		return
+	}
+	beforeHash := policy.PolicyHash(h.Policy.SessionPolicy(sessionID))
+	rev, err := h.Policy.RollbackSessionPolicy(sessionID, body.Author, body.Version)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	h.emitPolicyLinted(sessionID, body.Author, report, true)
+	h.emitPolicyUpdated(sessionID, body.Author, beforeHash, rev.Hash, rev)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "revision": rev, "lint": report})
 }
 
 // GetEffectivePolicy handles GET /v1/policy/effective?session_id=...
+// Returns the merged builtin, global and session layers; each rule names the layer that contributed it.
 func (h *Handlers) GetEffectivePolicy(w http.ResponseWriter, r *http.Request) {
 	sessionID := r.URL.Query().Get("session_id")
 	if sessionID != "" && h.Store.GetSession(sessionID) == nil {
@@ -183,20 +360,37 @@ func (h *Handlers) GetEffectivePolicy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	overrides := []interface{}{}
-	if h.Policy != nil && sessionID != "" {
-		if sp := h.Policy.SessionOverrides[sessionID]; sp != nil {
-			for _, r := range sp.Overrides {
-				overrides = append(overrides, r)
+	effective := policy.EffectivePolicy{Default: "deny", Rules: []policy.EffectiveRule{}}
+	if h.Policy != nil {
+		if sessionID != "" {
+			if sp := h.Policy.SessionPolicy(sessionID); sp != nil {
+				for _, r := range sp.Overrides {
+					overrides = append(overrides, r)
+				}
 			}
 		}
+		effective = h.Policy.Effective(sessionID)
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"default":   "deny",
+		"default":   effective.Default,
 		"overrides": overrides,
+		"rules":     effective.Rules,
+		"ceilings":  effective.Ceilings,
 	})
 }
 
+// ListCounters handles GET /v1/policy/counters?session_id=...
+// Returns the usage of rule limits in their current windows.
+func (h *Handlers) ListCounters(w http.ResponseWriter, r *http.Request) {
+	counters := []*policy.Counter{}
+	if h.Policy != nil && h.Policy.Counters != nil {
+		counters = h.Policy.Counters.List(r.URL.Query().Get("session_id"))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"counters": counters})
+}
+
 // ListSkills handles GET /v1/skills
 func (h *Handlers) ListSkills(w http.ResponseWriter, r *http.Request) {
 	// Stub: empty list until skills package is wired
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ListKeys handles GET /v1/policy/keys
+// Returns the public halves of the token signing keys (active and retired) for external verifiers.
+func (h *Handlers) ListKeys(w http.ResponseWriter, r *http.Request) {
+	if h.Keys == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Keyring not available", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": h.Keys.PublicKeys()})
+}
+
+// RotateKeys handles POST /v1/policy/keys/rotate
+// Makes a new signing key active now. The previous key is retired and keeps verifying in-flight tokens.
+func (h *Handlers) RotateKeys(w http.ResponseWriter, r *http.Request) {
+	if h.Keys == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Keyring not available", nil)
+		return
+	}
+	previous := h.Keys.Active()
+	key, err := h.Keys.Rotate()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Key rotation failed", nil)
+		return
+	}
+	retired := ""
+	if previous != nil {
+		retired = previous.Kid
+	}
+	h.emitKeyRotated(key.Kid, retired)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"active_kid": key.Kid, "retired_kid": retired, "keys": h.Keys.PublicKeys()})
+}
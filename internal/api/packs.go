@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"securetalon/internal/policy"
+)
+
+// ListPacks handles GET /v1/policy/packs
+func (h *Handlers) ListPacks(w http.ResponseWriter, r *http.Request) {
+	if h.Policy == nil || h.Policy.Packs == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Pack store not available", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"packs": h.Policy.Packs.List()})
+}
+
+// GetPack handles GET /v1/policy/packs/{name}?version=N (latest when omitted), including all versions.
+func (h *Handlers) GetPack(w http.ResponseWriter, r *http.Request, name string) {
+	if h.Policy == nil || h.Policy.Packs == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Pack store not available", nil)
+		return
+	}
+	version := 0
+	if v := r.URL.Query().Get("version"); v != "" {
+		n, ok := parseInt(v)
+		if !ok || n < 1 {
+			WriteError(w, http.StatusBadRequest, "INVALID_REQUEST", "version must be a positive integer", nil)
+			return
+		}
+		version = n
+	}
+	p, err := h.Policy.Packs.Get(name, version)
+	if err != nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Pack not found", map[string]interface{}{"name": name, "version": version})
+		return
+	}
+	versions := []int{}
+	for _, v := range h.Policy.Packs.Versions(name) {
+		versions = append(versions, v.Version)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"pack": p, "versions": versions})
+}
+
+// PutPack handles POST /v1/policy/packs (name in body) and PUT /v1/policy/packs/{name}.
+// Each call publishes a new immutable version; the rules are validated and linted like a session policy.
+func (h *Handlers) PutPack(w http.ResponseWriter, r *http.Request, name string) {
+	if h.Policy == nil || h.Policy.Packs == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Pack store not available", nil)
+		return
+	}
+	var body struct {
+		Name        string                `json:"name"`
+		Description string                `json:"description"`
+		Rules       []policy.RuleOverride `json:"rules"`
+		Author      string                `json:"author"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body", nil)
+		return
+	}
+	if name == "" {
+		name = body.Name
+	}
+	if _, version, err := policy.ParsePackRef(name); err != nil || version != 0 {
+		WriteError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid pack name (lowercase letters, digits, '.', '_', '-')", map[string]interface{}{"name": name})
+		return
+	}
+	if body.Author == "" {
+		body.Author = "admin"
+	}
+	if err := policy.ValidateRules(body.Rules); err != nil {
+		var verr *policy.ValidationError
+		errors.As(err, &verr)
+		WriteError(w, http.StatusBadRequest, "INVALID_POLICY", verr.Error(), map[string]interface{}{"rules": verr.Rules})
+		return
+	}
+	report := policy.Lint(&policy.SessionPolicy{Overrides: body.Rules}, h.Policy.GlobalPolicy())
+	if report.HasErrors() {
+		WriteError(w, http.StatusBadRequest, "POLICY_REJECTED", "Pack has risky rules; see findings", map[string]interface{}{"lint": report})
+		return
+	}
+	p, err := h.Policy.Packs.Put(name, body.Description, body.Author, body.Rules)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	h.emitPackEvent("policy.pack.published", p.Name, p.Version, body.Author, p.Hash)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"pack": p, "lint": report})
+}
+
+// DeletePack handles DELETE /v1/policy/packs/{name}?author=...
+// The pack can no longer be newly referenced; sessions already pinned to a version keep it.
+func (h *Handlers) DeletePack(w http.ResponseWriter, r *http.Request, name string) {
+	if h.Policy == nil || h.Policy.Packs == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Pack store not available", nil)
+		return
+	}
+	author := r.URL.Query().Get("author")
+	if author == "" {
+		author = "admin"
+	}
+	latest, err := h.Policy.Packs.Get(name, 0)
+	if err == nil {
+		err = h.Policy.Packs.Delete(name, author)
+	}
+	if errors.Is(err, policy.ErrPackNotFound) {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Pack not found", map[string]interface{}{"name": name})
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	h.emitPackEvent("policy.pack.deleted", name, latest.Version, author, latest.Hash)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+}
@@ -8,8 +8,11 @@ import (
 
 // Router serves /v1/* with path params. Auth middleware must wrap this.
 var (
-	reSessionID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
-	reRunID     = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	reSessionID  = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	reRunID      = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	reApprovalID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	rePackName   = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+	reCapID      = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 )
 
 // NewRouter returns an http.Handler that routes /v1/* to Handlers.
@@ -64,10 +67,54 @@ func NewRouter(h *Handlers) http.Handler {
 			WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", nil)
 			return
 		}
+		if rest == "close" {
+			if r.Method == http.MethodPost {
+				h.CloseSession(w, r, sessionID)
+				return
+			}
+			WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "POST required", nil)
+			return
+		}
+		if rest == "workspace" {
+			if r.Method == http.MethodGet {
+				h.ListWorkspace(w, r, sessionID)
+				return
+			}
+			WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "GET required", nil)
+			return
+		}
+		if strings.HasPrefix(rest, "workspace/") {
+			filePath := strings.TrimPrefix(rest, "workspace/")
+			switch r.Method {
+			case http.MethodGet:
+				h.GetWorkspaceFile(w, r, sessionID, filePath)
+			case http.MethodPut:
+				h.PutWorkspaceFile(w, r, sessionID, filePath)
+			default:
+				WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", nil)
+			}
+			return
+		}
+		if rest == "capabilities" {
+			if r.Method == http.MethodPost {
+				h.IssueCapability(w, r, sessionID)
+				return
+			}
+			WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "POST required", nil)
+			return
+		}
 		if rest == "policy" && r.Method == http.MethodPut {
 			h.PutSessionPolicy(w, r, sessionID)
 			return
 		}
+		if rest == "policy/revisions" && r.Method == http.MethodGet {
+			h.ListPolicyRevisions(w, r, sessionID)
+			return
+		}
+		if rest == "policy/rollback" && r.Method == http.MethodPost {
+			h.RollbackSessionPolicy(w, r, sessionID)
+			return
+		}
 		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Not found", nil)
 	})
 	mux.HandleFunc("/v1/runs/", func(w http.ResponseWriter, r *http.Request) {
@@ -92,6 +139,42 @@ func NewRouter(h *Handlers) http.Handler {
 		}
 		WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", nil)
 	})
+	mux.HandleFunc("/v1/approvals", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/approvals" {
+			WriteError(w, http.StatusNotFound, "NOT_FOUND", "Not found", nil)
+			return
+		}
+		if r.Method == http.MethodGet {
+			h.ListApprovals(w, r)
+			return
+		}
+		WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", nil)
+	})
+	mux.HandleFunc("/v1/approvals/", func(w http.ResponseWriter, r *http.Request) {
+		trimmed := strings.TrimPrefix(r.URL.Path, "/v1/approvals/")
+		parts := strings.SplitN(trimmed, "/", 2)
+		approvalID := parts[0]
+		if approvalID == "" || !reApprovalID.MatchString(approvalID) {
+			WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid approval id", nil)
+			return
+		}
+		if len(parts) == 2 {
+			switch parts[1] {
+			case "approve":
+				h.DecideApproval(w, r, approvalID, true)
+			case "reject":
+				h.DecideApproval(w, r, approvalID, false)
+			default:
+				WriteError(w, http.StatusNotFound, "NOT_FOUND", "Not found", nil)
+			}
+			return
+		}
+		if r.Method == http.MethodGet {
+			h.GetApproval(w, r, approvalID)
+			return
+		}
+		WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", nil)
+	})
 	mux.HandleFunc("/v1/policy/effective", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/v1/policy/effective" {
 			WriteError(w, http.StatusNotFound, "NOT_FOUND", "Not found", nil)
@@ -103,6 +186,127 @@ func NewRouter(h *Handlers) http.Handler {
 		}
 		WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", nil)
 	})
+	mux.HandleFunc("/v1/policy/packs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/policy/packs" {
+			WriteError(w, http.StatusNotFound, "NOT_FOUND", "Not found", nil)
+			return
+		}
+		if r.Method == http.MethodGet {
+			h.ListPacks(w, r)
+			return
+		}
+		if r.Method == http.MethodPost {
+			h.PutPack(w, r, "")
+			return
+		}
+		WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", nil)
+	})
+	mux.HandleFunc("/v1/policy/packs/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/v1/policy/packs/")
+		if !rePackName.MatchString(name) {
+			WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid pack name", nil)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			h.GetPack(w, r, name)
+		case http.MethodPut:
+			h.PutPack(w, r, name)
+		case http.MethodDelete:
+			h.DeletePack(w, r, name)
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", nil)
+		}
+	})
+	mux.HandleFunc("/v1/policy/counters", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/policy/counters" {
+			WriteError(w, http.StatusNotFound, "NOT_FOUND", "Not found", nil)
+			return
+		}
+		if r.Method == http.MethodGet {
+			h.ListCounters(w, r)
+			return
+		}
+		WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", nil)
+	})
+	mux.HandleFunc("/v1/policy/keys", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/policy/keys" {
+			WriteError(w, http.StatusNotFound, "NOT_FOUND", "Not found", nil)
+			return
+		}
+		if r.Method == http.MethodGet {
+			h.ListKeys(w, r)
+			return
+		}
+		WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", nil)
+	})
+	mux.HandleFunc("/v1/policy/keys/rotate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			h.RotateKeys(w, r)
+			return
+		}
+		WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "POST required", nil)
+	})
+	mux.HandleFunc("/v1/policy/simulate", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/policy/simulate" {
+			WriteError(w, http.StatusNotFound, "NOT_FOUND", "Not found", nil)
+			return
+		}
+		if r.Method == http.MethodPost {
+			h.SimulatePolicy(w, r)
+			return
+		}
+		WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", nil)
+	})
+	mux.HandleFunc("/v1/capabilities", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/capabilities" {
+			WriteError(w, http.StatusNotFound, "NOT_FOUND", "Not found", nil)
+			return
+		}
+		if r.Method == http.MethodGet {
+			h.ListCapabilities(w, r)
+			return
+		}
+		WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", nil)
+	})
+	mux.HandleFunc("/v1/capabilities/", func(w http.ResponseWriter, r *http.Request) {
+		trimmed := strings.TrimPrefix(r.URL.Path, "/v1/capabilities/")
+		if trimmed == "revoke" {
+			if r.Method == http.MethodPost {
+				h.RevokeCapabilities(w, r)
+				return
+			}
+			WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "POST required", nil)
+			return
+		}
+		if trimmed == "delegate" || trimmed == "execute" {
+			if r.Method != http.MethodPost {
+				WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "POST required", nil)
+				return
+			}
+			if trimmed == "delegate" {
+				h.DelegateCapability(w, r)
+			} else {
+				h.ExecuteCapability(w, r)
+			}
+			return
+		}
+		parts := strings.SplitN(trimmed, "/", 2)
+		capID := parts[0]
+		if !reCapID.MatchString(capID) {
+			WriteError(w, http.StatusBadRequest, "INVALID_ID", "Invalid capability id", nil)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "revoke" {
+			if r.Method == http.MethodPost {
+				h.RevokeCapability(w, r, capID)
+				return
+			}
+			WriteError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "POST required", nil)
+			return
+		}
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Not found", nil)
+	})
 	mux.HandleFunc("/v1/skills", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/v1/skills" {
 			WriteError(w, http.StatusNotFound, "NOT_FOUND", "Not found", nil)
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"securetalon/internal/core"
+	"securetalon/internal/policy"
+)
+
+// SimulatePolicy handles POST /v1/policy/simulate.
+// Body: {"session_id", "run_id", "policy": {"overrides": [...]}, "intents": [...]}. Without intents,
+// the intents of run_id (or of every run of session_id) are taken from policy.intent.received audit events.
+// Each intent is decided under the live and the candidate session policy; nothing is executed.
+func (h *Handlers) SimulatePolicy(w http.ResponseWriter, r *http.Request) {
+	if h.Policy == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Policy engine not available", nil)
+		return
+	}
+	var body struct {
+		SessionID string               `json:"session_id"`
+		RunID     string               `json:"run_id"`
+		Policy    policy.SessionPolicy `json:"policy"`
+		Intents   []core.ToolIntent    `json:"intents"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body", nil)
+		return
+	}
+	if body.RunID != "" {
+		run := h.Store.GetRun(body.RunID)
+		if run == nil {
+			WriteError(w, http.StatusNotFound, "NOT_FOUND", "Run not found", map[string]interface{}{"run_id": body.RunID})
+			return
+		}
+		if body.SessionID == "" {
+			body.SessionID = run.SessionID
+		} else if body.SessionID != run.SessionID {
+			WriteError(w, http.StatusBadRequest, "INVALID_REQUEST", "run_id does not belong to session_id", nil)
+			return
+		}
+	}
+	if body.SessionID != "" && h.Store.GetSession(body.SessionID) == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found", map[string]interface{}{"session_id": body.SessionID})
+		return
+	}
+	err := policy.ValidateRules(body.Policy.Overrides)
+	if err == nil {
+		err = h.Policy.PinPackRefs(&body.Policy)
+	}
+	if err != nil {
+		var verr *policy.ValidationError
+		errors.As(err, &verr)
+		WriteError(w, http.StatusBadRequest, "INVALID_POLICY", verr.Error(), map[string]interface{}{"rules": verr.Rules})
+		return
+	}
+	intents := body.Intents
+	source := "request"
+	if len(intents) == 0 {
+		if body.SessionID == "" {
+			WriteError(w, http.StatusBadRequest, "INVALID_REQUEST", "intents, run_id or session_id required", nil)
+			return
+		}
+		intents = h.recordedIntents(body.SessionID, body.RunID)
+		source = "audit"
+	}
+
+	results := h.Policy.Simulate(body.SessionID, &body.Policy, intents)
+	summary := map[string]int{"total": len(results), "changed": 0, policy.ChangeLoosened: 0, policy.ChangeTightened: 0, policy.ChangeRule: 0}
+	for _, res := range results {
+		if res.Changed {
+			summary["changed"]++
+			summary[res.Change]++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"session_id": body.SessionID,
+		"run_id":     body.RunID,
+		"source":     source,
+		"results":    results,
+		"summary":    summary,
+	})
+}
+
+// recordedIntents rebuilds the intents a session (or one of its runs) submitted from the audit log.
+// Events written before params were recorded yield intents with empty params. file.write content is
+// recorded as its sha256, size and MIME type (policy.SummarizeParams), which the policy checks in its place.
+func (h *Handlers) recordedIntents(sessionID, runID string) []core.ToolIntent {
+	intents := []core.ToolIntent{}
+	if h.AuditStore == nil {
+		return intents
+	}
+	events, _, _ := h.AuditStore.Query(sessionID, runID, "", "", "policy.intent.received", 0)
+	for _, ev := range events {
+		tool, _ := ev.Data["tool"].(string)
+		if tool == "" {
+			continue
+		}
+		params, _ := ev.Data["params"].(map[string]interface{})
+		if params == nil {
+			params = make(map[string]interface{})
+		}
+		subject, _ := ev.Data["subject"].(string)
+		intents = append(intents, core.ToolIntent{Tool: tool, Params: params, Subject: subject})
+	}
+	return intents
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+
+	"securetalon/internal/core"
+	"securetalon/internal/workspace"
+)
+
+// MaxWorkspaceUpload bounds the size of one uploaded workspace file.
+const MaxWorkspaceUpload = 10 << 20
+
+// ListWorkspace handles GET /v1/sessions/{id}/workspace
+// Returns the regular files in the session's workspace.
+func (h *Handlers) ListWorkspace(w http.ResponseWriter, r *http.Request, sessionID string) {
+	if !h.workspaceSession(w, sessionID, false) {
+		return
+	}
+	files, err := h.Workspaces.List(sessionID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"files": files})
+}
+
+// GetWorkspaceFile handles GET /v1/sessions/{id}/workspace/{path}
+// Streams the file as application/octet-stream.
+func (h *Handlers) GetWorkspaceFile(w http.ResponseWriter, r *http.Request, sessionID, rel string) {
+	if !h.workspaceSession(w, sessionID, false) {
+		return
+	}
+	f, err := h.Workspaces.Open(sessionID, rel)
+	if err != nil {
+		writeWorkspaceError(w, rel, err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	h.emitWorkspaceEvent("workspace.downloaded", sessionID, map[string]interface{}{"path": rel, "size": fi.Size()})
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(path.Base(rel)))
+	io.Copy(w, f)
+}
+
+// PutWorkspaceFile handles PUT /v1/sessions/{id}/workspace/{path}?author=...
+// Stores the raw request body (at most MaxWorkspaceUpload bytes), replacing an existing file.
+func (h *Handlers) PutWorkspaceFile(w http.ResponseWriter, r *http.Request, sessionID, rel string) {
+	if !h.workspaceSession(w, sessionID, true) {
+		return
+	}
+	author := r.URL.Query().Get("author")
+	if author == "" {
+		author = "admin"
+	}
+	if r.ContentLength > MaxWorkspaceUpload {
+		WriteError(w, http.StatusRequestEntityTooLarge, "TOO_LARGE", "File too large", map[string]interface{}{"max_bytes": MaxWorkspaceUpload})
+		return
+	}
+	sum := sha256.New()
+	size, err := h.Workspaces.Write(sessionID, rel, io.TeeReader(r.Body, sum), MaxWorkspaceUpload)
+	if errors.Is(err, workspace.ErrTooLarge) {
+		WriteError(w, http.StatusRequestEntityTooLarge, "TOO_LARGE", "File too large", map[string]interface{}{"max_bytes": MaxWorkspaceUpload})
+		return
+	}
+	if err != nil {
+		writeWorkspaceError(w, rel, err)
+		return
+	}
+	file := map[string]interface{}{
+		"path":   rel,
+		"size":   size,
+		"sha256": hex.EncodeToString(sum.Sum(nil)),
+	}
+	h.emitWorkspaceEvent("workspace.uploaded", sessionID, map[string]interface{}{
+		"path": rel, "size": size, "sha256": file["sha256"], "author": author,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"file": file})
+}
+
+// workspaceSession writes an error and returns false unless workspaces are enabled and the session
+// exists (and, for uploads, is open).
+func (h *Handlers) workspaceSession(w http.ResponseWriter, sessionID string, open bool) bool {
+	if h.Workspaces == nil {
+		WriteError(w, http.StatusInternalServerError, "INTERNAL", "Workspaces not available", nil)
+		return false
+	}
+	sess := h.Store.GetSession(sessionID)
+	if sess == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Session not found", map[string]interface{}{"session_id": sessionID})
+		return false
+	}
+	if open && sess.Status == core.SessionClosed {
+		WriteError(w, http.StatusConflict, "SESSION_CLOSED", "Session is closed", map[string]interface{}{"session_id": sessionID})
+		return false
+	}
+	return true
+}
+
+func writeWorkspaceError(w http.ResponseWriter, rel string, err error) {
+	details := map[string]interface{}{"path": rel}
+	if errors.Is(err, fs.ErrNotExist) {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "File not found", details)
+		return
+	}
+	// Invalid paths, symlinks, directories and special files.
+	WriteError(w, http.StatusBadRequest, "INVALID_PATH", err.Error(), details)
+}
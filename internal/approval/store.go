@@ -0,0 +1,166 @@
+// Package approval provides the durable queue of tool intents awaiting a human decision (REQUIRE_APPROVAL).
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"securetalon/internal/core"
+)
+
+// Approval statuses.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+var (
+	// ErrNotFound is returned when no approval has the given ID.
+	ErrNotFound = errors.New("approval not found")
+	// ErrAlreadyDecided is returned when approving or rejecting an approval that is no longer pending.
+	ErrAlreadyDecided = errors.New("approval already decided")
+)
+
+// Store is an append-only JSONL log of approval records. The last record per ID wins on load,
+// so every state transition is durable across restarts.
+type Store struct {
+	mu    sync.Mutex
+	dir   string
+	items map[string]*core.Approval
+	order []string
+}
+
+// NewStore creates an approval store under dir (e.g. data/approvals) and loads existing records.
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, items: make(map[string]*core.Approval)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) path() string {
+	return filepath.Join(s.dir, "approvals.jsonl")
+}
+
+func (s *Store) load() error {
+	f, err := os.Open(s.path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		var ap core.Approval
+		if err := dec.Decode(&ap); err != nil {
+			break
+		}
+		if _, ok := s.items[ap.ID]; !ok {
+			s.order = append(s.order, ap.ID)
+		}
+		s.items[ap.ID] = &ap
+	}
+	return nil
+}
+
+func (s *Store) appendLine(ap *core.Approval) error {
+	f, err := os.OpenFile(s.path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(ap)
+}
+
+// Enqueue adds a pending approval. ID, status and created_at are set by the store.
+func (s *Store) Enqueue(ap *core.Approval) (*core.Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := *ap
+	rec.ID = core.NewApprovalID()
+	rec.Status = StatusPending
+	rec.CreatedAt = time.Now().UTC()
+	if err := s.appendLine(&rec); err != nil {
+		return nil, err
+	}
+	s.items[rec.ID] = &rec
+	s.order = append(s.order, rec.ID)
+	out := rec
+	return &out, nil
+}
+
+// Get returns a copy of the approval or nil.
+func (s *Store) Get(id string) *core.Approval {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ap := s.items[id]
+	if ap == nil {
+		return nil
+	}
+	out := *ap
+	return &out
+}
+
+// List returns approvals oldest first, optionally filtered by session and status.
+func (s *Store) List(sessionID, status string, limit int) []*core.Approval {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit <= 0 {
+		limit = 100
+	}
+	out := []*core.Approval{}
+	for _, id := range s.order {
+		ap := s.items[id]
+		if sessionID != "" && ap.SessionID != sessionID {
+			continue
+		}
+		if status != "" && ap.Status != status {
+			continue
+		}
+		cp := *ap
+		out = append(out, &cp)
+		if len(out) >= limit {
+			break
+		}
+	}
+	return out
+}
+
+// Decide approves or rejects a pending approval and persists the decision.
+func (s *Store) Decide(id string, approved bool, decidedBy, note string) (*core.Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ap := s.items[id]
+	if ap == nil {
+		return nil, ErrNotFound
+	}
+	if ap.Status != StatusPending {
+		return nil, ErrAlreadyDecided
+	}
+	rec := *ap
+	rec.Status = StatusRejected
+	if approved {
+		rec.Status = StatusApproved
+	}
+	now := time.Now().UTC()
+	rec.DecidedAt = &now
+	rec.DecidedBy = decidedBy
+	rec.Note = note
+	if err := s.appendLine(&rec); err != nil {
+		return nil, err
+	}
+	s.items[id] = &rec
+	out := rec
+	return &out, nil
+}
@@ -0,0 +1,57 @@
+package approval
+
+import (
+	"testing"
+
+	"securetalon/internal/core"
+)
+
+func TestEnqueueDecideAndReload(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ap, err := store.Enqueue(&core.Approval{
+		SessionID: "sess_1",
+		RunID:     "run_1",
+		StepID:    "s1",
+		Intent:    core.ToolIntent{Tool: "file.write"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ap.ID == "" || ap.Status != StatusPending {
+		t.Fatalf("expected pending approval with id, got %q %q", ap.ID, ap.Status)
+	}
+	if got := store.List("", StatusPending, 0); len(got) != 1 {
+		t.Fatalf("expected 1 pending approval, got %d", len(got))
+	}
+
+	decided, err := store.Decide(ap.ID, true, "alice", "looks fine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decided.Status != StatusApproved || decided.DecidedAt == nil {
+		t.Fatalf("expected approved with decided_at, got %q", decided.Status)
+	}
+	if _, err := store.Decide(ap.ID, false, "bob", ""); err != ErrAlreadyDecided {
+		t.Fatalf("expected ErrAlreadyDecided, got %v", err)
+	}
+	if _, err := store.Decide("apr_missing", true, "bob", ""); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// Reopen: last record per id wins
+	reopened, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := reopened.Get(ap.ID)
+	if got == nil || got.Status != StatusApproved || got.DecidedBy != "alice" {
+		t.Fatalf("expected approved decision after reload, got %+v", got)
+	}
+	if len(reopened.List("", "", 0)) != 1 {
+		t.Fatal("expected one approval after reload")
+	}
+}
@@ -9,12 +9,13 @@ import (
 	"time"
 
 	"securetalon/internal/core"
+	"securetalon/internal/jcs"
 )
 
 // Store is an append-only JSONL audit log with hash chaining.
 type Store struct {
-	mu      sync.Mutex
-	dir     string
+	mu       sync.Mutex
+	dir      string
 	prevHash string
 }
 
@@ -54,6 +55,10 @@ func (s *Store) loadLastHash() error {
 	return nil
 }
 
+// CanonJCS marks events hashed over their JCS (RFC 8785) encoding. Events without a canon marker were
+// written before JCS and are validated with the legacy encoding/json form.
+const CanonJCS = "jcs"
+
 // Append writes one event with hash = sha256(prev_hash + canonical_json(event)).
 func (s *Store) Append(ev *core.AuditEvent) error {
 	s.mu.Lock()
@@ -65,6 +70,7 @@ func (s *Store) Append(ev *core.AuditEvent) error {
 		ev.Timestamp = time.Now().UTC()
 	}
 	ev.PrevHash = s.prevHash
+	ev.Canon = CanonJCS
 	ev.Hash = chainHash(s.prevHash, ev)
 	s.prevHash = ev.Hash
 	return s.appendLine(ev)
@@ -89,6 +95,7 @@ type canonicalEvent struct {
 	Type      string                 `json:"type"`
 	Data      map[string]interface{} `json:"data"`
 	PrevHash  string                 `json:"prev_hash"`
+	Canon     string                 `json:"canon,omitempty"`
 }
 
 func canonicalEventFrom(ev *core.AuditEvent) canonicalEvent {
@@ -100,14 +107,21 @@ func canonicalEventFrom(ev *core.AuditEvent) canonicalEvent {
 		Type:      ev.Type,
 		Data:      ev.Data,
 		PrevHash:  ev.PrevHash,
+		Canon:     ev.Canon,
 	}
 }
 
-// chainHash computes sha256(prevHash + canonical_json(ev)) without the hash field.
+// chainHash computes sha256(prevHash + canonical_json(ev)) without the hash field. canonical_json is
+// JCS for events marked CanonJCS and encoding/json for legacy events.
 func chainHash(prevHash string, ev *core.AuditEvent) string {
 	c := canonicalEventFrom(ev)
 	c.PrevHash = prevHash
-	raw, _ := json.Marshal(c)
+	var raw []byte
+	if ev.Canon == CanonJCS {
+		raw, _ = jcs.Marshal(c)
+	} else {
+		raw, _ = json.Marshal(c)
+	}
 	return sha256Hex(prevHash + string(raw))
 }
 
@@ -1,10 +1,14 @@
 package audit
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"securetalon/internal/core"
+	"securetalon/internal/jcs"
 )
 
 func TestAuditHashChain(t *testing.T) {
@@ -22,8 +26,8 @@ func TestAuditHashChain(t *testing.T) {
 	if err := store.Append(ev1); err != nil {
 		t.Fatal(err)
 	}
-	if ev1.PrevHash != "" || ev1.Hash == "" {
-		t.Fatalf("first event: prev_hash=%q hash=%q", ev1.PrevHash, ev1.Hash)
+	if ev1.PrevHash != "" || ev1.Hash == "" || ev1.Canon != CanonJCS {
+		t.Fatalf("first event: prev_hash=%q hash=%q canon=%q", ev1.PrevHash, ev1.Hash, ev1.Canon)
 	}
 
 	ev2 := &core.AuditEvent{
@@ -79,3 +83,34 @@ func TestValidateChainDetectsTampering(t *testing.T) {
 	}
 }
 
+// TestChainGoldenVectors validates testdata/chain_vectors.json, a chain that starts with a legacy
+// (pre-JCS) event followed by JCS events. External verifiers use the same file.
+func TestChainGoldenVectors(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("testdata", "chain_vectors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors struct {
+		Events    []core.AuditEvent `json:"events"`
+		Canonical []string          `json:"canonical"`
+	}
+	if err := json.Unmarshal(raw, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	if idx, _ := ValidateChain(vectors.Events); idx >= 0 {
+		t.Fatalf("golden chain invalid at index %d", idx)
+	}
+	for i := range vectors.Events {
+		ev := &vectors.Events[i]
+		if ev.Canon != CanonJCS {
+			continue
+		}
+		got, err := jcs.Marshal(canonicalEventFrom(ev))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != vectors.Canonical[i] {
+			t.Errorf("event %d canonical form\n got  %s\n want %s", i, got, vectors.Canonical[i])
+		}
+	}
+}
@@ -3,19 +3,53 @@
 package broker
 
 import (
+	"errors"
 	"fmt"
+	"sync"
+
+	"securetalon/internal/audit"
 	"securetalon/internal/core"
 	"securetalon/internal/policy"
+	"securetalon/internal/safefs"
 )
 
+// ErrRevoked is returned by Execute for a token on the revocation list.
+var ErrRevoked = errors.New("capability token revoked")
+
+// RevocationList reports revoked capabilities. policy.CapabilityStore satisfies it.
+type RevocationList interface {
+	IsRevoked(capID string) bool
+}
+
+// DelegationLog records the caveats of delegated tokens as they are used, so delegates can be listed
+// and revoked individually. policy.CapabilityStore satisfies it.
+type DelegationLog interface {
+	RecordDelegation(tok *core.CapabilityToken) error
+}
+
 // Broker executes tool intents after verifying the capability token and constraints.
+// Nonces tracks token uses so a token cannot be replayed beyond its max_uses. Revocations, when set,
+// is checked on every Execute for the token and each caveat of a delegated token. Delegations and
+// AuditStore, when set, record delegated tokens and their lineage as they are used. Filters run, in
+// order, over the output of file.read, http.fetch and docker.run (see filterOutput).
 type Broker struct {
-	Verifier *policy.Verifier
+	Verifier    *policy.Verifier
+	Nonces      *NonceStore
+	Revocations RevocationList
+	Delegations DelegationLog
+	AuditStore  *audit.Store
+	Filters     []OutputFilter
+
+	writeMu sync.Mutex // serializes file.write (see doFileWrite)
 }
 
-// NewBroker returns a broker that uses the given verifier.
+// NewBroker returns a broker that uses the given verifier and redacts outputs with the default
+// detectors. Used nonces are kept for the verifier's leeway past expiry, so set v.Leeway before
+// calling.
 func NewBroker(v *policy.Verifier) *Broker {
-	return &Broker{Verifier: v}
+	nonces := NewNonceStore()
+	nonces.Leeway = v.Leeway
+	return &Broker{Verifier: v, Nonces: nonces, Filters: []OutputFilter{&Redactor{}}}
 }
 
 // Execute verifies the token and runs the tool. Returns result or error.
@@ -27,90 +61,218 @@ func (b *Broker) Execute(intent core.ToolIntent, token *core.CapabilityToken) (r
 	if err := b.Verifier.Verify(token); err != nil {
 		return nil, fmt.Errorf("invalid token: %w", err)
 	}
+	if b.Revocations != nil {
+		if b.Revocations.IsRevoked(token.CapID) {
+			return nil, fmt.Errorf("%w: cap_id %s", ErrRevoked, token.CapID)
+		}
+		for _, c := range token.Caveats {
+			if b.Revocations.IsRevoked(c.CapID) {
+				return nil, fmt.Errorf("%w: delegated cap_id %s", ErrRevoked, c.CapID)
+			}
+		}
+	}
 	if token.Tool != intent.Tool {
 		return nil, fmt.Errorf("token tool mismatch")
 	}
+	if bound := policy.EffectiveIntentDigest(token); bound != "" {
+		digest, err := policy.IntentDigest(intent.Params)
+		if err != nil || digest != bound {
+			return nil, fmt.Errorf("token intent mismatch: params differ from the intent the policy engine evaluated")
+		}
+	}
 	// Enforce constraints against intent params
-	if err := b.checkConstraints(intent, token); err != nil {
+	constraints, err := b.checkConstraints(intent, token)
+	if err != nil {
 		return nil, err
 	}
+	if len(token.Caveats) > 0 && b.Delegations != nil {
+		if err := b.Delegations.RecordDelegation(token); err != nil {
+			return nil, fmt.Errorf("record delegation: %w", err)
+		}
+	}
+	// Count the use only once the token is known to authorize this intent
+	if b.Nonces != nil {
+		if uses, limit, err := b.Nonces.Use(token); err != nil {
+			b.emitReplayBlocked(token, uses, limit)
+			return nil, fmt.Errorf("%w: cap_id %s already used %d of %d time(s)", err, token.CapID, uses, limit)
+		}
+	}
+	if len(token.Caveats) > 0 {
+		b.emitDelegationUsed(token)
+	}
 	switch intent.Tool {
 	case "file.read":
-		return b.doFileRead(intent.Params, token.Constraints)
+		result, err = b.doFileRead(intent.Params, constraints, token)
 	case "file.write":
-		return b.doFileWrite(intent.Params, token.Constraints)
+		return b.doFileWrite(intent.Params, constraints)
+	case "file.list", "file.stat", "file.delete", "file.move":
+		result, err = fileOps[intent.Tool](b, intent.Params, constraints)
+		if err == nil {
+			b.emitFileEvent(token, intent.Tool, result)
+		}
+		return result, err
 	case "http.fetch":
-		return b.doHTTPFetch(intent.Params, token.Constraints)
+		result, err = b.doHTTPFetch(intent.Params, constraints)
 	case "docker.run":
-		return b.doDockerRun(intent.Params, token.Constraints)
+		result, err = b.doDockerRun(intent.Params, constraints)
 	case "shell.exec":
 		return nil, fmt.Errorf("shell.exec disabled by default")
 	default:
 		return nil, fmt.Errorf("unknown tool: %s", intent.Tool)
 	}
+	if err != nil {
+		return nil, err
+	}
+	return b.filterOutput(token, intent.Tool, result)
 }
 
-// checkConstraints enforces token constraints on intent params (e.g. path under allowed root).
-func (b *Broker) checkConstraints(intent core.ToolIntent, token *core.CapabilityToken) error {
+// checkConstraints enforces token constraints on intent params (e.g. path under allowed root) and
+// returns the effective constraints. For a delegated token these are the root constraints narrowed by
+// every caveat in the chain; a caveat that would widen its parent's grant invalidates the token.
+func (b *Broker) checkConstraints(intent core.ToolIntent, token *core.CapabilityToken) (map[string]interface{}, error) {
 	tool := intent.Tool
 	params := intent.Params
-	constraints := token.Constraints
-	if constraints == nil {
-		return fmt.Errorf("no constraints on token")
+	if token.Constraints == nil {
+		return nil, fmt.Errorf("no constraints on token")
+	}
+	constraints, err := policy.EffectiveConstraints(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delegation: %w", err)
 	}
 	switch tool {
-	case "file.read", "file.write":
+	case "file.read", "file.write", "file.list", "file.stat", "file.delete", "file.move":
 		path, _ := params["path"].(string)
 		if path == "" {
-			return fmt.Errorf("path required")
+			return nil, fmt.Errorf("path required")
 		}
 		allowedRoots := constraints["roots"]
 		if allowedRoots == nil {
-			return fmt.Errorf("constraint roots required for file access")
+			return nil, fmt.Errorf("constraint roots required for file access")
+		}
+		paths := []string{path}
+		if tool == "file.move" {
+			dest, _ := params["dest"].(string)
+			if dest == "" {
+				return nil, fmt.Errorf("dest required")
+			}
+			paths = append(paths, dest)
+		}
+		for _, p := range paths {
+			if safefs.HasDotDot(p) {
+				return nil, fmt.Errorf("path %s contains '..'", p)
+			}
+			if !pathUnderAllowedRoots(p, allowedRoots) {
+				return nil, fmt.Errorf("path %s not under allowed roots (e.g. block /etc/passwd)", p)
+			}
 		}
-		if !pathUnderAllowedRoots(path, allowedRoots) {
-			return fmt.Errorf("path %s not under allowed roots (e.g. block /etc/passwd)", path)
+		if exts, ok := constraints["extensions"]; ok && (tool == "file.read" || tool == "file.write") {
+			if !policy.ExtensionAllowed(path, rootList(exts)) {
+				return nil, fmt.Errorf("extension of %s not allowed by token", path)
+			}
 		}
 	case "http.fetch":
 		// domain allowlist checked in doHTTPFetch
 	case "docker.run":
 		// image digest allowlist checked in doDockerRun
 	}
-	return nil
+	return constraints, nil
 }
 
-// pathUnderAllowedRoots returns true if path is under one of the allowed root prefixes.
+// pathUnderAllowedRoots returns true if path is under one of the allowed roots. This is the lexical
+// check; the file tools re-check against the real filesystem when opening (see openUnderRoots).
 func pathUnderAllowedRoots(path string, allowedRoots interface{}) bool {
-	// allowedRoots can be []interface{} from JSON
-	switch v := allowedRoots.(type) {
-	case []string:
-		for _, root := range v {
-			if pathUnder(path, root) {
-				return true
-			}
-		}
-	case []interface{}:
-		for _, r := range v {
-			if s, ok := r.(string); ok && pathUnder(path, s) {
-				return true
-			}
+	for _, root := range rootList(allowedRoots) {
+		if safefs.Under(path, root) {
+			return true
 		}
 	}
 	return false
 }
 
-func pathUnder(path, root string) bool {
-	if root == "" {
-		return false
+// fileOps are the file tools that report an audit event of their own (see emitFileEvent).
+var fileOps = map[string]func(*Broker, map[string]interface{}, map[string]interface{}) (map[string]interface{}, error){
+	"file.list":   (*Broker).doFileList,
+	"file.stat":   (*Broker).doFileStat,
+	"file.delete": (*Broker).doFileDelete,
+	"file.move":   (*Broker).doFileMove,
+}
+
+// fileEvents are the audit event types of fileOps.
+var fileEvents = map[string]string{
+	"file.list":   "file.listed",
+	"file.stat":   "file.stat",
+	"file.delete": "file.deleted",
+	"file.move":   "file.moved",
+}
+
+// emitFileEvent records a file.list, file.stat, file.delete or file.move with its cap_id and result
+// (without the listed entries).
+func (b *Broker) emitFileEvent(token *core.CapabilityToken, tool string, result map[string]interface{}) {
+	if b.AuditStore == nil {
+		return
 	}
-	if len(root) > len(path) {
-		return false
+	data := map[string]interface{}{"cap_id": token.CapID, "tool": tool}
+	for k, v := range result {
+		if k != "entries" {
+			data[k] = v
+		}
+	}
+	ev := &core.AuditEvent{
+		SessionID: token.SessionID,
+		Type:      fileEvents[tool],
+		Data:      data,
+	}
+	_ = b.AuditStore.Append(ev)
+}
+
+// emitReplayBlocked records an attempt to execute a token that has no uses left.
+func (b *Broker) emitReplayBlocked(token *core.CapabilityToken, uses, limit int) {
+	if b.AuditStore == nil {
+		return
+	}
+	ev := &core.AuditEvent{
+		SessionID: token.SessionID,
+		Type:      "capability.replay_blocked",
+		Data: map[string]interface{}{
+			"cap_id":   token.CapID,
+			"tool":     token.Tool,
+			"subject":  token.Subject,
+			"uses":     uses,
+			"max_uses": limit,
+		},
 	}
-	if path[:len(root)] != root {
-		return false
+	_ = b.AuditStore.Append(ev)
+}
+
+// emitDelegationUsed records the lineage of a delegated token: the root capability and every caveat
+// from the issuer's grant down to the presenting delegate.
+func (b *Broker) emitDelegationUsed(token *core.CapabilityToken) {
+	if b.AuditStore == nil {
+		return
+	}
+	lineage := make([]map[string]interface{}, 0, len(token.Caveats))
+	subject := token.Subject
+	for _, c := range token.Caveats {
+		if c.Subject != "" {
+			subject = c.Subject
+		}
+		entry := map[string]interface{}{"cap_id": c.CapID, "subject": subject, "exp": c.Exp}
+		if len(c.Constraints) > 0 {
+			entry["constraints"] = c.Constraints
+		}
+		lineage = append(lineage, entry)
 	}
-	if len(path) == len(root) {
-		return true
+	ev := &core.AuditEvent{
+		SessionID: token.SessionID,
+		Type:      "capability.delegation_used",
+		Data: map[string]interface{}{
+			"cap_id":       token.CapID,
+			"root_subject": token.Subject,
+			"subject":      subject,
+			"tool":         token.Tool,
+			"depth":        len(token.Caveats),
+			"lineage":      lineage,
+		},
 	}
-	return path[len(root)] == '/' || path[len(root)] == '\\'
+	_ = b.AuditStore.Append(ev)
 }
@@ -1,8 +1,13 @@
 package broker
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"securetalon/internal/audit"
 	"securetalon/internal/core"
 	"securetalon/internal/policy"
 )
@@ -36,3 +41,230 @@ func TestBrokerConstraintEnforcement(t *testing.T) {
 		t.Fatal("expected constraint violation for /etc/passwd")
 	}
 }
+
+func TestBrokerBlocksReplay(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	os.WriteFile(path, []byte("hello"), 0600)
+	issuer := policy.NewIssuer("secret")
+	b := NewBroker(policy.NewVerifier("secret"))
+	intent := core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": path}}
+	constraints := map[string]interface{}{"roots": []interface{}{dir}}
+
+	tok, _ := issuer.Issue("sess_1", "agent", "file.read", constraints, 60)
+	if _, err := b.Execute(intent, tok); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if _, err := b.Execute(intent, tok); !errors.Is(err, ErrReplayBlocked) {
+		t.Fatalf("replay: got %v, want ErrReplayBlocked", err)
+	}
+
+	multi, _ := issuer.IssueGrant(policy.Grant{SessionID: "sess_1", Subject: "agent", Tool: "file.read", Constraints: constraints, TTLSeconds: 60, MaxUses: 3})
+	for i := 0; i < 3; i++ {
+		if _, err := b.Execute(intent, multi); err != nil {
+			t.Fatalf("use %d of 3: %v", i+1, err)
+		}
+	}
+	if _, err := b.Execute(intent, multi); !errors.Is(err, ErrReplayBlocked) {
+		t.Fatalf("fourth use: got %v, want ErrReplayBlocked", err)
+	}
+
+	// max_uses is signed: raising it invalidates the token
+	multi.MaxUses = 10
+	if _, err := b.Execute(intent, multi); err == nil || errors.Is(err, ErrReplayBlocked) {
+		t.Fatalf("tampered max_uses: got %v, want invalid token", err)
+	}
+}
+
+func TestNonceStoreDropsExpired(t *testing.T) {
+	s := NewNonceStore()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	tok := &core.CapabilityToken{CapID: "cap_1", Nonce: "n1", Exp: now.Unix() + 60}
+	if _, _, err := s.Use(tok); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Minute)
+	s.Use(&core.CapabilityToken{CapID: "cap_2", Nonce: "n2", Exp: now.Unix() + 60})
+	if s.Len() != 1 {
+		t.Fatalf("tracked nonces = %d, want 1 after expiry", s.Len())
+	}
+}
+
+func TestBrokerEnforcesIntentDigest(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0600)
+	}
+	engine := policy.NewEngine(policy.NewIssuer("secret"))
+	engine.SetSessionPolicy("sess_1", &policy.SessionPolicy{Overrides: []policy.RuleOverride{
+		{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []interface{}{dir}}},
+	}})
+	b := NewBroker(policy.NewVerifier("secret"))
+
+	evaluated := core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": filepath.Join(dir, "a.txt")}}
+	res := engine.Evaluate(evaluated, "sess_1")
+	if res.Token == nil || res.Token.IntentDigest == "" {
+		t.Fatalf("expected token bound to intent, got %+v", res)
+	}
+	other := core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": filepath.Join(dir, "b.txt")}}
+	if _, err := b.Execute(other, res.Token); err == nil {
+		t.Fatal("expected token minted for a.txt to be rejected for b.txt")
+	}
+	if _, err := b.Execute(evaluated, res.Token); err != nil {
+		t.Fatalf("evaluated intent: %v", err)
+	}
+}
+
+func TestBrokerRejectsRevoked(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	os.WriteFile(path, []byte("hello"), 0600)
+	caps, _ := policy.NewCapabilityStore("")
+	issuer := policy.NewIssuer("secret")
+	b := NewBroker(policy.NewVerifier("secret"))
+	b.Revocations = caps
+	intent := core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": path}}
+
+	tok, _ := issuer.Issue("sess_1", "agent", "file.read", map[string]interface{}{"roots": []interface{}{dir}}, 60)
+	caps.Record(tok)
+	caps.Revoke(tok.CapID, "admin", "test")
+	if _, err := b.Execute(intent, tok); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("got %v, want ErrRevoked", err)
+	}
+}
+
+func TestBrokerEnforcesDelegationChain(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "src"), 0700)
+	inside := filepath.Join(dir, "src", "main.go")
+	outside := filepath.Join(dir, "secrets.txt")
+	os.WriteFile(inside, []byte("package main"), 0600)
+	os.WriteFile(outside, []byte("hunter2"), 0600)
+	auditStore, _ := audit.NewStore(t.TempDir())
+	caps, _ := policy.NewCapabilityStore("")
+	b := NewBroker(policy.NewVerifier("secret"))
+	b.AuditStore = auditStore
+	b.Revocations = caps
+	b.Delegations = caps
+
+	root, _ := policy.NewIssuer("secret").IssueGrant(policy.Grant{
+		SessionID: "sess_1", Subject: "orchestrator", Tool: "file.read",
+		Constraints: map[string]interface{}{"roots": []interface{}{dir}},
+		TTLSeconds:  60, MaxUses: 5, Delegable: true,
+	})
+	child, err := policy.Delegate(root, policy.Delegation{
+		Subject:     "worker-1",
+		Constraints: map[string]interface{}{"roots": []string{filepath.Join(dir, "src")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(path string) core.ToolIntent {
+		return core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": path}}
+	}
+	if _, err := b.Execute(read(outside), child); err == nil {
+		t.Fatal("delegated token must not read outside the caveat's roots")
+	}
+	if _, err := b.Execute(read(outside), root); err != nil {
+		t.Fatalf("root token: %v", err)
+	}
+	if _, err := b.Execute(read(inside), child); err != nil {
+		t.Fatalf("delegated token: %v", err)
+	}
+	events, _, _ := auditStore.Query("sess_1", "", "", "", "capability.delegation_used", 10)
+	if len(events) != 1 || events[0].Data["subject"] != "worker-1" || events[0].Data["cap_id"] != root.CapID {
+		t.Fatalf("delegation audit events = %+v", events)
+	}
+
+	if c, err := caps.Get(child.Caveats[0].CapID); err != nil || c.Parent != root.CapID || c.Subject != "worker-1" {
+		t.Fatalf("recorded delegation = %+v, %v", c, err)
+	}
+	caps.Revoke(child.Caveats[0].CapID, "admin", "test")
+	if _, err := b.Execute(read(inside), child); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("revoked caveat: got %v, want ErrRevoked", err)
+	}
+}
+
+func TestBrokerAuditsReplay(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	os.WriteFile(path, []byte("hello"), 0600)
+	auditStore, _ := audit.NewStore(t.TempDir())
+	engine := policy.NewEngine(policy.NewIssuer("secret"))
+	engine.SetSessionPolicy("sess_1", &policy.SessionPolicy{Overrides: []policy.RuleOverride{
+		{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []interface{}{dir}}},
+	}})
+	b := NewBroker(policy.NewVerifier("secret"))
+	b.AuditStore = auditStore
+	intent := core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": path}}
+	tok := engine.Evaluate(intent, "sess_1").Token
+	if tok == nil {
+		t.Fatal("expected a token")
+	}
+	if _, err := b.Execute(intent, tok); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if _, err := b.Execute(intent, tok); !errors.Is(err, ErrReplayBlocked) {
+		t.Fatalf("replay: got %v, want ErrReplayBlocked", err)
+	}
+	events, _, _ := auditStore.Query("sess_1", "", "", "", "capability.replay_blocked", 0)
+	if len(events) != 1 || events[0].Data["cap_id"] != tok.CapID || events[0].Data["max_uses"] != float64(1) {
+		t.Fatalf("expected one capability.replay_blocked event for %s, got %+v", tok.CapID, events)
+	}
+}
+
+func TestBrokerDelegateKeepsIntentBinding(t *testing.T) {
+	dir := t.TempDir()
+	a, secret := filepath.Join(dir, "a.txt"), filepath.Join(dir, "secrets", "key")
+	os.MkdirAll(filepath.Dir(secret), 0700)
+	os.WriteFile(a, []byte("a"), 0600)
+	os.WriteFile(secret, []byte("key"), 0600)
+	engine := policy.NewEngine(policy.NewIssuer("secret"))
+	engine.SetSessionPolicy("sess_1", &policy.SessionPolicy{Overrides: []policy.RuleOverride{
+		{Tool: "file.read", Allow: true, Delegable: true, MaxUses: 3, Constraints: map[string]interface{}{"roots": []interface{}{dir}}},
+		{Tool: "file.read", Allow: false, Constraints: map[string]interface{}{"roots": []interface{}{filepath.Dir(secret)}}},
+	}})
+	b := NewBroker(policy.NewVerifier("secret"))
+	readA := core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": a}}
+	readSecret := core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": secret}}
+	root := engine.Evaluate(readA, "sess_1").Token
+	if root == nil {
+		t.Fatal("expected a token")
+	}
+
+	// The secret lies within the token's roots, but the session denies it: neither the delegate
+	// nor a re-binding caveat can reach it.
+	child, err := policy.Delegate(root, policy.Delegation{Subject: "worker-1", MaxUses: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Execute(readSecret, child); err == nil {
+		t.Fatal("delegate executed an intent the session denies")
+	}
+	digest, _ := policy.IntentDigest(readSecret.Params)
+	if _, err := policy.Delegate(root, policy.Delegation{IntentDigest: digest}); err == nil {
+		t.Fatal("delegate re-bound to an intent the session denies")
+	}
+
+	out, err := b.Execute(readA, child)
+	if err != nil {
+		t.Fatalf("delegate: %v", err)
+	}
+	if out["content"] != "a" {
+		t.Fatalf("content = %v", out["content"])
+	}
+	if _, err := b.Execute(readA, child); !errors.Is(err, ErrReplayBlocked) {
+		t.Fatalf("delegate beyond its budget: got %v, want ErrReplayBlocked", err)
+	}
+
+	// The delegate's use counts against the root's max_uses of 3.
+	for i := 0; i < 2; i++ {
+		if _, err := b.Execute(readA, root); err != nil {
+			t.Fatalf("root use %d: %v", i+1, err)
+		}
+	}
+	if _, err := b.Execute(readA, root); !errors.Is(err, ErrReplayBlocked) {
+		t.Fatalf("root beyond its budget: got %v, want ErrReplayBlocked", err)
+	}
+}
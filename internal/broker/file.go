@@ -1,63 +1,416 @@
 package broker
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"securetalon/internal/core"
+	"securetalon/internal/policy"
+	"securetalon/internal/safefs"
 )
 
 const defaultMaxBytes = 1024 * 1024 // 1MB
 
-func (b *Broker) doFileRead(params map[string]interface{}, constraints map[string]interface{}) (map[string]interface{}, error) {
+// doFileRead returns the file, or the part of it selected by offset/length, tail_lines or
+// start_line/end_line (see readFileRange), as a UTF-8 string or, with encoding base64,
+// base64-encoded, together with the file's sniffed MIME type and the SHA-256 of the returned bytes.
+// Content that is not valid UTF-8 must be read as base64. A content_types constraint is checked
+// against the sniffed type. A max_bytes constraint bounds each read and, across the token's uses,
+// the total bytes read.
+func (b *Broker) doFileRead(params map[string]interface{}, constraints map[string]interface{}, token *core.CapabilityToken) (map[string]interface{}, error) {
 	path, _ := params["path"].(string)
 	if path == "" {
 		return nil, fmt.Errorf("path required")
 	}
+	encoding, _ := params["encoding"].(string)
+	if encoding == "" {
+		encoding = "utf8"
+	}
+	if encoding != "utf8" && encoding != "base64" {
+		return nil, fmt.Errorf("unknown encoding %q", encoding)
+	}
 	maxBytes := defaultMaxBytes
-	if m, ok := constraints["max_bytes"].(float64); ok && m > 0 {
+	m, ok := constraints["max_bytes"].(float64)
+	if ok && m > 0 {
 		maxBytes = int(m)
 	}
-	f, err := os.Open(filepath.Clean(path))
+	// Only an explicit max_bytes is a budget across the token's uses.
+	budget := ok && m > 0 && b.Nonces != nil
+	limit := maxBytes
+	if budget {
+		if limit = b.Nonces.Remaining(token, maxBytes); limit <= 0 {
+			return nil, fmt.Errorf("%w: read %d of max_bytes %d", ErrBudgetExhausted, maxBytes-limit, maxBytes)
+		}
+	}
+	f, err := openUnderRoots(path, constraints, os.O_RDONLY, 0)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	content, err := io.ReadAll(io.LimitReader(f, int64(maxBytes)+1))
+	r, err := readFileRange(f, params, limit)
 	if err != nil {
 		return nil, err
 	}
-	if len(content) > maxBytes {
-		return nil, fmt.Errorf("file exceeds max_bytes %d", maxBytes)
+	mime := sniffFile(f, r)
+	if err := checkContentType(mime, constraints); err != nil {
+		return nil, err
 	}
-	return map[string]interface{}{
-		"path":    path,
-		"content": string(content),
-		"bytes":   len(content),
-	}, nil
+	content := string(r.data)
+	if encoding == "base64" {
+		content = base64.StdEncoding.EncodeToString(r.data)
+	} else if !utf8.Valid(r.data) {
+		return nil, fmt.Errorf("%s is not valid UTF-8 (%s); read it with encoding base64", path, mime)
+	}
+	if budget {
+		if err := b.Nonces.Spend(token, len(r.data), maxBytes); err != nil {
+			return nil, fmt.Errorf("%w: max_bytes %d", err, maxBytes)
+		}
+	}
+	sum := sha256.Sum256(r.data)
+	out := map[string]interface{}{
+		"path":       path,
+		"content":    content,
+		"encoding":   encoding,
+		"bytes":      len(r.data),
+		"offset":     r.offset,
+		"total_size": r.total,
+		"has_more":   r.hasMore,
+		"mime":       mime,
+		"sha256":     hex.EncodeToString(sum[:]),
+	}
+	if r.startLine > 0 {
+		out["start_line"] = r.startLine
+		out["end_line"] = r.endLine
+	}
+	return out, nil
+}
+
+// checkContentType fails unless mime is allowed by the content_types constraint, if any.
+func checkContentType(mime string, constraints map[string]interface{}) error {
+	types, ok := constraints["content_types"]
+	if !ok {
+		return nil
+	}
+	if !policy.ContentTypeAllowed(mime, rootList(types)) {
+		return fmt.Errorf("content type %s not allowed by token", mime)
+	}
+	return nil
 }
 
+// ErrHashMismatch is returned by file.write when expected_sha256 does not match the current file.
+var ErrHashMismatch = errors.New("expected_sha256 does not match the current file")
+
+// doFileWrite writes content in one of policy.WriteModes, overwrite by default: overwrite and patch
+// (content is a unified diff) atomically replace the file via a temporary file and rename; append adds
+// to it; create_only fails if it exists. With expected_sha256 the write only happens if the current file has that hash
+// (compare-and-swap); writes through the broker are serialized so no other write lands in between.
 func (b *Broker) doFileWrite(params map[string]interface{}, constraints map[string]interface{}) (map[string]interface{}, error) {
 	path, _ := params["path"].(string)
-	content, _ := params["content"].(string)
 	if path == "" {
 		return nil, fmt.Errorf("path required")
 	}
+	data, err := policy.FileContent(params)
+	if err != nil {
+		return nil, err
+	}
+	mode, _ := params["mode"].(string)
+	if mode == "" {
+		mode = "overwrite"
+	}
+	if !policy.WriteModes[mode] {
+		return nil, fmt.Errorf("unknown write mode %q", mode)
+	}
+	if modes, ok := constraints["modes"]; ok && !policy.ContainsString(rootList(modes), mode) {
+		return nil, fmt.Errorf("write mode %s not allowed by token", mode)
+	}
 	maxBytes := defaultMaxBytes
 	if m, ok := constraints["max_bytes"].(float64); ok && m > 0 {
 		maxBytes = int(m)
 	}
-	if len(content) > maxBytes {
+	if len(data) > maxBytes {
 		return nil, fmt.Errorf("content exceeds max_bytes %d", maxBytes)
 	}
-	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil && !os.IsExist(err) {
+	// A patch is checked once applied, against the file it produces.
+	if mode != "patch" {
+		if err := checkContentType(http.DetectContentType(data), constraints); err != nil {
+			return nil, err
+		}
+	}
+	expected, _ := params["expected_sha256"].(string)
+
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	if expected != "" {
+		sum, err := hashUnderRoots(path, constraints)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s does not exist", ErrHashMismatch, path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(strings.TrimPrefix(expected, "sha256:"), sum) {
+			return nil, fmt.Errorf("%w: current sha256 is %s", ErrHashMismatch, sum)
+		}
+	}
+	switch mode {
+	case "overwrite":
+		err = safefs.WriteFile(path, rootList(constraints["roots"]), followSymlinks(constraints), data)
+	case "patch":
+		var cur []byte
+		if cur, err = readUnderRoots(path, constraints, maxBytes); err != nil {
+			return nil, err
+		}
+		patched, perr := applyPatch(string(cur), string(data))
+		if perr != nil {
+			return nil, perr
+		}
+		if len(patched) > maxBytes {
+			return nil, fmt.Errorf("patched file exceeds max_bytes %d", maxBytes)
+		}
+		data = []byte(patched)
+		if err := checkContentType(http.DetectContentType(data), constraints); err != nil {
+			return nil, err
+		}
+		err = safefs.WriteFile(path, rootList(constraints["roots"]), followSymlinks(constraints), data)
+	case "append":
+		err = writeUnderRoots(path, constraints, os.O_WRONLY|os.O_CREATE|os.O_APPEND, data)
+	case "create_only":
+		err = writeUnderRoots(path, constraints, os.O_WRONLY|os.O_CREATE|os.O_EXCL, data)
+		if errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("%s exists (mode create_only)", path)
+		}
+	}
+	if err != nil {
 		return nil, err
 	}
-	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+	sum, err := hashUnderRoots(path, constraints)
+	if err != nil {
 		return nil, err
 	}
 	return map[string]interface{}{
-		"path":  path,
-		"bytes": len(content),
+		"path":   path,
+		"mode":   mode,
+		"bytes":  len(data),
+		"mime":   http.DetectContentType(data),
+		"sha256": sum,
 	}, nil
 }
+
+// readUnderRoots reads at most limit bytes of path, failing if the file is larger.
+func readUnderRoots(path string, constraints map[string]interface{}, limit int) ([]byte, error) {
+	f, err := openUnderRoots(path, constraints, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	content, err := io.ReadAll(io.LimitReader(f, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > limit {
+		return nil, fmt.Errorf("file exceeds max_bytes %d", limit)
+	}
+	return content, nil
+}
+
+// writeUnderRoots opens path with flag (new files get 0600) and writes data.
+func writeUnderRoots(path string, constraints map[string]interface{}, flag int, data []byte) error {
+	f, err := openUnderRoots(path, constraints, flag, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// hashUnderRoots returns the hex SHA-256 of the file at path.
+func hashUnderRoots(path string, constraints map[string]interface{}) (string, error) {
+	f, err := openUnderRoots(path, constraints, os.O_RDONLY, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+const (
+	defaultMaxEntries = 1000 // file.list entries per call unless max_entries says otherwise
+	maxListDepth      = 32
+)
+
+// doFileList lists the directory path, descending depth levels (default 1, only the directory itself).
+// Symlinks are listed but never descended. At most max_entries entries are returned; truncated
+// reports whether more exist.
+func (b *Broker) doFileList(params map[string]interface{}, constraints map[string]interface{}) (map[string]interface{}, error) {
+	path, _ := params["path"].(string)
+	if path == "" {
+		return nil, fmt.Errorf("path required")
+	}
+	depth := 1
+	if d, ok := params["depth"].(float64); ok {
+		if d < 1 || d > maxListDepth {
+			return nil, fmt.Errorf("depth must be between 1 and %d", maxListDepth)
+		}
+		depth = int(d)
+	}
+	maxEntries, err := listLimit(params, constraints)
+	if err != nil {
+		return nil, err
+	}
+	roots, follow := rootList(constraints["roots"]), followSymlinks(constraints)
+	entries := []map[string]interface{}{}
+	truncated := false
+	var walk func(dir string, level int) error
+	walk = func(dir string, level int) error {
+		f, err := safefs.OpenDir(dir, roots, follow)
+		if err != nil {
+			return err
+		}
+		list, err := f.ReadDir(-1)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+		for _, d := range list {
+			if len(entries) >= maxEntries {
+				truncated = true
+				return nil
+			}
+			child := filepath.Join(dir, d.Name())
+			entry := map[string]interface{}{"path": child, "type": fileType(d.Type())}
+			if info, err := d.Info(); err == nil {
+				entry["size"] = info.Size()
+				entry["mod_time"] = info.ModTime().UTC().Format(time.RFC3339)
+			}
+			entries = append(entries, entry)
+			if d.IsDir() && level < depth {
+				if err := walk(child, level+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(path, 1); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"path":      path,
+		"depth":     depth,
+		"entries":   entries,
+		"count":     len(entries),
+		"truncated": truncated,
+	}, nil
+}
+
+// listLimit is the params' max_entries, defaulting to and bounded by the constraint's.
+func listLimit(params, constraints map[string]interface{}) (int, error) {
+	limit := defaultMaxEntries
+	if m, ok := constraints["max_entries"].(float64); ok && m > 0 {
+		limit = int(m)
+	}
+	if m, ok := params["max_entries"].(float64); ok {
+		if m < 1 || int(m) > limit {
+			return 0, fmt.Errorf("max_entries must be between 1 and %d", limit)
+		}
+		limit = int(m)
+	}
+	return limit, nil
+}
+
+// doFileStat describes path without following a symlink in its last component.
+func (b *Broker) doFileStat(params map[string]interface{}, constraints map[string]interface{}) (map[string]interface{}, error) {
+	path, _ := params["path"].(string)
+	if path == "" {
+		return nil, fmt.Errorf("path required")
+	}
+	info, err := safefs.Lstat(path, rootList(constraints["roots"]), followSymlinks(constraints))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"path":     path,
+		"type":     fileType(info.Mode().Type()),
+		"size":     info.Size(),
+		"mode":     fmt.Sprintf("%04o", info.Mode().Perm()),
+		"mod_time": info.ModTime().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// doFileDelete removes a file, a symlink (not its target) or an empty directory.
+func (b *Broker) doFileDelete(params map[string]interface{}, constraints map[string]interface{}) (map[string]interface{}, error) {
+	path, _ := params["path"].(string)
+	if path == "" {
+		return nil, fmt.Errorf("path required")
+	}
+	roots, follow := rootList(constraints["roots"]), followSymlinks(constraints)
+	info, err := safefs.Lstat(path, roots, follow)
+	if err != nil {
+		return nil, err
+	}
+	if err := safefs.Remove(path, roots, follow); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"path":    path,
+		"type":    fileType(info.Mode().Type()),
+		"deleted": true,
+	}, nil
+}
+
+// doFileMove renames path to dest. An existing dest is only replaced with overwrite=true.
+func (b *Broker) doFileMove(params map[string]interface{}, constraints map[string]interface{}) (map[string]interface{}, error) {
+	path, _ := params["path"].(string)
+	dest, _ := params["dest"].(string)
+	if path == "" || dest == "" {
+		return nil, fmt.Errorf("path and dest required")
+	}
+	roots, follow := rootList(constraints["roots"]), followSymlinks(constraints)
+	if overwrite, _ := params["overwrite"].(bool); !overwrite {
+		if _, err := safefs.Lstat(dest, roots, follow); err == nil {
+			return nil, fmt.Errorf("dest %s exists (set overwrite to replace it)", dest)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if err := safefs.Rename(path, dest, roots, follow); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"path": path,
+		"dest": dest,
+	}, nil
+}
+
+// fileType names a file mode type for tool results: file, dir, symlink or other.
+func fileType(mode fs.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "file"
+	case mode.IsDir():
+		return "dir"
+	case mode&fs.ModeSymlink != 0:
+		return "symlink"
+	}
+	return "other"
+}
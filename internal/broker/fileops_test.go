@@ -0,0 +1,343 @@
+package broker
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"securetalon/internal/core"
+	"securetalon/internal/policy"
+)
+
+func (s *fileSandbox) run(tool string, params, extra map[string]interface{}) (map[string]interface{}, error) {
+	constraints := map[string]interface{}{"roots": []interface{}{s.root}}
+	for k, v := range extra {
+		constraints[k] = v
+	}
+	tok, err := s.issuer.Issue("sess_1", "agent", tool, constraints, 60)
+	if err != nil {
+		return nil, err
+	}
+	return s.broker.Execute(core.ToolIntent{Tool: tool, Params: params}, tok)
+}
+
+func entryPaths(out map[string]interface{}) []string {
+	var paths []string
+	for _, e := range out["entries"].([]map[string]interface{}) {
+		paths = append(paths, e["path"].(string))
+	}
+	return paths
+}
+
+func TestFileListDepthAndLimits(t *testing.T) {
+	s := newFileSandbox(t)
+	mustWrite(t, filepath.Join(s.root, "a.txt"), "a")
+
+	out, err := s.run("file.list", map[string]interface{}{"path": s.root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := entryPaths(out); len(got) != 2 || got[0] != filepath.Join(s.root, "a.txt") || got[1] != filepath.Join(s.root, "sub") {
+		t.Fatalf("depth 1 = %v", got)
+	}
+	out, err = s.run("file.list", map[string]interface{}{"path": s.root, "depth": float64(2)}, nil)
+	if err != nil || len(entryPaths(out)) != 3 || out["truncated"] != false {
+		t.Fatalf("depth 2 = %v, %v", out, err)
+	}
+	out, err = s.run("file.list", map[string]interface{}{"path": s.root, "depth": float64(2)}, map[string]interface{}{"max_entries": float64(2)})
+	if err != nil || len(entryPaths(out)) != 2 || out["truncated"] != true {
+		t.Fatalf("max_entries 2 = %v, %v", out, err)
+	}
+	if _, err := s.run("file.list", map[string]interface{}{"path": s.root, "max_entries": float64(5)}, map[string]interface{}{"max_entries": float64(2)}); err == nil {
+		t.Fatal("expected error for max_entries above the constraint")
+	}
+	if _, err := s.run("file.list", map[string]interface{}{"path": s.base}, nil); err == nil {
+		t.Fatal("listed the root's parent")
+	}
+}
+
+func TestFileListDoesNotFollowSymlinks(t *testing.T) {
+	s := newFileSandbox(t)
+	mustSymlink(t, s.base, filepath.Join(s.root, "escape"))
+	out, err := s.run("file.list", map[string]interface{}{"path": s.root, "depth": float64(3)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range out["entries"].([]map[string]interface{}) {
+		if e["path"] == filepath.Join(s.root, "escape") && e["type"] != "symlink" {
+			t.Errorf("escape listed as %v", e["type"])
+		}
+		if e["path"] == filepath.Join(s.root, "escape", "secret.txt") {
+			t.Error("listing descended into a symlink")
+		}
+	}
+	if _, err := s.run("file.list", map[string]interface{}{"path": filepath.Join(s.root, "escape")}, nil); !errors.Is(err, ErrSymlink) {
+		t.Fatalf("list through a symlink: got %v, want ErrSymlink", err)
+	}
+}
+
+func TestFileStatDeleteMove(t *testing.T) {
+	s := newFileSandbox(t)
+	ok := filepath.Join(s.root, "sub", "ok.txt")
+
+	out, err := s.run("file.stat", map[string]interface{}{"path": ok}, nil)
+	if err != nil || out["type"] != "file" || out["size"] != int64(4) {
+		t.Fatalf("stat = %v, %v", out, err)
+	}
+	if out, err := s.run("file.stat", map[string]interface{}{"path": s.root}, nil); err != nil || out["type"] != "dir" {
+		t.Fatalf("stat root = %v, %v", out, err)
+	}
+
+	moved := filepath.Join(s.root, "new", "moved.txt")
+	if _, err := s.run("file.move", map[string]interface{}{"path": ok, "dest": moved}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(moved); string(b) != "fine" {
+		t.Fatalf("moved content = %q", b)
+	}
+	mustWrite(t, ok, "again")
+	if _, err := s.run("file.move", map[string]interface{}{"path": ok, "dest": moved}, nil); err == nil {
+		t.Fatal("move replaced an existing file without overwrite")
+	}
+	if _, err := s.run("file.move", map[string]interface{}{"path": ok, "dest": moved, "overwrite": true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.run("file.move", map[string]interface{}{"path": moved, "dest": s.secret, "overwrite": true}, nil); err == nil {
+		t.Fatal("moved a file out of the root")
+	}
+
+	if _, err := s.run("file.delete", map[string]interface{}{"path": moved}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(moved); !os.IsNotExist(err) {
+		t.Fatal("file still exists after delete")
+	}
+	if _, err := s.run("file.delete", map[string]interface{}{"path": filepath.Join(s.root, "new")}, nil); err != nil {
+		t.Fatalf("delete empty directory: %v", err)
+	}
+	if _, err := s.run("file.delete", map[string]interface{}{"path": s.root}, nil); err == nil {
+		t.Fatal("deleted the root")
+	}
+}
+
+func TestFileDeleteRemovesSymlinkNotTarget(t *testing.T) {
+	s := newFileSandbox(t)
+	link := filepath.Join(s.root, "leak.txt")
+	mustSymlink(t, s.secret, link)
+	for _, extra := range []map[string]interface{}{nil, {"follow_symlinks": true}} {
+		out, err := s.run("file.stat", map[string]interface{}{"path": link}, extra)
+		if err != nil || out["type"] != "symlink" {
+			t.Fatalf("stat symlink = %v, %v", out, err)
+		}
+	}
+	if _, err := s.run("file.delete", map[string]interface{}{"path": link}, map[string]interface{}{"follow_symlinks": true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(link); !os.IsNotExist(err) {
+		t.Fatal("symlink still exists")
+	}
+	if b, _ := os.ReadFile(s.secret); string(b) != "TOP SECRET" {
+		t.Fatalf("symlink target was modified: %q", b)
+	}
+}
+
+func TestFileWriteModes(t *testing.T) {
+	s := newFileSandbox(t)
+	path := filepath.Join(s.root, "notes.txt")
+	write := func(params map[string]interface{}, extra map[string]interface{}) (map[string]interface{}, error) {
+		params["path"] = path
+		return s.run("file.write", params, extra)
+	}
+
+	if _, err := write(map[string]interface{}{"content": "a\n", "mode": "create_only"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := write(map[string]interface{}{"content": "x\n", "mode": "create_only"}, nil); err == nil {
+		t.Fatal("create_only replaced an existing file")
+	}
+	out, err := write(map[string]interface{}{"content": "b\n", "mode": "append"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := out["sha256"].(string)
+	if _, err := write(map[string]interface{}{"content": "@@ -2 +2 @@\n-b\n+B\n", "mode": "patch", "expected_sha256": sum}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "a\nB\n" {
+		t.Fatalf("content = %q", b)
+	}
+	// The hash is stale now: compare-and-swap fails and the file is left alone.
+	if _, err := write(map[string]interface{}{"content": "lost update", "expected_sha256": sum}, nil); !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("stale expected_sha256: got %v, want ErrHashMismatch", err)
+	}
+	if _, err := write(map[string]interface{}{"content": "new"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "new" {
+		t.Fatalf("content = %q", b)
+	}
+	if _, err := write(map[string]interface{}{"content": "x", "mode": "truncate"}, nil); err == nil {
+		t.Fatal("expected error for an unknown mode")
+	}
+	if _, err := write(map[string]interface{}{"content": "x"}, map[string]interface{}{"modes": []interface{}{"append"}}); err == nil {
+		t.Fatal("overwrite allowed by a token restricted to append")
+	}
+	matches, _ := filepath.Glob(filepath.Join(s.root, ".notes.txt.tmp-*"))
+	if len(matches) != 0 {
+		t.Fatalf("temporary files left behind: %v", matches)
+	}
+}
+
+func TestFileWriteOverwriteKeepsPermissions(t *testing.T) {
+	s := newFileSandbox(t)
+	path := filepath.Join(s.root, "script.sh")
+	if err := os.WriteFile(path, []byte("old"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.run("file.write", map[string]interface{}{"path": path, "content": "new"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode().Perm() != 0750 {
+		t.Fatalf("mode after overwrite = %v, %v", fi.Mode(), err)
+	}
+}
+
+func TestFileBinaryContent(t *testing.T) {
+	s := newFileSandbox(t)
+	path := filepath.Join(s.root, "pixel.png")
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\xff\xfe")
+	encoded := base64.StdEncoding.EncodeToString(png)
+
+	out, err := s.run("file.write", map[string]interface{}{"path": path, "content": encoded, "encoding": "base64"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["bytes"] != len(png) || out["mime"] != "image/png" {
+		t.Fatalf("write result = %v", out)
+	}
+	if b, _ := os.ReadFile(path); string(b) != string(png) {
+		t.Fatalf("file = %q", b)
+	}
+	if _, err := s.run("file.read", map[string]interface{}{"path": path}, nil); err == nil || !strings.Contains(err.Error(), "base64") {
+		t.Fatalf("utf8 read of binary file: got %v", err)
+	}
+	out, err = s.run("file.read", map[string]interface{}{"path": path, "encoding": "base64"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(png)
+	if out["content"] != encoded || out["mime"] != "image/png" || out["sha256"] != hex.EncodeToString(sum[:]) {
+		t.Fatalf("read result = %v", out)
+	}
+	if _, err := s.run("file.write", map[string]interface{}{"path": path, "content": "not base64!", "encoding": "base64"}, nil); err == nil {
+		t.Fatal("wrote invalid base64")
+	}
+}
+
+func TestFileContentTypeAndExtensionConstraints(t *testing.T) {
+	s := newFileSandbox(t)
+	textOnly := map[string]interface{}{"content_types": []interface{}{"text/*"}, "extensions": []interface{}{".txt", ".md"}}
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+
+	if _, err := s.run("file.write", map[string]interface{}{"path": filepath.Join(s.root, "notes.md"), "content": "# notes\n"}, textOnly); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.run("file.write", map[string]interface{}{"path": filepath.Join(s.root, "notes.txt"), "content": png, "encoding": "base64"}, textOnly); err == nil || !strings.Contains(err.Error(), "content type image/png") {
+		t.Fatalf("png under text/*: got %v", err)
+	}
+	if _, err := s.run("file.write", map[string]interface{}{"path": filepath.Join(s.root, "run.sh"), "content": "echo hi\n"}, textOnly); err == nil || !strings.Contains(err.Error(), "extension") {
+		t.Fatalf(".sh under [.txt .md]: got %v", err)
+	}
+	// The sniffed type is checked on read too, whatever the extension says.
+	mustWrite(t, filepath.Join(s.root, "fake.txt"), "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	if _, err := s.run("file.read", map[string]interface{}{"path": filepath.Join(s.root, "fake.txt"), "encoding": "base64"}, textOnly); err == nil {
+		t.Fatal("read a png disguised as .txt")
+	}
+}
+
+func TestFileReadRanges(t *testing.T) {
+	s := newFileSandbox(t)
+	path := filepath.Join(s.root, "app.log")
+	mustWrite(t, path, "one\ntwo\nthree\nfour\nfive\n")
+	read := func(params, extra map[string]interface{}) map[string]interface{} {
+		t.Helper()
+		params["path"] = path
+		out, err := s.run("file.read", params, extra)
+		if err != nil {
+			t.Fatalf("%v: %v", params, err)
+		}
+		return out
+	}
+
+	out := read(map[string]interface{}{"offset": float64(4), "length": float64(5)}, nil)
+	if out["content"] != "two\nt" || out["offset"] != int64(4) || out["total_size"] != int64(24) || out["has_more"] != true {
+		t.Fatalf("offset/length = %v", out)
+	}
+	out = read(map[string]interface{}{"tail_lines": float64(2)}, nil)
+	if out["content"] != "four\nfive\n" || out["offset"] != int64(14) || out["has_more"] != true {
+		t.Fatalf("tail_lines = %v", out)
+	}
+	out = read(map[string]interface{}{"tail_lines": float64(10)}, nil)
+	if out["content"] != "one\ntwo\nthree\nfour\nfive\n" || out["has_more"] != false {
+		t.Fatalf("tail_lines past the start = %v", out)
+	}
+	out = read(map[string]interface{}{"start_line": float64(2), "end_line": float64(3)}, nil)
+	if out["content"] != "two\nthree\n" || out["start_line"] != 2 || out["end_line"] != 3 || out["has_more"] != true {
+		t.Fatalf("line range = %v", out)
+	}
+	// Line reads stop at the last whole line that fits in max_bytes.
+	out = read(map[string]interface{}{"start_line": float64(3)}, map[string]interface{}{"max_bytes": float64(12)})
+	if out["content"] != "three\nfour\n" || out["end_line"] != 4 || out["has_more"] != true {
+		t.Fatalf("line range under max_bytes = %v", out)
+	}
+	out = read(map[string]interface{}{"tail_lines": float64(3)}, map[string]interface{}{"max_bytes": float64(12)})
+	if out["content"] != "four\nfive\n" || out["has_more"] != true {
+		t.Fatalf("tail under max_bytes = %v", out)
+	}
+
+	if _, err := s.run("file.read", map[string]interface{}{"path": path}, map[string]interface{}{"max_bytes": float64(10)}); err == nil || !strings.Contains(err.Error(), "offset/length") {
+		t.Fatalf("whole read over max_bytes: got %v", err)
+	}
+	if _, err := s.run("file.read", map[string]interface{}{"path": path, "length": float64(11)}, map[string]interface{}{"max_bytes": float64(10)}); err == nil {
+		t.Fatal("length above max_bytes accepted")
+	}
+	if _, err := s.run("file.read", map[string]interface{}{"path": path, "offset": float64(1), "tail_lines": float64(1)}, nil); err == nil {
+		t.Fatal("offset and tail_lines accepted together")
+	}
+}
+
+func TestFileReadBudgetSpansTokenUses(t *testing.T) {
+	s := newFileSandbox(t)
+	path := filepath.Join(s.root, "big.csv")
+	mustWrite(t, path, strings.Repeat("a,b,c\n", 10))
+	tok, err := s.issuer.IssueGrant(policy.Grant{
+		SessionID: "sess_1", Subject: "agent", Tool: "file.read", TTLSeconds: 60, MaxUses: 5,
+		Constraints: map[string]interface{}{"roots": []interface{}{s.root}, "max_bytes": float64(16)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(offset, length int) (map[string]interface{}, error) {
+		params := map[string]interface{}{"path": path, "offset": float64(offset), "length": float64(length)}
+		return s.broker.Execute(core.ToolIntent{Tool: "file.read", Params: params}, tok)
+	}
+	if _, err := read(0, 12); err != nil {
+		t.Fatal(err)
+	}
+	// 4 of the 16 bytes are left.
+	if _, err := read(12, 6); err == nil {
+		t.Fatal("read past the token's budget")
+	}
+	if out, err := read(12, 4); err != nil || out["bytes"] != 4 {
+		t.Fatalf("read the rest of the budget: %v, %v", out, err)
+	}
+	if _, err := read(16, 1); !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("exhausted budget: got %v, want ErrBudgetExhausted", err)
+	}
+}
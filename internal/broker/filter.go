@@ -0,0 +1,259 @@
+package broker
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"securetalon/internal/core"
+	"securetalon/internal/policy"
+)
+
+// ErrOutputBlocked is returned by Execute when an output filter withholds a tool's result.
+var ErrOutputBlocked = errors.New("tool output blocked")
+
+// OutputFilter inspects text a tool returns before it leaves the broker. It returns the text to
+// release, rewritten as needed, and the number of findings per detector; an error (wrapping
+// ErrOutputBlocked) withholds the whole result.
+type OutputFilter interface {
+	Filter(tool, text string) (string, map[string]int, error)
+}
+
+// filteredOutputs are the result fields passed through the broker's Filters, per tool.
+var filteredOutputs = map[string][]string{
+	"file.read":  {"content"},
+	"http.fetch": {"body"},
+	"docker.run": {"stdout", "stderr"},
+}
+
+// detector is one pattern of the Redactor with its action.
+type detector struct {
+	name   string
+	re     *regexp.Regexp
+	action string
+	tools  []string
+}
+
+// builtinDetectors are the Redactor's default detectors, in the order they run. Private keys go
+// first so their base64 body is not picked apart by the token patterns.
+var builtinDetectors = []detector{
+	{name: "pem", action: "redact", re: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY-----`)},
+	{name: "jwt", action: "redact", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{4,}\.[A-Za-z0-9_-]{4,}\.[A-Za-z0-9_-]{8,}`)},
+	{name: "secrets", action: "redact", re: regexp.MustCompile(`\b(?:` +
+		`AKIA[0-9A-Z]{16}` + // AWS access key ID
+		`|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}` + // GitHub
+		`|xox[abposr]-[A-Za-z0-9-]{10,}` + // Slack
+		`|[sr]k_(?:live|test)_[A-Za-z0-9]{16,}` + // Stripe
+		`|AIza[0-9A-Za-z_-]{35}` + // Google API key
+		`|sk-[A-Za-z0-9_-]{20,}` + // OpenAI-style API keys
+		`)`)},
+	{name: "email", action: "mask", re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+}
+
+// Redactor is the built-in OutputFilter. It runs the builtinDetectors and the custom patterns of the
+// redaction rules returned by Rules (policy.Engine.RedactionRules; nil means the defaults), and for
+// each finding takes its detector's action: redact replaces it with [REDACTED:<name>], mask keeps
+// only its last 4 characters, block withholds the output. Block rules are checked before anything is
+// rewritten.
+type Redactor struct {
+	Rules func() []policy.RedactionRule
+
+	patterns sync.Map // custom pattern -> *regexp.Regexp
+}
+
+// Filter implements OutputFilter.
+func (r *Redactor) Filter(tool, text string) (string, map[string]int, error) {
+	detectors, err := r.detectors()
+	if err != nil {
+		return "", nil, err
+	}
+	counts := map[string]int{}
+	for _, d := range detectors {
+		if d.action == "block" && appliesTo(d, tool) && d.re.MatchString(text) {
+			counts[d.name] = len(d.re.FindAllStringIndex(text, -1))
+			return "", counts, fmt.Errorf("%w: %s output matched redaction rule %s", ErrOutputBlocked, tool, d.name)
+		}
+	}
+	for _, d := range detectors {
+		if d.action == "block" || d.action == "off" || !appliesTo(d, tool) {
+			continue
+		}
+		n := 0
+		text = d.re.ReplaceAllStringFunc(text, func(m string) string {
+			n++
+			if d.action == "mask" {
+				return mask(m)
+			}
+			return "[REDACTED:" + d.name + "]"
+		})
+		if n > 0 {
+			counts[d.name] = n
+		}
+	}
+	return text, counts, nil
+}
+
+// detectors returns the built-in detectors with their configured actions, followed by the custom
+// ones.
+func (r *Redactor) detectors() ([]detector, error) {
+	var rules []policy.RedactionRule
+	if r.Rules != nil {
+		rules = r.Rules()
+	}
+	out := append([]detector(nil), builtinDetectors...)
+	for _, rule := range rules {
+		if rule.Pattern == "" {
+			for i := range out {
+				if out[i].name == rule.Name {
+					out[i].action, out[i].tools = rule.Action, rule.Tools
+				}
+			}
+			continue
+		}
+		re, err := r.compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %s: %w", rule.Name, err)
+		}
+		out = append(out, detector{name: rule.Name, re: re, action: rule.Action, tools: rule.Tools})
+	}
+	return out, nil
+}
+
+func (r *Redactor) compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := r.patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	r.patterns.Store(pattern, re)
+	return re, nil
+}
+
+func appliesTo(d detector, tool string) bool {
+	return len(d.tools) == 0 || policy.ContainsString(d.tools, tool)
+}
+
+// mask replaces all but the last 4 characters of s with '*', or all of them when s is 8 characters
+// or shorter.
+func mask(s string) string {
+	runes := []rune(s)
+	keep := 4
+	if len(runes) <= 8 {
+		keep = 0
+	}
+	return strings.Repeat("*", len(runes)-keep) + string(runes[len(runes)-keep:])
+}
+
+// filterOutput passes the tool's filteredOutputs fields of result through b.Filters. Base64 file
+// content is filtered decoded. Text that a filter rewrote replaces the field, with its length added as
+// "redacted_bytes" and the result's "sha256" recomputed for it; "bytes" keeps counting what was read,
+// so offset+bytes still continues a ranged read. Content of a non-text MIME type (see isTextMIME) is only
+// scanned, as rewriting it would corrupt the file, and any finding in it withholds the result. When
+// anything was found the counts are added to the result as "redactions" and audited as
+// output.redacted; a withheld result is audited as output.blocked.
+func (b *Broker) filterOutput(token *core.CapabilityToken, tool string, result map[string]interface{}) (map[string]interface{}, error) {
+	fields := filteredOutputs[tool]
+	if len(b.Filters) == 0 || len(fields) == 0 || result == nil {
+		return result, nil
+	}
+	mime, _ := result["mime"].(string)
+	binary := mime != "" && !isTextMIME(mime)
+	counts := map[string]int{}
+	for _, field := range fields {
+		text, ok := result[field].(string)
+		if !ok {
+			continue
+		}
+		encoded := result["encoding"] == "base64"
+		if encoded {
+			raw, err := base64.StdEncoding.DecodeString(text)
+			if err != nil {
+				return nil, err
+			}
+			text = string(raw)
+		}
+		released := text
+		for _, f := range b.Filters {
+			out, found, err := f.Filter(tool, released)
+			for name, n := range found {
+				counts[name] += n
+			}
+			if errors.Is(err, ErrOutputBlocked) {
+				b.emitOutputEvent(token, "output.blocked", tool, counts)
+				return nil, err
+			}
+			if err != nil {
+				return nil, fmt.Errorf("filter %s output: %w", tool, err)
+			}
+			released = out
+		}
+		if released == text {
+			continue
+		}
+		if binary {
+			b.emitOutputEvent(token, "output.blocked", tool, counts)
+			return nil, fmt.Errorf("%w: %s output of type %s has findings and cannot be redacted", ErrOutputBlocked, tool, mime)
+		}
+		if _, ok := result["bytes"]; ok {
+			result["redacted_bytes"] = len(released)
+		}
+		if _, ok := result["sha256"]; ok {
+			sum := sha256.Sum256([]byte(released))
+			result["sha256"] = hex.EncodeToString(sum[:])
+		}
+		if encoded {
+			released = base64.StdEncoding.EncodeToString([]byte(released))
+		}
+		result[field] = released
+	}
+	if len(counts) > 0 {
+		result["redactions"] = counts
+		b.emitOutputEvent(token, "output.redacted", tool, counts)
+	}
+	return result, nil
+}
+
+// isTextMIME reports whether content of a sniffed MIME type is text that filters may rewrite:
+// text/*, JSON, XML and JavaScript.
+func isTextMIME(mime string) bool {
+	mime, _, _ = strings.Cut(mime, ";")
+	mime = strings.ToLower(strings.TrimSpace(mime))
+	switch {
+	case strings.HasPrefix(mime, "text/"), strings.HasSuffix(mime, "+json"), strings.HasSuffix(mime, "+xml"):
+		return true
+	}
+	switch mime {
+	case "application/json", "application/xml", "application/javascript", "application/x-yaml", "application/yaml":
+		return true
+	}
+	return false
+}
+
+// emitOutputEvent records the findings of the output filters for a token's result.
+func (b *Broker) emitOutputEvent(token *core.CapabilityToken, evType, tool string, counts map[string]int) {
+	if b.AuditStore == nil {
+		return
+	}
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	ev := &core.AuditEvent{
+		SessionID: token.SessionID,
+		Type:      evType,
+		Data: map[string]interface{}{
+			"cap_id":     token.CapID,
+			"tool":       tool,
+			"redactions": counts,
+			"total":      total,
+		},
+	}
+	_ = b.AuditStore.Append(ev)
+}
@@ -21,6 +21,9 @@ func (b *Broker) doHTTPFetch(params map[string]interface{}, constraints map[stri
 	if domains != nil && !domainAllowed(urlStr, domains) {
 		return nil, fmt.Errorf("url domain not in allowlist")
 	}
+	if forbidden := constraints["forbidden_domains"]; forbidden != nil && domainAllowed(urlStr, forbidden) {
+		return nil, fmt.Errorf("url domain forbidden by policy")
+	}
 	methods, _ := constraints["methods"].([]interface{})
 	if len(methods) > 0 && !methodAllowed(method, methods) {
 		return nil, fmt.Errorf("method %s not in allowlist", method)
@@ -0,0 +1,136 @@
+package broker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"securetalon/internal/core"
+)
+
+// ErrReplayBlocked is returned by Execute when a token's nonce has already been used max_uses times.
+var ErrReplayBlocked = errors.New("capability token replay blocked")
+
+// ErrBudgetExhausted is returned by file.read when a token has already read its max_bytes.
+var ErrBudgetExhausted = errors.New("capability token read budget exhausted")
+
+// NonceStore records how often each token nonce has been used and how many bytes file.read has
+// returned under it, so max_bytes is a budget across all of a token's uses. Entries are dropped once the token
+// expires (plus Leeway, matching the verifier's clock-skew tolerance), so the store is bounded by the
+// tokens issued within one TTL. It is in memory: a restart forgets used nonces, which is acceptable
+// because tokens live for seconds.
+type NonceStore struct {
+	Leeway time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*nonceEntry
+	now     func() time.Time
+}
+
+type nonceEntry struct {
+	uses  int
+	bytes int // read so far (see Spend)
+	exp   int64
+}
+
+// NewNonceStore returns an empty nonce store.
+func NewNonceStore() *NonceStore {
+	return &NonceStore{entries: make(map[string]*nonceEntry), now: time.Now}
+}
+
+// Use records one use of the token's nonce and, for a delegated token, of every caveat with its own
+// max_uses, so a delegate's budget is spent within each parent's. It returns the uses including this
+// one and the limit of the budget with the fewest uses left, or ErrReplayBlocked (recording nothing)
+// with the uses and limit of a budget that has none left.
+func (s *NonceStore) Use(tok *core.CapabilityToken) (uses, limit int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now().UTC().Unix() - int64(s.Leeway/time.Second)
+	for n, e := range s.entries {
+		if e.exp < now {
+			delete(s.entries, n)
+		}
+	}
+	entries, limits := []*nonceEntry{s.entry(tok)}, []int{maxUses(tok)}
+	for _, c := range tok.Caveats {
+		if c.MaxUses > 0 {
+			entries = append(entries, s.caveatEntry(tok, c))
+			limits = append(limits, c.MaxUses)
+		}
+	}
+	for i, e := range entries {
+		if e.uses >= limits[i] {
+			return e.uses, limits[i], ErrReplayBlocked
+		}
+	}
+	tightest := 0
+	for i, e := range entries {
+		e.uses++
+		if limits[i]-e.uses < limits[tightest]-entries[tightest].uses {
+			tightest = i
+		}
+	}
+	return entries[tightest].uses, limits[tightest], nil
+}
+
+// Remaining returns how many bytes the token may still read out of a budget of limit.
+func (s *NonceStore) Remaining(tok *core.CapabilityToken, limit int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return limit - s.entry(tok).bytes
+}
+
+// Spend records n bytes read under the token. It returns ErrBudgetExhausted (and records nothing)
+// when that would take the token past limit, e.g. when concurrent uses raced for the same budget.
+func (s *NonceStore) Spend(tok *core.CapabilityToken, n, limit int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entry(tok)
+	if e.bytes+n > limit {
+		return ErrBudgetExhausted
+	}
+	e.bytes += n
+	return nil
+}
+
+// entry returns the token's entry, creating it if missing. s.mu must be held.
+func (s *NonceStore) entry(tok *core.CapabilityToken) *nonceEntry {
+	key := tok.Nonce
+	if key == "" {
+		key = tok.CapID
+	}
+	e, ok := s.entries[key]
+	if !ok {
+		e = &nonceEntry{exp: tok.Exp}
+		s.entries[key] = e
+	}
+	return e
+}
+
+// caveatEntry returns the use count of a caveat's own budget, creating it if missing. s.mu must be held.
+func (s *NonceStore) caveatEntry(tok *core.CapabilityToken, c core.Caveat) *nonceEntry {
+	key := "caveat:" + c.CapID
+	e, ok := s.entries[key]
+	if !ok {
+		e = &nonceEntry{exp: tok.Exp}
+		if c.Exp != 0 {
+			e.exp = c.Exp
+		}
+		s.entries[key] = e
+	}
+	return e
+}
+
+// Len returns the number of tracked nonces.
+func (s *NonceStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+func maxUses(tok *core.CapabilityToken) int {
+	if tok.MaxUses > 1 {
+		return tok.MaxUses
+	}
+	return 1
+}
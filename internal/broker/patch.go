@@ -0,0 +1,150 @@
+package broker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// hunk is one "@@ -start,count +start,count @@" section of a unified diff.
+type hunk struct {
+	oldStart, oldLines int
+	newLines           int
+	lines              []diffLine
+}
+
+// diffLine is a context (' '), removed ('-') or added ('+') line, with its newline unless the diff
+// marks it "\ No newline at end of file".
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// applyPatch applies a single-file unified diff to orig. Hunks must apply exactly where they say
+// (shifted by the line count changes of the hunks before them); no fuzz is allowed.
+func applyPatch(orig, diff string) (string, error) {
+	hunks, err := parseUnifiedDiff(diff)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.SplitAfter(orig, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var out []string
+	pos := 0
+	for i, h := range hunks {
+		start := h.oldStart - 1
+		if h.oldLines == 0 {
+			start = h.oldStart // pure insertion after line oldStart
+		}
+		if start < pos || start > len(lines) {
+			return "", fmt.Errorf("patch hunk %d: line %d out of range", i+1, h.oldStart)
+		}
+		out = append(out, lines[pos:start]...)
+		pos = start
+		for _, l := range h.lines {
+			switch l.op {
+			case ' ', '-':
+				if pos >= len(lines) || lines[pos] != l.text {
+					return "", fmt.Errorf("patch hunk %d does not apply at line %d", i+1, pos+1)
+				}
+				if l.op == ' ' {
+					out = append(out, l.text)
+				}
+				pos++
+			case '+':
+				out = append(out, l.text)
+			}
+		}
+	}
+	out = append(out, lines[pos:]...)
+	return strings.Join(out, ""), nil
+}
+
+// parseUnifiedDiff parses the hunks of a unified diff. File headers (---/+++ and git's diff/index
+// lines) before the first hunk are skipped; a second file header is an error.
+func parseUnifiedDiff(diff string) ([]hunk, error) {
+	var hunks []hunk
+	var cur *hunk
+	oldSeen, newSeen := 0, 0
+	raw := strings.SplitAfter(diff, "\n")
+	for n, line := range raw {
+		text := strings.TrimSuffix(line, "\n")
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(text, `\`) {
+			// "\ No newline at end of file" applies to the line before it (see below)
+			continue
+		}
+		if cur != nil && (oldSeen < cur.oldLines || newSeen < cur.newLines) {
+			op := byte(' ')
+			body := ""
+			if text != "" {
+				op, body = text[0], text[1:]
+			}
+			if op != ' ' && op != '-' && op != '+' {
+				return nil, fmt.Errorf("patch line %d: unexpected %q in hunk", n+1, text)
+			}
+			if op != '-' {
+				newSeen++
+			}
+			if op != '+' {
+				oldSeen++
+			}
+			if n+1 >= len(raw) || !strings.HasPrefix(raw[n+1], `\`) {
+				body += "\n"
+			}
+			cur.lines = append(cur.lines, diffLine{op: op, text: body})
+			continue
+		}
+		switch {
+		case strings.HasPrefix(text, "@@"):
+			h, err := parseHunkHeader(text)
+			if err != nil {
+				return nil, fmt.Errorf("patch line %d: %w", n+1, err)
+			}
+			hunks = append(hunks, h)
+			cur = &hunks[len(hunks)-1]
+			oldSeen, newSeen = 0, 0
+		case strings.HasPrefix(text, "--- ") && len(hunks) > 0:
+			return nil, fmt.Errorf("patch line %d: patches for more than one file are not supported", n+1)
+		}
+	}
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("patch has no hunks")
+	}
+	if oldSeen < cur.oldLines || newSeen < cur.newLines {
+		return nil, fmt.Errorf("patch hunk %d is truncated", len(hunks))
+	}
+	return hunks, nil
+}
+
+// parseHunkHeader parses "@@ -l[,s] +l[,s] @@ ...".
+func parseHunkHeader(text string) (hunk, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 4 || fields[0] != "@@" || fields[3] != "@@" || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return hunk{}, fmt.Errorf("invalid hunk header %q", text)
+	}
+	oldStart, oldLines, err1 := parseRange(fields[1][1:])
+	_, newLines, err2 := parseRange(fields[2][1:])
+	if err1 != nil || err2 != nil {
+		return hunk{}, fmt.Errorf("invalid hunk header %q", text)
+	}
+	return hunk{oldStart: oldStart, oldLines: oldLines, newLines: newLines}, nil
+}
+
+func parseRange(s string) (start, count int, err error) {
+	count = 1
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		if count, err = strconv.Atoi(s[i+1:]); err != nil {
+			return 0, 0, err
+		}
+		s = s[:i]
+	}
+	if start, err = strconv.Atoi(s); err != nil || start < 0 || count < 0 {
+		return 0, 0, fmt.Errorf("invalid range")
+	}
+	return start, count, nil
+}
@@ -0,0 +1,40 @@
+package broker
+
+import "testing"
+
+func TestApplyPatch(t *testing.T) {
+	orig := "one\ntwo\nthree\nfour\nfive\n"
+	cases := []struct {
+		name, diff, want string
+	}{
+		{"replace", "--- a/f.txt\n+++ b/f.txt\n@@ -2,2 +2,2 @@\n two\n-three\n+THREE\n", "one\ntwo\nTHREE\nfour\nfive\n"},
+		{"two hunks", "@@ -1,1 +1,2 @@\n one\n+one-and-a-half\n@@ -4,2 +5,1 @@\n four\n-five\n", "one\none-and-a-half\ntwo\nthree\nfour\n"},
+		{"insert at start", "@@ -0,0 +1 @@\n+zero\n", "zero\none\ntwo\nthree\nfour\nfive\n"},
+		{"no newline at end", "@@ -5 +5 @@\n-five\n+5\n\\ No newline at end of file\n", "one\ntwo\nthree\nfour\n5"},
+	}
+	for _, c := range cases {
+		got, err := applyPatch(orig, c.diff)
+		if err != nil || got != c.want {
+			t.Errorf("%s: got %q, %v; want %q", c.name, got, err, c.want)
+		}
+	}
+	if got, err := applyPatch("", "@@ -0,0 +1,2 @@\n+a\n+b\n"); err != nil || got != "a\nb\n" {
+		t.Errorf("patch an empty file: %q, %v", got, err)
+	}
+}
+
+func TestApplyPatchRejects(t *testing.T) {
+	orig := "one\ntwo\nthree\n"
+	for name, diff := range map[string]string{
+		"context mismatch": "@@ -1,2 +1,2 @@\n one\n-TWO\n+2\n",
+		"out of range":     "@@ -9,1 +9,1 @@\n-x\n+y\n",
+		"no hunks":         "--- a/f\n+++ b/f\n",
+		"truncated hunk":   "@@ -1,3 +1,3 @@\n one\n",
+		"bad header":       "@@ -x +1 @@\n-one\n",
+		"two files":        "--- a/f\n+++ b/f\n@@ -1 +1 @@\n-one\n+1\n--- a/g\n+++ b/g\n@@ -1 +1 @@\n-x\n+y\n",
+	} {
+		if got, err := applyPatch(orig, diff); err == nil {
+			t.Errorf("%s: expected error, got %q", name, got)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package broker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+)
+
+// readRange is the part of a file returned by file.read.
+type readRange struct {
+	data    []byte
+	offset  int64 // of data in the file
+	total   int64 // size of the file
+	hasMore bool  // the file continues after data (before it, for tail_lines)
+	// Line-range reads only: the first line asked for and the last line returned (1-based).
+	startLine, endLine int
+}
+
+// readFileRange reads the part of f selected by params, returning at most limit bytes: offset/length
+// (a byte range), tail_lines (the last lines), start_line/end_line (a line range, inclusive) or,
+// with none of these, the whole file, which fails if it is larger than limit. Line reads stop at the
+// last whole line that fits; has_more then tells the caller to continue from end_line+1.
+func readFileRange(f *os.File, params map[string]interface{}, limit int) (*readRange, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	total := fi.Size()
+	nums := map[string]int64{}
+	for _, key := range []string{"offset", "length", "tail_lines", "start_line", "end_line"} {
+		v, ok := params[key]
+		if !ok {
+			continue
+		}
+		n, ok := v.(float64)
+		if !ok || n < 0 || n != math.Trunc(n) {
+			return nil, fmt.Errorf("%s must be a non-negative integer", key)
+		}
+		nums[key] = int64(n)
+	}
+	_, hasOffset := nums["offset"]
+	_, hasLength := nums["length"]
+	_, hasTail := nums["tail_lines"]
+	_, hasStart := nums["start_line"]
+	_, hasEnd := nums["end_line"]
+	byteRange, lineRange := hasOffset || hasLength, hasStart || hasEnd
+	if (byteRange && (hasTail || lineRange)) || (hasTail && lineRange) {
+		return nil, fmt.Errorf("use only one of offset/length, tail_lines or start_line/end_line")
+	}
+	switch {
+	case byteRange:
+		length := int64(limit)
+		if hasLength {
+			if length = nums["length"]; length < 1 || length > int64(limit) {
+				return nil, fmt.Errorf("length must be between 1 and %d", limit)
+			}
+		}
+		return readBytes(f, total, nums["offset"], length)
+	case hasTail:
+		if nums["tail_lines"] < 1 {
+			return nil, fmt.Errorf("tail_lines must be at least 1")
+		}
+		return readTail(f, total, nums["tail_lines"], limit)
+	case lineRange:
+		start, end := int64(1), nums["end_line"]
+		if hasStart {
+			start = nums["start_line"]
+		}
+		if start < 1 || (hasEnd && end < start) {
+			return nil, fmt.Errorf("start_line must be at least 1 and end_line at least start_line")
+		}
+		return readLines(f, total, int(start), int(end), limit)
+	}
+	if total > int64(limit) {
+		return nil, fmt.Errorf("file of %d bytes exceeds max_bytes %d; read it in parts with offset/length, tail_lines or start_line/end_line", total, limit)
+	}
+	data, err := io.ReadAll(io.LimitReader(f, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("file exceeds max_bytes %d", limit)
+	}
+	return &readRange{data: data, total: total}, nil
+}
+
+func readBytes(f *os.File, total, offset, length int64) (*readRange, error) {
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, length))
+	if err != nil {
+		return nil, err
+	}
+	return &readRange{data: data, offset: offset, total: total, hasMore: offset+int64(len(data)) < total}, nil
+}
+
+// readTail returns the last n lines of f, or as many whole lines as fit in limit bytes. A final line
+// longer than limit is returned cut to its last limit bytes.
+func readTail(f *os.File, total, n int64, limit int) (*readRange, error) {
+	window := total
+	if window > int64(limit) {
+		window = int64(limit)
+	}
+	buf := make([]byte, window)
+	if _, err := f.ReadAt(buf, total-window); err != nil && err != io.EOF {
+		return nil, err
+	}
+	// The newline ending the last line does not start another one.
+	end := len(buf)
+	if end > 0 && buf[end-1] == '\n' {
+		end--
+	}
+	start, found := 0, false
+	for i, lines := end-1, int64(0); i >= 0; i-- {
+		if buf[i] == '\n' {
+			if lines++; lines == n {
+				start, found = i+1, true
+				break
+			}
+		}
+	}
+	if !found && window < total {
+		// The window starts mid-line: drop the partial line unless it is all there is.
+		for i := 0; i < end; i++ {
+			if buf[i] == '\n' {
+				start = i + 1
+				break
+			}
+		}
+	}
+	offset := total - window + int64(start)
+	return &readRange{data: buf[start:], offset: offset, total: total, hasMore: offset > 0}, nil
+}
+
+// readLines returns lines start through end (0 for the last line) of f, stopping before the first
+// line that would take the result past limit bytes. A single line longer than limit is an error.
+func readLines(f *os.File, total int64, start, end, limit int) (*readRange, error) {
+	br := bufio.NewReader(io.NewSectionReader(f, 0, total))
+	var pos int64
+	line := 1
+	for line < start {
+		chunk, err := br.ReadSlice('\n')
+		pos += int64(len(chunk))
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			line++
+		} else if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+	}
+	r := &readRange{offset: pos, total: total, startLine: start, endLine: start - 1}
+	var data, cur []byte
+	for line >= start && (end == 0 || line <= end) {
+		chunk, err := br.ReadSlice('\n')
+		if len(data)+len(cur)+len(chunk) > limit {
+			if len(data) == 0 {
+				return nil, fmt.Errorf("line %d is longer than max_bytes %d; read it with offset/length", line, limit)
+			}
+			break
+		}
+		cur = append(cur, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(cur) > 0 {
+			data = append(data, cur...)
+			r.endLine = line
+			line++
+			cur = nil
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	r.data = data
+	r.hasMore = r.offset+int64(len(data)) < total
+	return r, nil
+}
+
+// sniffFile returns the MIME type of f from its first 512 bytes, whatever part of it was read.
+func sniffFile(f *os.File, r *readRange) string {
+	head := r.data
+	if r.offset > 0 || (len(head) < 512 && int64(len(head)) < r.total) {
+		head = make([]byte, 512)
+		n, _ := f.ReadAt(head, 0)
+		head = head[:n]
+	}
+	return http.DetectContentType(head)
+}
@@ -0,0 +1,39 @@
+package broker
+
+import (
+	"os"
+
+	"securetalon/internal/safefs"
+)
+
+// ErrSymlink is returned when a file path crosses a symlink and the token does not allow following
+// symlinks, or when a followed symlink resolves outside the allowed roots.
+var ErrSymlink = safefs.ErrSymlink
+
+// followSymlinks reports whether the constraints allow following symlinks.
+func followSymlinks(constraints map[string]interface{}) bool {
+	follow, _ := constraints["follow_symlinks"].(bool)
+	return follow
+}
+
+// openUnderRoots opens path for a file tool under the token's roots, checking the real filesystem
+// (see package safefs).
+func openUnderRoots(path string, constraints map[string]interface{}, flag int, perm os.FileMode) (*os.File, error) {
+	return safefs.Open(path, rootList(constraints["roots"]), followSymlinks(constraints), flag, perm)
+}
+
+func rootList(allowedRoots interface{}) []string {
+	switch v := allowedRoots.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, r := range v {
+			if s, ok := r.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
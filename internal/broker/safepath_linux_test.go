@@ -0,0 +1,31 @@
+//go:build linux
+
+package broker
+
+import (
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileReadRejectsFIFOWithoutBlocking(t *testing.T) {
+	s := newFileSandbox(t)
+	fifo := filepath.Join(s.root, "pipe")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.exec("file.read", fifo, "", nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected a FIFO to be rejected")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("reading a FIFO blocked")
+	}
+}
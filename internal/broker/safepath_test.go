@@ -0,0 +1,206 @@
+package broker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"securetalon/internal/core"
+	"securetalon/internal/policy"
+)
+
+// fileSandbox is a root directory with a secret file next to it (outside the root).
+type fileSandbox struct {
+	base, root, secret string
+	broker             *Broker
+	issuer             *policy.Issuer
+}
+
+func newFileSandbox(t *testing.T) *fileSandbox {
+	t.Helper()
+	base := t.TempDir()
+	s := &fileSandbox{
+		base:   base,
+		root:   filepath.Join(base, "root"),
+		secret: filepath.Join(base, "secret.txt"),
+		broker: NewBroker(policy.NewVerifier("secret")),
+		issuer: policy.NewIssuer("secret"),
+	}
+	mustMkdir(t, filepath.Join(s.root, "sub"))
+	mustWrite(t, s.secret, "TOP SECRET")
+	mustWrite(t, filepath.Join(s.root, "sub", "ok.txt"), "fine")
+	return s
+}
+
+func (s *fileSandbox) exec(tool, path, content string, extra map[string]interface{}) (map[string]interface{}, error) {
+	constraints := map[string]interface{}{"roots": []interface{}{s.root}}
+	for k, v := range extra {
+		constraints[k] = v
+	}
+	tok, err := s.issuer.Issue("sess_1", "agent", tool, constraints, 60)
+	if err != nil {
+		return nil, err
+	}
+	params := map[string]interface{}{"path": path}
+	if tool == "file.write" {
+		params["content"] = content
+	}
+	return s.broker.Execute(core.ToolIntent{Tool: tool, Params: params}, tok)
+}
+
+func mustMkdir(t *testing.T, dir string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustWrite(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustSymlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+}
+
+func TestFileToolsRejectTraversal(t *testing.T) {
+	s := newFileSandbox(t)
+	sep := string(filepath.Separator)
+	paths := []string{
+		s.root + sep + ".." + sep + "secret.txt",
+		s.root + sep + "sub" + sep + ".." + sep + ".." + sep + "secret.txt",
+		s.root + sep + "sub" + sep + ".." + sep + "sub" + sep + "ok.txt", // stays inside, still rejected
+		s.root + sep + "sub" + sep + "..",
+		s.root + "/sub/../../secret.txt",
+		s.root + "-evil" + sep + "x.txt", // sibling sharing the root's prefix
+		filepath.Join(s.base, "secret.txt"),
+		"secret.txt",
+	}
+	for _, p := range paths {
+		for _, tool := range []string{"file.read", "file.write"} {
+			if out, err := s.exec(tool, p, "pwned", nil); err == nil {
+				t.Errorf("%s %q: expected rejection, got %v", tool, p, out)
+			}
+		}
+	}
+	if b, _ := os.ReadFile(s.secret); string(b) != "TOP SECRET" {
+		t.Fatalf("secret was modified: %q", b)
+	}
+}
+
+func TestFileToolsNormalizeHarmlessSpelling(t *testing.T) {
+	s := newFileSandbox(t)
+	out, err := s.exec("file.read", s.root+"//sub/./ok.txt", "", nil)
+	if err != nil || out["content"] != "fine" {
+		t.Fatalf("read with redundant separators: %v, %v", out, err)
+	}
+	if _, err := s.exec("file.write", filepath.Join(s.root, "new", "deep", "f.txt"), "hello", nil); err != nil {
+		t.Fatalf("write creating directories: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(s.root, "new", "deep", "f.txt")); string(b) != "hello" {
+		t.Fatalf("written content = %q", b)
+	}
+}
+
+func TestFileToolsRejectSymlinksByDefault(t *testing.T) {
+	s := newFileSandbox(t)
+	mustSymlink(t, s.secret, filepath.Join(s.root, "leak.txt"))
+	mustSymlink(t, s.base, filepath.Join(s.root, "escape"))
+	mustSymlink(t, filepath.Join(s.root, "sub", "ok.txt"), filepath.Join(s.root, "inside.txt"))
+	mustSymlink(t, filepath.Join(s.root, "sub"), filepath.Join(s.root, "subdir"))
+	mustSymlink(t, filepath.Join(s.base, "created-outside.txt"), filepath.Join(s.root, "dangling.txt"))
+
+	cases := []struct{ tool, path string }{
+		{"file.read", filepath.Join(s.root, "leak.txt")},                // file link out of the root
+		{"file.read", filepath.Join(s.root, "escape", "secret.txt")},    // directory link out of the root
+		{"file.read", filepath.Join(s.root, "inside.txt")},              // link within the root
+		{"file.read", filepath.Join(s.root, "subdir", "ok.txt")},        // directory link within the root
+		{"file.write", filepath.Join(s.root, "leak.txt")},               // overwrite through a link
+		{"file.write", filepath.Join(s.root, "escape", "secret.txt")},   // write through a directory link
+		{"file.write", filepath.Join(s.root, "escape", "new", "f.txt")}, // create through a directory link
+		{"file.write", filepath.Join(s.root, "dangling.txt")},           // create through a dangling link
+	}
+	for _, c := range cases {
+		_, err := s.exec(c.tool, c.path, "pwned", nil)
+		if !errors.Is(err, ErrSymlink) {
+			t.Errorf("%s %s: got %v, want ErrSymlink", c.tool, c.path, err)
+		}
+	}
+	if b, _ := os.ReadFile(s.secret); string(b) != "TOP SECRET" {
+		t.Fatalf("secret was modified: %q", b)
+	}
+	if _, err := os.Lstat(filepath.Join(s.base, "created-outside.txt")); !os.IsNotExist(err) {
+		t.Fatal("file was created outside the root through a dangling symlink")
+	}
+	if _, err := os.Stat(filepath.Join(s.base, "new")); !os.IsNotExist(err) {
+		t.Fatal("directory was created outside the root through a symlink")
+	}
+}
+
+func TestFileToolsFollowSymlinksStaysUnderRoot(t *testing.T) {
+	s := newFileSandbox(t)
+	mustSymlink(t, s.secret, filepath.Join(s.root, "leak.txt"))
+	mustSymlink(t, s.base, filepath.Join(s.root, "escape"))
+	mustSymlink(t, filepath.Join(s.root, "sub", "ok.txt"), filepath.Join(s.root, "inside.txt"))
+	mustSymlink(t, "sub", filepath.Join(s.root, "subdir"))
+	mustSymlink(t, filepath.Join("..", "secret.txt"), filepath.Join(s.root, "relative-leak.txt"))
+	follow := map[string]interface{}{"follow_symlinks": true}
+
+	for _, p := range []string{
+		filepath.Join(s.root, "leak.txt"),
+		filepath.Join(s.root, "escape", "secret.txt"),
+		filepath.Join(s.root, "relative-leak.txt"),
+	} {
+		if _, err := s.exec("file.read", p, "", follow); !errors.Is(err, ErrSymlink) {
+			t.Errorf("read %s: got %v, want ErrSymlink", p, err)
+		}
+		if _, err := s.exec("file.write", p, "pwned", follow); !errors.Is(err, ErrSymlink) {
+			t.Errorf("write %s: got %v, want ErrSymlink", p, err)
+		}
+	}
+	for _, p := range []string{filepath.Join(s.root, "inside.txt"), filepath.Join(s.root, "subdir", "ok.txt")} {
+		out, err := s.exec("file.read", p, "", follow)
+		if err != nil || out["content"] != "fine" {
+			t.Errorf("read %s: %v, %v", p, out, err)
+		}
+	}
+	if _, err := s.exec("file.write", filepath.Join(s.root, "subdir", "new.txt"), "via link", follow); err != nil {
+		t.Fatalf("write through an in-root directory link: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(s.root, "sub", "new.txt")); string(b) != "via link" {
+		t.Fatalf("content = %q", b)
+	}
+	if b, _ := os.ReadFile(s.secret); string(b) != "TOP SECRET" {
+		t.Fatalf("secret was modified: %q", b)
+	}
+}
+
+func TestFileToolsAllowSymlinkedRoot(t *testing.T) {
+	s := newFileSandbox(t)
+	link := filepath.Join(s.base, "root-link")
+	mustSymlink(t, s.root, link)
+	tok, _ := s.issuer.Issue("sess_1", "agent", "file.read", map[string]interface{}{"roots": []interface{}{link}}, 60)
+	out, err := s.broker.Execute(core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": filepath.Join(link, "sub", "ok.txt")}}, tok)
+	if err != nil || out["content"] != "fine" {
+		t.Fatalf("the root itself may be a symlink: %v, %v", out, err)
+	}
+}
+
+func TestFileToolsRejectDirectories(t *testing.T) {
+	s := newFileSandbox(t)
+	for _, p := range []string{s.root, filepath.Join(s.root, "sub")} {
+		if _, err := s.exec("file.read", p, "", nil); err == nil {
+			t.Errorf("read directory %s: expected error", p)
+		}
+		if _, err := s.exec("file.write", p, "x", nil); err == nil {
+			t.Errorf("write directory %s: expected error", p)
+		}
+	}
+}
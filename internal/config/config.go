@@ -3,8 +3,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // Config holds server and security settings.
@@ -16,14 +18,23 @@ type Config struct {
 	DataDir string `yaml:"data_dir" json:"data_dir"`
 	// Addr is the HTTP listen address (env: ADDR).
 	Addr string `yaml:"addr" json:"addr"`
-	// TokenSecret is used to sign capability tokens (env: TOKEN_SECRET).
-	TokenSecret string `yaml:"token_secret" json:"token_secret"`
+	// KeyRotationInterval is how often the capability token signing key rotates (env: KEY_ROTATION_INTERVAL,
+	// e.g. "24h"; 0 disables scheduled rotation).
+	KeyRotationInterval time.Duration `yaml:"key_rotation_interval" json:"key_rotation_interval"`
+	// KeyRetention is how long a retired signing key keeps verifying tokens (env: KEY_RETENTION).
+	// Must exceed TokenLeeway when keys rotate; token lifetimes are capped to MaxTokenTTL.
+	KeyRetention time.Duration `yaml:"key_retention" json:"key_retention"`
+	// TokenLeeway is the clock skew tolerated when verifying token iat/exp (env: TOKEN_LEEWAY).
+	TokenLeeway time.Duration `yaml:"token_leeway" json:"token_leeway"`
 	// DockerMemoryLimit for skill containers (e.g. "512m").
 	DockerMemoryLimit string `yaml:"docker_memory_limit" json:"docker_memory_limit"`
 	// DockerCPULimit for skill containers (e.g. "1.0").
 	DockerCPULimit string `yaml:"docker_cpu_limit" json:"docker_cpu_limit"`
 	// AllowedRegistries for docker.run (comma-separated or in file).
 	AllowedRegistries []string `yaml:"allowed_registries" json:"allowed_registries"`
+	// GlobalPolicyFile is the organization-wide policy JSON, hot-reloaded (env: GLOBAL_POLICY_FILE).
+	// Defaults to DataDir/policy/global.json.
+	GlobalPolicyFile string `yaml:"global_policy_file" json:"global_policy_file"`
 }
 
 // DefaultConfig returns defaults; env overrides.
@@ -37,13 +48,16 @@ func DefaultConfig() *Config {
 		addr = ":8080"
 	}
 	return &Config{
-		AdminToken:        os.Getenv("ADMIN_TOKEN"),
-		DataDir:           dataDir,
-		Addr:              addr,
-		TokenSecret:       os.Getenv("TOKEN_SECRET"),
-		DockerMemoryLimit: getEnv("DOCKER_MEMORY_LIMIT", "512m"),
-		DockerCPULimit:    getEnv("DOCKER_CPU_LIMIT", "1.0"),
-		AllowedRegistries: []string{},
+		AdminToken:          os.Getenv("ADMIN_TOKEN"),
+		DataDir:             dataDir,
+		Addr:                addr,
+		DockerMemoryLimit:   getEnv("DOCKER_MEMORY_LIMIT", "512m"),
+		DockerCPULimit:      getEnv("DOCKER_CPU_LIMIT", "1.0"),
+		AllowedRegistries:   []string{},
+		GlobalPolicyFile:    getEnv("GLOBAL_POLICY_FILE", filepath.Join(dataDir, "policy", "global.json")),
+		KeyRotationInterval: getDuration("KEY_ROTATION_INTERVAL", 24*time.Hour),
+		KeyRetention:        getDuration("KEY_RETENTION", time.Hour),
+		TokenLeeway:         getDuration("TOKEN_LEEWAY", 5*time.Second),
 	}
 }
 
@@ -54,15 +68,67 @@ func getEnv(key, def string) string {
 	return def
 }
 
+// getDuration parses key as a Go duration (e.g. "12h"), falling back to def when unset or invalid.
+func getDuration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d >= 0 {
+		return d
+	}
+	return def
+}
+
+// Validate checks settings that depend on each other.
+func (c *Config) Validate() error {
+	if c.KeyRotationInterval > 0 && c.MaxTokenTTL() <= 0 {
+		return fmt.Errorf("KEY_RETENTION (%s) must exceed TOKEN_LEEWAY (%s) by at least 1s", c.KeyRetention, c.TokenLeeway)
+	}
+	return nil
+}
+
+// MaxTokenTTL returns the longest token lifetime, in seconds, that a retired signing key still
+// verifies (KeyRetention less TokenLeeway), or 0 (no cap) when keys are never rotated.
+func (c *Config) MaxTokenTTL() int64 {
+	if c.KeyRotationInterval <= 0 {
+		return 0
+	}
+	return int64((c.KeyRetention - c.TokenLeeway) / time.Second)
+}
+
 // AuditDir returns the audit log directory under DataDir.
 func (c *Config) AuditDir() string {
 	return filepath.Join(c.DataDir, "audit")
 }
 
-// EnsureDataDirs creates data and audit dirs if missing.
+// ApprovalsDir returns the approval queue directory under DataDir.
+func (c *Config) ApprovalsDir() string {
+	return filepath.Join(c.DataDir, "approvals")
+}
+
+// StoreDir returns the session/message/run store directory under DataDir.
+func (c *Config) StoreDir() string {
+	return filepath.Join(c.DataDir, "store")
+}
+
+// PolicyDir returns the policy revisions directory under DataDir.
+func (c *Config) PolicyDir() string {
+	return filepath.Join(c.DataDir, "policy")
+}
+
+// KeysDir returns the token signing keyring directory under DataDir.
+func (c *Config) KeysDir() string {
+	return filepath.Join(c.DataDir, "keys")
+}
+
+// WorkspacesDir returns the per-session workspaces directory under DataDir.
+func (c *Config) WorkspacesDir() string {
+	return filepath.Join(c.DataDir, "workspaces")
+}
+
+// EnsureDataDirs creates data dir and its subdirectories if missing.
 func (c *Config) EnsureDataDirs() error {
-	if err := os.MkdirAll(c.DataDir, 0700); err != nil {
-		return err
+	for _, dir := range []string{c.DataDir, c.AuditDir(), c.ApprovalsDir(), c.StoreDir(), c.PolicyDir(), c.KeysDir(), c.WorkspacesDir()} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
 	}
-	return os.MkdirAll(c.AuditDir(), 0700)
+	return nil
 }
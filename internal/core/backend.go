@@ -0,0 +1,255 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Backend persists Store mutations so sessions, messages, and runs survive restarts.
+// Store calls Backend methods while holding its own lock.
+type Backend interface {
+	// Load returns the persisted state: the last snapshot with later records replayed on top.
+	Load() (*State, error)
+	// Append durably records one mutation.
+	Append(rec Record) error
+	// Snapshot replaces the persisted state with st and discards records it already covers.
+	Snapshot(st *State) error
+}
+
+// State is the full contents of a Store.
+type State struct {
+	Seq      uint64               `json:"seq"`
+	Sessions []*Session           `json:"sessions"`
+	Messages map[string][]Message `json:"messages"`
+	Runs     []*Run               `json:"runs"`
+}
+
+// Record ops.
+const (
+	OpPutSession    = "put_session"
+	OpAppendMessage = "append_message"
+	OpSetMessage    = "set_message"
+	OpPutRun        = "put_run"
+	OpAppendStep    = "append_step"
+	OpRunStatus     = "run_status"
+)
+
+// Record is one mutation in the write-ahead log. Sessions and new runs are written in full;
+// set_message replaces the message with the same ID; append_step and run_status change an existing
+// run, so the log grows with each step rather than with the size of the run.
+type Record struct {
+	Seq       uint64     `json:"seq"`
+	Op        string     `json:"op"`
+	SessionID string     `json:"session_id,omitempty"`
+	Session   *Session   `json:"session,omitempty"`
+	Message   *Message   `json:"message,omitempty"`
+	Run       *Run       `json:"run,omitempty"`
+	RunID     string     `json:"run_id,omitempty"`
+	Step      *Step      `json:"step,omitempty"`
+	Status    string     `json:"status,omitempty"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+// FileBackend is an on-disk Backend: an append-only JSONL write-ahead log (store.wal) plus a
+// periodic JSON snapshot (store.snapshot.json). Records with seq <= the snapshot's seq are skipped
+// on load, so a crash between writing the snapshot and truncating the log is harmless.
+type FileBackend struct {
+	mu  sync.Mutex
+	dir string
+	wal *os.File
+}
+
+// NewFileBackend opens (or creates) a file backend under dir (e.g. data/store).
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	b := &FileBackend{dir: dir}
+	if err := b.openWAL(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *FileBackend) walPath() string      { return filepath.Join(b.dir, "store.wal") }
+func (b *FileBackend) snapshotPath() string { return filepath.Join(b.dir, "store.snapshot.json") }
+
+func (b *FileBackend) openWAL() error {
+	f, err := os.OpenFile(b.walPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	b.wal = f
+	return nil
+}
+
+// Load reads the snapshot (if any) and replays newer WAL records.
+func (b *FileBackend) Load() (*State, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := &State{Messages: make(map[string][]Message)}
+	raw, err := os.ReadFile(b.snapshotPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(raw, st); err != nil {
+			return nil, err
+		}
+		if st.Messages == nil {
+			st.Messages = make(map[string][]Message)
+		}
+	}
+	f, err := os.Open(b.walPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return st, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	sessions := make(map[string]int, len(st.Sessions))
+	for i, sess := range st.Sessions {
+		sessions[sess.ID] = i
+	}
+	runs := make(map[string]int, len(st.Runs))
+	for i, r := range st.Runs {
+		runs[r.ID] = i
+	}
+	rd := bufio.NewReader(f)
+	var valid int64
+	for {
+		line, err := rd.ReadBytes('\n')
+		var rec Record
+		if err != nil || json.Unmarshal(line, &rec) != nil {
+			if len(line) > 0 {
+				// Torn final write: drop it so later appends start on a clean line.
+				if err := os.Truncate(b.walPath(), valid); err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+		valid += int64(len(line))
+		if rec.Seq <= st.Seq {
+			continue
+		}
+		st.Seq = rec.Seq
+		switch rec.Op {
+		case OpPutSession:
+			if rec.Session == nil {
+				continue
+			}
+			if i, ok := sessions[rec.Session.ID]; ok {
+				st.Sessions[i] = rec.Session
+			} else {
+				sessions[rec.Session.ID] = len(st.Sessions)
+				st.Sessions = append(st.Sessions, rec.Session)
+			}
+			if _, ok := st.Messages[rec.Session.ID]; !ok {
+				st.Messages[rec.Session.ID] = nil
+			}
+		case OpAppendMessage:
+			if rec.Message != nil {
+				st.Messages[rec.SessionID] = append(st.Messages[rec.SessionID], *rec.Message)
+			}
+		case OpSetMessage:
+			if rec.Message == nil {
+				continue
+			}
+			msgs := st.Messages[rec.SessionID]
+			for i := range msgs {
+				if msgs[i].ID == rec.Message.ID {
+					msgs[i] = *rec.Message
+				}
+			}
+		case OpPutRun:
+			if rec.Run == nil {
+				continue
+			}
+			if i, ok := runs[rec.Run.ID]; ok {
+				st.Runs[i] = rec.Run
+			} else {
+				runs[rec.Run.ID] = len(st.Runs)
+				st.Runs = append(st.Runs, rec.Run)
+			}
+		case OpAppendStep:
+			if i, ok := runs[rec.RunID]; ok && rec.Step != nil {
+				st.Runs[i].Steps = append(st.Runs[i].Steps, *rec.Step)
+			}
+		case OpRunStatus:
+			if i, ok := runs[rec.RunID]; ok {
+				st.Runs[i].Status = rec.Status
+				if rec.EndedAt != nil {
+					st.Runs[i].EndedAt = rec.EndedAt
+				}
+			}
+		}
+	}
+	return st, nil
+}
+
+// Append writes one record to the WAL and syncs it to disk.
+func (b *FileBackend) Append(rec Record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := b.wal.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return b.wal.Sync()
+}
+
+// Snapshot atomically writes st (temp file + rename) and then truncates the WAL.
+func (b *FileBackend) Snapshot(st *State) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	raw, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp := b.snapshotPath() + ".tmp"
+	if err := writeFileSync(tmp, raw); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, b.snapshotPath()); err != nil {
+		return err
+	}
+	if err := b.wal.Close(); err != nil {
+		return err
+	}
+	if err := os.Truncate(b.walPath(), 0); err != nil {
+		return err
+	}
+	return b.openWAL()
+}
+
+// Close closes the WAL file.
+func (b *FileBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.wal.Close()
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
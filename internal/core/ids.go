@@ -28,5 +28,8 @@ func NewEventID() string { return NewID("evt") }
 // NewCapID returns cap_...
 func NewCapID() string { return NewID("cap") }
 
+// NewApprovalID returns apr_...
+func NewApprovalID() string { return NewID("apr") }
+
 // NewStepID returns s1, s2, ...
 func NewStepID(n int) string { return fmt.Sprintf("s%d", n) }
@@ -1,17 +1,28 @@
 package core
 
 import (
+	"errors"
 	"sync"
 	"time"
 )
 
-// Store holds sessions, messages, and runs in memory (MVP).
+// ErrNotFound is returned for mutations of a session that does not exist.
+var ErrNotFound = errors.New("not found")
+
+// snapshotEvery is the number of WAL records after which the store compacts into a snapshot.
+const snapshotEvery = 1000
+
+// Store holds sessions, messages, and runs in memory, optionally persisted through a Backend.
 // Thread-safe.
 type Store struct {
 	mu       sync.RWMutex
 	sessions map[string]*Session
 	messages map[string][]Message // session_id -> messages
 	runs     map[string]*Run
+
+	backend   Backend
+	seq       uint64
+	sinceSnap int
 }
 
 // NewStore creates an empty in-memory store.
@@ -23,20 +34,101 @@ func NewStore() *Store {
 	}
 }
 
+// OpenStore creates a store backed by b and loads its persisted state.
+func OpenStore(b Backend) (*Store, error) {
+	st, err := b.Load()
+	if err != nil {
+		return nil, err
+	}
+	s := NewStore()
+	s.backend = b
+	s.seq = st.Seq
+	for _, sess := range st.Sessions {
+		s.sessions[sess.ID] = sess
+		s.messages[sess.ID] = st.Messages[sess.ID]
+	}
+	for _, r := range st.Runs {
+		s.runs[r.ID] = r
+	}
+	// No run survives a restart in progress: the agent goroutine driving it is gone. Runs awaiting
+	// approval are resumed from the approval queue instead.
+	for _, r := range s.runs {
+		if r.Status == "queued" || r.Status == "running" {
+			now := time.Now().UTC()
+			err := s.persist(Record{Op: OpRunStatus, RunID: r.ID, Status: "failed", EndedAt: &now}, func() {
+				r.Status, r.EndedAt = "failed", &now
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// persist appends rec to the backend, then applies the mutation it records, and compacts every
+// snapshotEvery records. When the append fails apply is not called, so the in-memory state never
+// runs ahead of the log. Caller holds s.mu.
+func (s *Store) persist(rec Record, apply func()) error {
+	if s.backend == nil {
+		apply()
+		return nil
+	}
+	rec.Seq = s.seq + 1
+	if err := s.backend.Append(rec); err != nil {
+		return err
+	}
+	apply()
+	s.seq++
+	s.sinceSnap++
+	if s.sinceSnap >= snapshotEvery {
+		if s.backend.Snapshot(s.state()) == nil {
+			s.sinceSnap = 0
+		}
+	}
+	return nil
+}
+
+// state returns the full store contents for a snapshot. Caller holds s.mu.
+func (s *Store) state() *State {
+	st := &State{Seq: s.seq, Messages: make(map[string][]Message, len(s.messages))}
+	for _, sess := range s.sessions {
+		st.Sessions = append(st.Sessions, sess)
+	}
+	for id, msgs := range s.messages {
+		st.Messages[id] = msgs
+	}
+	for _, r := range s.runs {
+		st.Runs = append(st.Runs, r)
+	}
+	return st
+}
+
+func copyRun(r *Run) *Run {
+	cp := *r
+	cp.Steps = append([]Step(nil), r.Steps...)
+	return &cp
+}
+
 // CreateSession adds a new session.
-func (s *Store) CreateSession(label string, metadata map[string]string) *Session {
+func (s *Store) CreateSession(label string, metadata map[string]string) (*Session, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	sess := &Session{
 		ID:        NewSessionID(),
 		CreatedAt: time.Now().UTC(),
 		Label:     label,
-		Status:    "active",
+		Status:    SessionActive,
 		Metadata:  metadata,
 	}
-	s.sessions[sess.ID] = sess
-	s.messages[sess.ID] = nil
-	return sess
+	err := s.persist(Record{Op: OpPutSession, Session: sess}, func() {
+		s.sessions[sess.ID] = sess
+		s.messages[sess.ID] = nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sess, nil
 }
 
 // GetSession returns a session by ID or nil.
@@ -46,6 +138,28 @@ func (s *Store) GetSession(id string) *Session {
 	return s.sessions[id]
 }
 
+// CloseSession marks a session closed and returns it; closing a closed session is a no-op.
+// Returns ErrNotFound if the session does not exist.
+func (s *Store) CloseSession(id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if sess.Status == SessionClosed {
+		return sess, nil
+	}
+	cp := *sess
+	now := time.Now().UTC()
+	cp.Status = SessionClosed
+	cp.ClosedAt = &now
+	if err := s.persist(Record{Op: OpPutSession, Session: &cp}, func() { s.sessions[id] = &cp }); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
 // ListSessions returns sessions, optionally with cursor/limit (MVP: simple limit).
 func (s *Store) ListSessions(limit int, cursor string) ([]*Session, string) {
 	s.mu.RLock()
@@ -64,12 +178,13 @@ func (s *Store) ListSessions(limit int, cursor string) ([]*Session, string) {
 	return out, ""
 }
 
-// AppendMessage adds a message to a session and returns it.
-func (s *Store) AppendMessage(sessionID string, role, content string, metadata map[string]string) (*Message, bool) {
+// AppendMessage adds a message to a session and returns it. Returns ErrNotFound if the session does
+// not exist.
+func (s *Store) AppendMessage(sessionID string, role, content string, metadata map[string]string) (*Message, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.sessions[sessionID]; !ok {
-		return nil, false
+		return nil, ErrNotFound
 	}
 	msg := Message{
 		ID:        NewMessageID(),
@@ -78,20 +193,26 @@ func (s *Store) AppendMessage(sessionID string, role, content string, metadata m
 		Timestamp: time.Now().UTC(),
 		Metadata:  metadata,
 	}
-	s.messages[sessionID] = append(s.messages[sessionID], msg)
-	return &msg, true
+	err := s.persist(Record{Op: OpAppendMessage, SessionID: sessionID, Message: &msg}, func() {
+		s.messages[sessionID] = append(s.messages[sessionID], msg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
 }
 
 // SetMessageRunID sets run_id on the last message of the session (the one that triggered the run).
-func (s *Store) SetMessageRunID(sessionID, runID string) {
+func (s *Store) SetMessageRunID(sessionID, runID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	msgs := s.messages[sessionID]
 	if len(msgs) == 0 {
-		return
+		return nil
 	}
-	msgs[len(msgs)-1].RunID = runID
-	s.messages[sessionID] = msgs
+	last := msgs[len(msgs)-1]
+	last.RunID = runID
+	return s.persist(Record{Op: OpSetMessage, SessionID: sessionID, Message: &last}, func() { msgs[len(msgs)-1] = last })
 }
 
 // GetMessages returns messages for a session (limit applied).
@@ -113,7 +234,7 @@ func (s *Store) GetMessages(sessionID string, limit int) ([]Message, bool) {
 }
 
 // CreateRun creates a new run for a session (queued).
-func (s *Store) CreateRun(sessionID string) *Run {
+func (s *Store) CreateRun(sessionID string) (*Run, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	r := &Run{
@@ -123,8 +244,10 @@ func (s *Store) CreateRun(sessionID string) *Run {
 		StartedAt: time.Now().UTC(),
 		Steps:     nil,
 	}
-	s.runs[r.ID] = r
-	return r
+	if err := s.persist(Record{Op: OpPutRun, Run: copyRun(r)}, func() { s.runs[r.ID] = r }); err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
 // GetRun returns a run by ID.
@@ -134,26 +257,35 @@ func (s *Store) GetRun(id string) *Run {
 	return s.runs[id]
 }
 
-// UpdateRunStatus sets status and optionally ended_at and steps.
-func (s *Store) UpdateRunStatus(id string, status string, endedAt *time.Time, steps []Step) {
+// UpdateRunStatus sets status and optionally ended_at and steps. Unless steps are replaced only the
+// status change is logged.
+func (s *Store) UpdateRunStatus(id string, status string, endedAt *time.Time, steps []Step) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if r := s.runs[id]; r != nil {
-		r.Status = status
-		if endedAt != nil {
-			r.EndedAt = endedAt
-		}
-		if steps != nil {
-			r.Steps = steps
-		}
+	r := s.runs[id]
+	if r == nil {
+		return nil
+	}
+	cp := copyRun(r)
+	cp.Status = status
+	if endedAt != nil {
+		cp.EndedAt = endedAt
+	}
+	rec := Record{Op: OpRunStatus, RunID: id, Status: status, EndedAt: endedAt}
+	if steps != nil {
+		cp.Steps = steps
+		rec = Record{Op: OpPutRun, Run: cp}
 	}
+	return s.persist(rec, func() { r.Status, r.EndedAt, r.Steps = cp.Status, cp.EndedAt, cp.Steps })
 }
 
-// AppendRunStep appends a step to a run.
-func (s *Store) AppendRunStep(runID string, step Step) {
+// AppendRunStep appends a step to a run. Only the step is logged, not the whole run.
+func (s *Store) AppendRunStep(runID string, step Step) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if r := s.runs[runID]; r != nil {
-		r.Steps = append(r.Steps, step)
+	r := s.runs[runID]
+	if r == nil {
+		return nil
 	}
+	return s.persist(Record{Op: OpAppendStep, RunID: runID, Step: &step}, func() { r.Steps = append(r.Steps, step) })
 }
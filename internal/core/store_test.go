@@ -0,0 +1,222 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileBackendSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenStore(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, _ := store.CreateSession("demo", map[string]string{"owner": "stan"})
+	store.AppendMessage(sess.ID, "user", "hello", nil)
+	run, _ := store.CreateRun(sess.ID)
+	store.SetMessageRunID(sess.ID, run.ID)
+	store.AppendRunStep(run.ID, Step{StepID: "s1", Type: "policy_eval", Status: "allow", Tool: "file.read"})
+	store.UpdateRunStatus(run.ID, "completed", nil, nil)
+	b.Close()
+
+	b2, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenStore(b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b2.Close()
+
+	got := reopened.GetSession(sess.ID)
+	if got == nil || got.Label != "demo" || got.Metadata["owner"] != "stan" {
+		t.Fatalf("session not restored: %+v", got)
+	}
+	list, _ := reopened.ListSessions(10, "")
+	if len(list) != 1 {
+		t.Fatalf("expected 1 session, got %d", len(list))
+	}
+	msgs, ok := reopened.GetMessages(sess.ID, 10)
+	if !ok || len(msgs) != 1 || msgs[0].RunID != run.ID {
+		t.Fatalf("messages not restored: %+v", msgs)
+	}
+	r := reopened.GetRun(run.ID)
+	if r == nil || r.Status != "completed" || len(r.Steps) != 1 {
+		t.Fatalf("run not restored: %+v", r)
+	}
+
+	// New mutations continue the sequence after restart
+	reopened.AppendMessage(sess.ID, "assistant", "done", nil)
+	msgs, _ = reopened.GetMessages(sess.ID, 10)
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+}
+
+func TestFileBackendSnapshotAndTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	b, _ := NewFileBackend(dir)
+	store, err := OpenStore(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, _ := store.CreateSession("snap", nil)
+	for i := 0; i < snapshotEvery+5; i++ {
+		store.AppendMessage(sess.ID, "user", "m", nil)
+	}
+	b.Close()
+	if _, err := os.Stat(filepath.Join(dir, "store.snapshot.json")); err != nil {
+		t.Fatalf("expected snapshot file: %v", err)
+	}
+	// Simulate a crash mid-append: a partial trailing line must be ignored
+	f, _ := os.OpenFile(filepath.Join(dir, "store.wal"), os.O_APPEND|os.O_WRONLY, 0600)
+	f.WriteString(`{"seq":999999,"op":"append_mes`)
+	f.Close()
+
+	b2, _ := NewFileBackend(dir)
+	reopened, err := OpenStore(b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := reopened.GetMessages(sess.ID, 5000)
+	if len(msgs) != snapshotEvery+5 {
+		t.Fatalf("expected %d messages, got %d", snapshotEvery+5, len(msgs))
+	}
+
+	// Appends after the torn line are readable on the next restart
+	reopened.AppendMessage(sess.ID, "user", "after crash", nil)
+	b2.Close()
+	b3, _ := NewFileBackend(dir)
+	defer b3.Close()
+	again, err := OpenStore(b3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ = again.GetMessages(sess.ID, 5000)
+	if len(msgs) != snapshotEvery+6 || msgs[len(msgs)-1].Content != "after crash" {
+		t.Fatalf("expected message appended after crash, got %d messages", len(msgs))
+	}
+}
+
+func TestCloseSessionPersists(t *testing.T) {
+	dir := t.TempDir()
+	b, _ := NewFileBackend(dir)
+	store, err := OpenStore(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, _ := store.CreateSession("demo", nil)
+	closed, err := store.CloseSession(sess.ID)
+	if err != nil || closed.Status != SessionClosed || closed.ClosedAt == nil {
+		t.Fatalf("close: %+v %v", closed, err)
+	}
+	if _, err := store.CloseSession("sess_missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("closing an unknown session: got %v, want ErrNotFound", err)
+	}
+	b.Close()
+
+	b2, _ := NewFileBackend(dir)
+	reopened, err := OpenStore(b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.GetSession(sess.ID); got == nil || got.Status != SessionClosed {
+		t.Fatalf("closed status lost across restart: %+v", got)
+	}
+}
+
+// failingBackend accepts records until fail is set.
+type failingBackend struct {
+	fail bool
+	recs []Record
+}
+
+func (b *failingBackend) Load() (*State, error) { return &State{}, nil }
+func (b *failingBackend) Snapshot(*State) error { return nil }
+func (b *failingBackend) Append(rec Record) error {
+	if b.fail {
+		return errors.New("disk full")
+	}
+	b.recs = append(b.recs, rec)
+	return nil
+}
+
+func TestStoreSurfacesPersistErrors(t *testing.T) {
+	b := &failingBackend{}
+	store, err := OpenStore(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := store.CreateSession("demo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := store.CreateRun(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Steps and status changes are logged as deltas, not as the whole run.
+	store.AppendRunStep(run.ID, Step{StepID: "s1", Status: "allow"})
+	store.UpdateRunStatus(run.ID, "running", nil, nil)
+	if ops := []string{b.recs[2].Op, b.recs[3].Op}; ops[0] != OpAppendStep || ops[1] != OpRunStatus {
+		t.Fatalf("ops = %v", ops)
+	}
+
+	b.fail = true
+	if _, err := store.CreateSession("lost", nil); err == nil {
+		t.Fatal("CreateSession succeeded although the write failed")
+	}
+	if _, err := store.AppendMessage(sess.ID, "user", "hi", nil); err == nil {
+		t.Fatal("AppendMessage succeeded although the write failed")
+	}
+	if err := store.AppendRunStep(run.ID, Step{StepID: "s2"}); err == nil {
+		t.Fatal("AppendRunStep succeeded although the write failed")
+	}
+	if list, _ := store.ListSessions(10, ""); len(list) != 1 {
+		t.Fatalf("failed write changed the store: %d sessions", len(list))
+	}
+	if msgs, _ := store.GetMessages(sess.ID, 10); len(msgs) != 0 {
+		t.Fatalf("failed write changed the store: %v", msgs)
+	}
+	if r := store.GetRun(run.ID); len(r.Steps) != 1 || r.Status != "running" {
+		t.Fatalf("failed write changed the run: %+v", r)
+	}
+}
+
+func TestOpenStoreFailsOrphanedRuns(t *testing.T) {
+	dir := t.TempDir()
+	b, _ := NewFileBackend(dir)
+	store, err := OpenStore(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, _ := store.CreateSession("demo", nil)
+	running, _ := store.CreateRun(sess.ID)
+	store.AppendRunStep(running.ID, Step{StepID: "s1", Status: "allow"})
+	store.UpdateRunStatus(running.ID, "running", nil, nil)
+	paused, _ := store.CreateRun(sess.ID)
+	store.UpdateRunStatus(paused.ID, "awaiting_approval", nil, nil)
+	b.Close()
+
+	for i := 0; i < 2; i++ {
+		b2, _ := NewFileBackend(dir)
+		reopened, err := OpenStore(b2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b2.Close()
+		if r := reopened.GetRun(running.ID); r.Status != "failed" || r.EndedAt == nil || len(r.Steps) != 1 {
+			t.Fatalf("orphaned run after restart %d: %+v", i+1, r)
+		}
+		if r := reopened.GetRun(paused.ID); r.Status != "awaiting_approval" {
+			t.Fatalf("paused run after restart %d: %+v", i+1, r)
+		}
+	}
+}
@@ -11,8 +11,15 @@ type Session struct {
 	Label     string            `json:"label"`
 	Status    string            `json:"status"` // active, closed
 	Metadata  map[string]string `json:"metadata,omitempty"`
+	ClosedAt  *time.Time        `json:"closed_at,omitempty"`
 }
 
+// Session statuses.
+const (
+	SessionActive = "active"
+	SessionClosed = "closed"
+)
+
 // Message is a single message in a session.
 type Message struct {
 	ID        string            `json:"id"`
@@ -25,59 +32,101 @@ type Message struct {
 
 // Run represents an agent run (triggered by a user message).
 type Run struct {
-	ID        string    `json:"id"`
-	SessionID string    `json:"session_id"`
-	Status    string    `json:"status"` // queued, running, completed, failed
-	StartedAt time.Time `json:"started_at"`
+	ID        string     `json:"id"`
+	SessionID string     `json:"session_id"`
+	Status    string     `json:"status"` // queued, running, awaiting_approval, completed, failed
+	StartedAt time.Time  `json:"started_at"`
 	EndedAt   *time.Time `json:"ended_at,omitempty"`
-	Steps     []Step    `json:"steps,omitempty"`
+	Steps     []Step     `json:"steps,omitempty"`
 }
 
 // Step is one step in a run (policy eval or tool exec).
 type Step struct {
-	StepID   string                 `json:"step_id"`
-	Type     string                 `json:"type"` // policy_eval, tool_exec
-	Status   string                 `json:"status"`
-	Tool     string                 `json:"tool,omitempty"`
-	Details  map[string]interface{} `json:"details,omitempty"`
+	StepID  string                 `json:"step_id"`
+	Type    string                 `json:"type"` // policy_eval, tool_exec
+	Status  string                 `json:"status"`
+	Tool    string                 `json:"tool,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
 }
 
 // ToolIntent is a request to execute a tool (from agent/skill).
 type ToolIntent struct {
-	Tool     string                 `json:"tool"`
-	Params   map[string]interface{} `json:"params"`
-	Subject  string                 `json:"subject,omitempty"`
+	Tool    string                 `json:"tool"`
+	Params  map[string]interface{} `json:"params"`
+	Subject string                 `json:"subject,omitempty"`
 }
 
 // Decision is the result of policy evaluation.
 type Decision string
 
 const (
-	DecisionAllow          Decision = "ALLOW"
-	DecisionDeny           Decision = "DENY"
+	DecisionAllow           Decision = "ALLOW"
+	DecisionDeny            Decision = "DENY"
 	DecisionRequireApproval Decision = "REQUIRE_APPROVAL"
 )
 
-// PolicyResult is returned by Policy Engine.
+// PolicyResult is returned by Policy Engine. Rule identifies the deciding rule (e.g. "session#2").
 type PolicyResult struct {
-	Decision     Decision        `json:"decision"`
-	Reason       string          `json:"reason,omitempty"`
-	SuggestedFix string          `json:"suggested_fix,omitempty"`
+	Decision     Decision         `json:"decision"`
+	Reason       string           `json:"reason,omitempty"`
+	Rule         string           `json:"rule,omitempty"`
+	Pack         string           `json:"pack,omitempty"` // pack of the deciding rule, if any
+	PackVersion  int              `json:"pack_version,omitempty"`
+	SuggestedFix string           `json:"suggested_fix,omitempty"`
 	Token        *CapabilityToken `json:"token,omitempty"`
 }
 
 // CapabilityToken is a signed, short-lived grant for one tool action.
 // Binds: session_id, subject, tool, constraints, exp.
 type CapabilityToken struct {
-	CapID      string                 `json:"cap_id"`
-	SessionID  string                 `json:"session_id"`
-	Subject    string                 `json:"subject"`
-	Tool       string                 `json:"tool"`
-	Constraints map[string]interface{} `json:"constraints"`
-	Iat        int64                  `json:"iat"`
-	Exp        int64                  `json:"exp"`
-	Nonce      string                 `json:"nonce"`
-	Signature  string                 `json:"signature"`
+	CapID         string                 `json:"cap_id"`
+	SessionID     string                 `json:"session_id"`
+	Subject       string                 `json:"subject"`
+	Tool          string                 `json:"tool"`
+	Constraints   map[string]interface{} `json:"constraints"`
+	Iat           int64                  `json:"iat"`
+	Exp           int64                  `json:"exp"`
+	Nonce         string                 `json:"nonce"`
+	MaxUses       int                    `json:"max_uses,omitempty"`       // executions allowed per nonce; 0 means single-use
+	IntentDigest  string                 `json:"intent_digest,omitempty"`  // hash of the exact params the policy engine evaluated
+	DelegationKey string                 `json:"delegation_key,omitempty"` // Ed25519 public key that signs the first caveat; set on delegable tokens
+	Caveats       []Caveat               `json:"caveats,omitempty"`        // attenuations, outside the issuer's signature
+	Proof         string                 `json:"proof,omitempty"`          // private seed of the last chain key; secret, not signed
+	Kid           string                 `json:"kid,omitempty"`            // signing key ID (Ed25519 keyring); empty for HMAC
+	Signature     string                 `json:"signature"`
+}
+
+// Caveat is one attenuation of a delegable capability token (see policy.Delegate). Each caveat can only
+// narrow the grant: constraints within the parent's, an earlier expiry, a smaller use budget, a delegate
+// subject, an intent binding where the parent has none. It is signed by the previous chain key and names
+// the next one, so a delegate cannot strip caveats it received.
+type Caveat struct {
+	CapID        string                 `json:"cap_id"`
+	Subject      string                 `json:"subject,omitempty"`
+	Constraints  map[string]interface{} `json:"constraints,omitempty"`
+	Exp          int64                  `json:"exp,omitempty"`
+	IntentDigest string                 `json:"intent_digest,omitempty"` // binds an unbound token to one intent
+	MaxUses      int                    `json:"max_uses,omitempty"`      // the delegate's own budget, within every parent's
+	NextKey      string                 `json:"next_key"`
+	Signature    string                 `json:"signature"`
+}
+
+// Approval is a tool intent that policy marked REQUIRE_APPROVAL, queued for a human decision.
+// Intents and Index hold the run's remaining work so the run can resume after the decision.
+type Approval struct {
+	ID        string       `json:"id"`
+	SessionID string       `json:"session_id"`
+	RunID     string       `json:"run_id"`
+	StepID    string       `json:"step_id"`
+	Intent    ToolIntent   `json:"intent"`
+	Reason    string       `json:"reason,omitempty"`
+	Status    string       `json:"status"` // pending, approved, rejected
+	CreatedAt time.Time    `json:"created_at"`
+	DecidedAt *time.Time   `json:"decided_at,omitempty"`
+	DecidedBy string       `json:"decided_by,omitempty"`
+	Note      string       `json:"note,omitempty"`
+	Intents   []ToolIntent `json:"intents"`
+	Index     int          `json:"index"`
 }
 
 // AuditEvent is one entry in the append-only audit log (hash-chained).
@@ -89,5 +138,6 @@ type AuditEvent struct {
 	Type      string                 `json:"type"`
 	Data      map[string]interface{} `json:"data"`
 	PrevHash  string                 `json:"prev_hash"`
+	Canon     string                 `json:"canon,omitempty"` // hash canonicalization: "jcs", or empty for legacy encoding/json
 	Hash      string                 `json:"hash"`
 }
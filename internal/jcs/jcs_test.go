@@ -0,0 +1,64 @@
+package jcs
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestGoldenVectors canonicalizes testdata/input/*.json and compares with testdata/output/*.json
+// byte for byte. The same files are used by the Python and TypeScript verifiers.
+func TestGoldenVectors(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "input", "*.json"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("no golden vectors: %v", err)
+	}
+	for _, in := range inputs {
+		name := filepath.Base(in)
+		t.Run(name, func(t *testing.T) {
+			src, err := os.ReadFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(filepath.Join("testdata", "output", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Transform(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("got  %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+func TestMarshalStructs(t *testing.T) {
+	v := struct {
+		B    string    `json:"b"`
+		A    float64   `json:"a"`
+		When time.Time `json:"when"`
+		Skip string    `json:"skip,omitempty"`
+	}{B: "<x>", A: 1e21, When: time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)}
+	got, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"a":1e+21,"b":"<x>","when":"2024-05-01T12:00:00.0000005Z"}`
+	if string(got) != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestFormatNumberRejectsNonFinite(t *testing.T) {
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := FormatNumber(f); err == nil {
+			t.Fatalf("FormatNumber(%v) should fail", f)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"securetalon/internal/core"
+)
+
+// ErrCapabilityNotFound is returned when a capability is unknown or already expired.
+var ErrCapabilityNotFound = errors.New("capability not found")
+
+// RedactedSignature replaces the signature of recorded tokens.
+const RedactedSignature = "[REDACTED]"
+
+// Capability is an issued token as recorded by the CapabilityStore. The signature and delegation proof
+// are never stored, so listing capabilities cannot leak usable tokens.
+type Capability struct {
+	core.CapabilityToken
+	Parent       string     `json:"parent,omitempty"` // cap_id this capability was delegated from
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy    string     `json:"revoked_by,omitempty"`
+	RevokeReason string     `json:"revoke_reason,omitempty"`
+}
+
+// Revoked reports whether the capability has been revoked.
+func (c *Capability) Revoked() bool {
+	return c.RevokedAt != nil
+}
+
+// CapabilityFilter selects capabilities by session and/or subject; empty fields match all.
+type CapabilityFilter struct {
+	SessionID string
+	Subject   string
+}
+
+func (f CapabilityFilter) match(c *Capability) bool {
+	return (f.SessionID == "" || c.SessionID == f.SessionID) && (f.Subject == "" || c.Subject == f.Subject)
+}
+
+// CapabilityStore records issued capability tokens until they expire and is the revocation list the
+// broker checks on every execution. It persists as a JSON snapshot (e.g. data/policy/capabilities.json)
+// written after every change, so revocations survive a restart.
+type CapabilityStore struct {
+	mu   sync.Mutex
+	path string // empty for in-memory
+	caps map[string]*Capability
+	now  func() time.Time
+}
+
+// NewCapabilityStore loads capabilities from dir/capabilities.json. An empty dir keeps them in memory only.
+func NewCapabilityStore(dir string) (*CapabilityStore, error) {
+	s := &CapabilityStore{caps: make(map[string]*Capability), now: time.Now}
+	if dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s.path = filepath.Join(dir, "capabilities.json")
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	var list []*Capability
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", s.path, err)
+	}
+	for _, c := range list {
+		s.caps[c.CapID] = c
+	}
+	return s, nil
+}
+
+// Record stores a newly issued token (without its signature or delegation proof).
+func (s *CapabilityStore) Record(tok *core.CapabilityToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := &Capability{CapabilityToken: *tok}
+	c.Signature = RedactedSignature
+	c.Proof = ""
+	s.caps[c.CapID] = c
+	return s.saveLocked()
+}
+
+// RecordDelegation stores each caveat of a delegated token that is not yet known as a capability of
+// its own, linked to its parent, so delegates can be listed and revoked individually.
+func (s *CapabilityStore) RecordDelegation(tok *core.CapabilityToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parent, subject, exp := tok.CapID, tok.Subject, tok.Exp
+	added := false
+	for _, cv := range tok.Caveats {
+		if cv.Subject != "" {
+			subject = cv.Subject
+		}
+		if cv.Exp != 0 {
+			exp = cv.Exp
+		}
+		if _, ok := s.caps[cv.CapID]; !ok {
+			c := &Capability{Parent: parent}
+			c.CapID = cv.CapID
+			c.SessionID = tok.SessionID
+			c.Subject = subject
+			c.Tool = tok.Tool
+			c.Constraints = cv.Constraints
+			c.MaxUses = cv.MaxUses
+			c.IntentDigest = cv.IntentDigest
+			c.Iat = s.now().UTC().Unix()
+			c.Exp = exp
+			c.Signature = RedactedSignature
+			s.caps[c.CapID] = c
+			added = true
+		}
+		parent = cv.CapID
+	}
+	if !added {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// IsRevoked reports whether the capability was revoked. Unknown capabilities are not revoked.
+func (s *CapabilityStore) IsRevoked(capID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.caps[capID]
+	return ok && c.Revoked()
+}
+
+// Get returns an unexpired capability.
+func (s *CapabilityStore) Get(capID string) (*Capability, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.caps[capID]
+	if !ok || c.Exp < s.now().UTC().Unix() {
+		return nil, ErrCapabilityNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+// Revoke revokes one capability. Revoking an already revoked capability returns it unchanged.
+func (s *CapabilityStore) Revoke(capID, author, reason string) (*Capability, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.caps[capID]
+	if !ok || c.Exp < s.now().UTC().Unix() {
+		return nil, ErrCapabilityNotFound
+	}
+	if !c.Revoked() {
+		s.revokeLocked(c, author, reason)
+		if err := s.saveLocked(); err != nil {
+			return nil, err
+		}
+	}
+	cp := *c
+	return &cp, nil
+}
+
+// RevokeMatching revokes every outstanding (unexpired, unrevoked) capability that f selects and
+// returns them. Tokens issued later are not affected.
+func (s *CapabilityStore) RevokeMatching(f CapabilityFilter, author, reason string) ([]*Capability, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now().UTC().Unix()
+	out := []*Capability{}
+	for _, c := range s.caps {
+		if c.Revoked() || c.Exp < now || !f.match(c) {
+			continue
+		}
+		s.revokeLocked(c, author, reason)
+		cp := *c
+		out = append(out, &cp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CapID < out[j].CapID })
+	if len(out) == 0 {
+		return out, nil
+	}
+	return out, s.saveLocked()
+}
+
+func (s *CapabilityStore) revokeLocked(c *Capability, author, reason string) {
+	at := s.now().UTC()
+	c.RevokedAt = &at
+	c.RevokedBy = author
+	c.RevokeReason = reason
+}
+
+// List returns the unexpired capabilities that f selects, oldest first.
+func (s *CapabilityStore) List(f CapabilityFilter) []*Capability {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now().UTC().Unix()
+	out := []*Capability{}
+	for _, c := range s.caps {
+		if c.Exp < now || !f.match(c) {
+			continue
+		}
+		cp := *c
+		out = append(out, &cp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Iat != out[j].Iat {
+			return out[i].Iat < out[j].Iat
+		}
+		return out[i].CapID < out[j].CapID
+	})
+	return out
+}
+
+// saveLocked drops expired capabilities and writes the snapshot (temp file + rename). Caller holds s.mu.
+func (s *CapabilityStore) saveLocked() error {
+	now := s.now().UTC().Unix()
+	list := make([]*Capability, 0, len(s.caps))
+	for id, c := range s.caps {
+		if c.Exp < now {
+			delete(s.caps, id)
+			continue
+		}
+		list = append(list, c)
+	}
+	if s.path == "" {
+		return nil
+	}
+	raw, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
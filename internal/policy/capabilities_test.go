@@ -0,0 +1,95 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"securetalon/internal/core"
+)
+
+func TestCapabilityStoreRecordsAndRevokes(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	caps, _ := NewCapabilityStore("")
+	engine.Capabilities = caps
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []interface{}{"/work"}}},
+	}})
+	engine.SetSessionPolicy("sess_2", engine.SessionPolicy("sess_1"))
+	intent := core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/a"}}
+	first := engine.Evaluate(intent, "sess_1").Token
+	second := engine.Evaluate(intent, "sess_1").Token
+	other := engine.Evaluate(intent, "sess_2").Token
+
+	listed := caps.List(CapabilityFilter{SessionID: "sess_1"})
+	if len(listed) != 2 {
+		t.Fatalf("listed %d capabilities for sess_1, want 2", len(listed))
+	}
+	for _, c := range listed {
+		if c.Signature != RedactedSignature {
+			t.Fatalf("signature not redacted: %q", c.Signature)
+		}
+	}
+
+	if _, err := caps.Revoke(first.CapID, "alice", "leaked"); err != nil {
+		t.Fatal(err)
+	}
+	if !caps.IsRevoked(first.CapID) || caps.IsRevoked(second.CapID) {
+		t.Fatal("only the revoked capability should be on the revocation list")
+	}
+	revoked, err := caps.RevokeMatching(CapabilityFilter{SessionID: "sess_1"}, "alice", "session closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revoked) != 1 || revoked[0].CapID != second.CapID {
+		t.Fatalf("bulk revoke returned %+v, want only the outstanding sess_1 token", revoked)
+	}
+	if caps.IsRevoked(other.CapID) {
+		t.Fatal("bulk revoke by session revoked another session's token")
+	}
+	if _, err := caps.Revoke("cap_missing", "alice", ""); err != ErrCapabilityNotFound {
+		t.Fatalf("revoke unknown = %v, want ErrCapabilityNotFound", err)
+	}
+}
+
+func TestCapabilityStorePersistsAndExpires(t *testing.T) {
+	dir := t.TempDir()
+	caps, err := NewCapabilityStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	caps.now = func() time.Time { return now }
+	tok := &core.CapabilityToken{CapID: "cap_1", SessionID: "sess_1", Subject: "agent", Tool: "file.read", Iat: now.Unix(), Exp: now.Unix() + 60, Signature: "secret-sig"}
+	caps.Record(tok)
+	caps.Revoke("cap_1", "admin", "")
+
+	reloaded, err := NewCapabilityStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.IsRevoked("cap_1") {
+		t.Fatal("revocation lost across restart")
+	}
+	reloaded.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if got := reloaded.List(CapabilityFilter{}); len(got) != 0 {
+		t.Fatalf("expired capabilities listed: %+v", got)
+	}
+}
+
+func TestEngineDeniesClosedSession(t *testing.T) {
+	store := core.NewStore()
+	sess, _ := store.CreateSession("demo", nil)
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.Sessions = store
+	engine.SetSessionPolicy(sess.ID, &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []interface{}{"/work"}}},
+	}})
+	intent := core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/a"}}
+	if res := engine.Evaluate(intent, sess.ID); res.Decision != core.DecisionAllow {
+		t.Fatalf("open session: %s %s", res.Decision, res.Reason)
+	}
+	store.CloseSession(sess.ID)
+	if res := engine.Evaluate(intent, sess.ID); res.Decision != core.DecisionDeny || res.Token != nil {
+		t.Fatalf("closed session: %s %s", res.Decision, res.Reason)
+	}
+}
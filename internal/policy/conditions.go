@@ -0,0 +1,118 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"securetalon/internal/core"
+	"securetalon/internal/policy/expr"
+)
+
+// SessionLookup resolves sessions for rule conditions (session.label, session.metadata).
+// core.Store satisfies it.
+type SessionLookup interface {
+	GetSession(id string) *core.Session
+}
+
+// RuleError is a problem with one rule of a policy, reported when the policy is saved or loaded.
+type RuleError struct {
+	Index int    `json:"index"` // 1-based position of the rule
+	Name  string `json:"name,omitempty"`
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// ValidationError lists every invalid rule of a policy.
+type ValidationError struct {
+	Rules []RuleError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Rules))
+	for i, r := range e.Rules {
+		parts[i] = fmt.Sprintf("rule #%d %s: %s", r.Index, r.Field, r.Error)
+	}
+	return "invalid policy: " + strings.Join(parts, "; ")
+}
+
+// ValidateRules compiles every rule condition and checks timezones, limits, max_uses and ttl_seconds so that errors are rejected up front.
+// Returns nil or a *ValidationError.
+func ValidateRules(rules []RuleOverride) error {
+	var errs []RuleError
+	for i, r := range rules {
+		if r.When != "" {
+			if _, err := expr.Compile(r.When); err != nil {
+				errs = append(errs, RuleError{Index: i + 1, Name: r.Name, Field: "when", Error: err.Error()})
+			}
+		}
+		if r.Timezone != "" {
+			if _, err := time.LoadLocation(r.Timezone); err != nil {
+				errs = append(errs, RuleError{Index: i + 1, Name: r.Name, Field: "timezone", Error: err.Error()})
+			}
+		}
+		if r.MaxUses < 0 {
+			errs = append(errs, RuleError{Index: i + 1, Name: r.Name, Field: "max_uses", Error: "max_uses must not be negative"})
+		}
+		if r.TTLSeconds < 0 {
+			errs = append(errs, RuleError{Index: i + 1, Name: r.Name, Field: "ttl_seconds", Error: "ttl_seconds must not be negative"})
+		}
+		for j, l := range r.Limits {
+			if msg := l.validate(); msg != "" {
+				errs = append(errs, RuleError{Index: i + 1, Name: r.Name, Field: fmt.Sprintf("limits[%d]", j), Error: msg})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Rules: errs}
+	}
+	return nil
+}
+
+// program returns the compiled condition for src, compiling it once per distinct source.
+func (e *Engine) program(src string) (*expr.Program, error) {
+	if p, ok := e.programs.Load(src); ok {
+		return p.(*expr.Program), nil
+	}
+	p, err := expr.Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	e.programs.Store(src, p)
+	return p, nil
+}
+
+// condition evaluates the rule's when expression for the intent. A rule without one always holds.
+// Callers fail closed on error: a deny rule applies, an allow rule does not.
+func (e *Engine) condition(r RuleOverride, intent core.ToolIntent, sessionID string) (bool, error) {
+	if r.When == "" {
+		return true, nil
+	}
+	p, err := e.program(r.When)
+	if err != nil {
+		return false, err
+	}
+	loc := time.UTC
+	if r.Timezone != "" {
+		if loc, err = time.LoadLocation(r.Timezone); err != nil {
+			return false, err
+		}
+	}
+	env := expr.Env{
+		Tool:      intent.Tool,
+		Subject:   intent.Subject,
+		Params:    intent.Params,
+		SessionID: sessionID,
+		Now:       time.Now().In(loc),
+	}
+	if env.Subject == "" {
+		env.Subject = "agent"
+	}
+	if e.Sessions != nil {
+		if s := e.Sessions.GetSession(sessionID); s != nil {
+			env.SessionLabel = s.Label
+			env.SessionMetadata = s.Metadata
+		}
+	}
+	return p.Eval(env)
+}
@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Constraint values arrive as []string from Go callers and []interface{} / float64 from JSON.
+// These helpers accept both.
+
+func stringList(v interface{}) ([]string, bool) {
+	switch vv := v.(type) {
+	case []string:
+		return vv, true
+	case []interface{}:
+		out := make([]string, 0, len(vv))
+		for _, x := range vv {
+			if s, ok := x.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func toInterfaceList(ss []string) []interface{} {
+	out := make([]interface{}, len(ss))
+	for i, s := range ss {
+		out[i] = s
+	}
+	return out
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// pathUnderRoot reports whether the cleaned path equals root or lies beneath it.
+func pathUnderRoot(path, root string) bool {
+	if root == "" || path == "" {
+		return false
+	}
+	path = filepath.ToSlash(filepath.Clean(path))
+	root = filepath.ToSlash(filepath.Clean(root))
+	if path == root || root == "/" {
+		return true
+	}
+	return strings.HasPrefix(path, root+"/")
+}
+
+// domainUnder reports whether host equals domain or is a subdomain of it (case-insensitive).
+func domainUnder(host, domain string) bool {
+	host = strings.ToLower(host)
+	domain = strings.ToLower(domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// ContentTypeAllowed reports whether mediaType (parameters such as charset are ignored) matches one
+// of allowed: an exact type, "type/*" or "*/*", case-insensitive.
+func ContentTypeAllowed(mediaType string, allowed []string) bool {
+	mediaType = strings.ToLower(strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0]))
+	major := strings.SplitN(mediaType, "/", 2)[0]
+	for _, a := range allowed {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a == mediaType || a == "*/*" || a == major+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtensionAllowed reports whether path's extension is one of allowed (case-insensitive, with or
+// without the leading dot). A path without an extension matches only "" or ".".
+func ExtensionAllowed(path string, allowed []string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, a := range allowed {
+		if normalizeExt(a) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext == "" || ext == "." {
+		return ""
+	}
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+func copyConstraints(c map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(c))
+	for k, v := range c {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,293 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limit is a rate or quota on an allow rule, e.g. at most 30 calls per hour per session or
+// 10 MB of file.write content per run. Usage is counted per rule and session, and also per run for
+// Per "run" or per intent subject for Per "subject" (the subject is caller-supplied, so it never splits
+// a session or run quota); an intent that would exceed the limit is denied with the time the quota resets.
+type Limit struct {
+	Max    float64 `json:"max"`
+	Metric string  `json:"metric,omitempty"` // calls (default) or bytes (size of params.content)
+	Window string  `json:"window,omitempty"` // minute, hour or day (clock-aligned, UTC); empty never resets
+	Per    string  `json:"per,omitempty"`    // session (default), run or subject
+}
+
+// Limit metrics, windows and scopes.
+const (
+	MetricCalls = "calls"
+	MetricBytes = "bytes"
+	PerSession  = "session"
+	PerRun      = "run"
+	PerSubject  = "subject"
+)
+
+var limitWindows = map[string]time.Duration{"": 0, "minute": time.Minute, "hour": time.Hour, "day": 24 * time.Hour}
+
+func (l Limit) metric() string {
+	if l.Metric == "" {
+		return MetricCalls
+	}
+	return l.Metric
+}
+
+func (l Limit) per() string {
+	if l.Per == "" {
+		return PerSession
+	}
+	return l.Per
+}
+
+// validate reports the first problem with the limit, or "".
+func (l Limit) validate() string {
+	switch {
+	case l.Max <= 0:
+		return "max must be positive"
+	case l.metric() != MetricCalls && l.metric() != MetricBytes:
+		return fmt.Sprintf("unknown metric %q (calls, bytes)", l.Metric)
+	case l.per() != PerSession && l.per() != PerRun && l.per() != PerSubject:
+		return fmt.Sprintf("unknown per %q (session, run, subject)", l.Per)
+	}
+	if _, ok := limitWindows[l.Window]; !ok {
+		return fmt.Sprintf("unknown window %q (minute, hour, day)", l.Window)
+	}
+	return ""
+}
+
+// cost is what one intent adds to the counter.
+func (l Limit) cost(params map[string]interface{}) float64 {
+	if l.metric() == MetricBytes {
+		size, _, _ := contentInfo(params)
+		return float64(size)
+	}
+	return 1
+}
+
+// describe renders the limit for reasons, e.g. "30 calls per hour per session".
+func (l Limit) describe() string {
+	s := fmt.Sprintf("%.0f %s", l.Max, l.metric())
+	if l.Window != "" {
+		s += " per " + l.Window
+	}
+	return s + " per " + l.per()
+}
+
+// Counter is the usage of one limit for one session (and run or subject) in the current window.
+type Counter struct {
+	SessionID   string    `json:"session_id"`
+	Subject     string    `json:"subject,omitempty"` // Per "subject" only
+	Tool        string    `json:"tool"`
+	Rule        string    `json:"rule"`             // stable identity of the rule (see candidate.quotaKey)
+	Limit       int       `json:"limit"`            // 1-based index within the rule's limits
+	RunID       string    `json:"run_id,omitempty"` // Per "run" only
+	Metric      string    `json:"metric"`
+	Window      string    `json:"window,omitempty"`
+	WindowStart time.Time `json:"window_start,omitempty"`
+	ResetAt     time.Time `json:"reset_at,omitempty"` // zero when the limit has no window
+	Used        float64   `json:"used"`
+	Max         float64   `json:"max"`
+}
+
+func (c *Counter) key() string {
+	return fmt.Sprintf("%s|%s|%s|%s|%d|%s|%d", c.SessionID, c.Subject, c.Tool, c.Rule, c.Limit, c.RunID, c.WindowStart.Unix())
+}
+
+// resetText says when the counter starts over.
+func (c *Counter) resetText() string {
+	switch {
+	case !c.ResetAt.IsZero():
+		return "resets at " + c.ResetAt.Format(time.RFC3339)
+	case c.RunID != "":
+		return "resets when a new run starts"
+	}
+	return "does not reset for this session"
+}
+
+// CounterStore holds limit counters and persists them as a JSON snapshot (e.g. data/policy/counters.json)
+// written after every change, so quotas survive a restart. Counters of expired windows are dropped.
+type CounterStore struct {
+	mu       sync.Mutex
+	path     string // empty for in-memory
+	counters map[string]*Counter
+	now      func() time.Time
+}
+
+// NewCounterStore loads counters from dir/counters.json. An empty dir keeps counters in memory only.
+func NewCounterStore(dir string) (*CounterStore, error) {
+	s := &CounterStore{counters: make(map[string]*Counter), now: time.Now}
+	if dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s.path = filepath.Join(dir, "counters.json")
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	var list []*Counter
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", s.path, err)
+	}
+	for _, c := range list {
+		s.counters[c.key()] = c
+	}
+	return s, nil
+}
+
+// counter returns the (unsaved) counter for a limit at the current time. Caller holds s.mu.
+func (s *CounterStore) counter(sessionID, subject, tool, rule, runID string, index int, l Limit) *Counter {
+	c := &Counter{
+		SessionID: sessionID, Tool: tool, Rule: rule, Limit: index,
+		Metric: l.metric(), Window: l.Window, Max: l.Max,
+	}
+	switch l.per() {
+	case PerRun:
+		c.RunID = runID
+	case PerSubject:
+		c.Subject = subject
+	}
+	if d := limitWindows[l.Window]; d > 0 {
+		now := s.now().UTC()
+		c.WindowStart = now.Truncate(d)
+		c.ResetAt = c.WindowStart.Add(d)
+	}
+	if existing, ok := s.counters[c.key()]; ok {
+		c.Used = existing.Used
+	}
+	return c
+}
+
+// quotaCheck is one limit of a rule to check or consume.
+type quotaCheck struct {
+	index int
+	limit Limit
+	cost  float64
+}
+
+// exceeded returns the first counter that cost would push over its limit, or nil.
+func (s *CounterStore) exceeded(sessionID, subject, tool, rule, runID string, checks []quotaCheck) *Counter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exceededLocked(sessionID, subject, tool, rule, runID, checks)
+}
+
+func (s *CounterStore) exceededLocked(sessionID, subject, tool, rule, runID string, checks []quotaCheck) *Counter {
+	for _, q := range checks {
+		c := s.counter(sessionID, subject, tool, rule, runID, q.index, q.limit)
+		if c.Used+q.cost > c.Max {
+			return c
+		}
+	}
+	return nil
+}
+
+// consume atomically re-checks every limit and, if none would be exceeded, adds the costs.
+// Returns the exceeded counter (and consumes nothing) otherwise.
+func (s *CounterStore) consume(sessionID, subject, tool, rule, runID string, checks []quotaCheck) (*Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c := s.exceededLocked(sessionID, subject, tool, rule, runID, checks); c != nil {
+		return c, nil
+	}
+	for _, q := range checks {
+		c := s.counter(sessionID, subject, tool, rule, runID, q.index, q.limit)
+		c.Used += q.cost
+		s.counters[c.key()] = c
+	}
+	return nil, s.saveLocked()
+}
+
+// saveLocked drops expired counters and writes the snapshot (temp file + rename). Caller holds s.mu.
+func (s *CounterStore) saveLocked() error {
+	now := s.now().UTC()
+	for k, c := range s.counters {
+		if !c.ResetAt.IsZero() && !now.Before(c.ResetAt) {
+			delete(s.counters, k)
+		}
+	}
+	if s.path == "" {
+		return nil
+	}
+	raw, err := json.Marshal(s.listLocked(""))
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// DropRun removes the per-run counters of a finished run, which can no longer be used.
+func (s *CounterStore) DropRun(runID string) error {
+	if runID == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := false
+	for k, c := range s.counters {
+		if c.RunID == runID {
+			delete(s.counters, k)
+			dropped = true
+		}
+	}
+	if !dropped {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// List returns the counters of the current windows, optionally for one session.
+func (s *CounterStore) List(sessionID string) []*Counter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listLocked(sessionID)
+}
+
+func (s *CounterStore) listLocked(sessionID string) []*Counter {
+	now := s.now().UTC()
+	out := []*Counter{}
+	for _, c := range s.counters {
+		if sessionID != "" && c.SessionID != sessionID {
+			continue
+		}
+		if !c.ResetAt.IsZero() && !now.Before(c.ResetAt) {
+			continue
+		}
+		cp := *c
+		out = append(out, &cp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].key() < out[j].key() })
+	return out
+}
+
+// quotaChecks lists the limits of rule r with the cost of intent params.
+func quotaChecks(r RuleOverride, params map[string]interface{}) []quotaCheck {
+	checks := make([]quotaCheck, len(r.Limits))
+	for i, l := range r.Limits {
+		checks[i] = quotaCheck{index: i + 1, limit: l, cost: l.cost(params)}
+	}
+	return checks
+}
+
+func quotaExceeded(c *Counter, l Limit) *violation {
+	return &violation{
+		fmt.Sprintf("quota exceeded: %.0f of %s used; %s", c.Used, l.describe(), c.resetText()),
+		"Wait for the quota to reset or raise the rule's limit",
+	}
+}
@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"securetalon/internal/core"
+)
+
+func TestRateLimitDeniesUntilWindowResets(t *testing.T) {
+	dir := t.TempDir()
+	counters, err := NewCounterStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 3, 5, 14, 20, 0, 0, time.UTC)
+	counters.now = func() time.Time { return now }
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.Counters = counters
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "http.fetch", Allow: true, Limits: []Limit{{Max: 2, Window: "hour"}},
+			Constraints: map[string]interface{}{"domains": []string{"api.example.com"}}},
+	}})
+	intent := core.ToolIntent{Tool: "http.fetch", Params: map[string]interface{}{"url": "https://api.example.com/x"}}
+	for i := 0; i < 2; i++ {
+		if r := engine.Evaluate(intent, "sess_1"); r.Decision != core.DecisionAllow {
+			t.Fatalf("call %d: expected ALLOW, got %s: %s", i+1, r.Decision, r.Reason)
+		}
+	}
+	r := engine.Evaluate(intent, "sess_1")
+	if r.Decision != core.DecisionDeny || !strings.Contains(r.Reason, "resets at 2024-03-05T15:00:00Z") {
+		t.Fatalf("expected quota DENY with reset time, got %s: %s", r.Decision, r.Reason)
+	}
+	// Another session has its own counter
+	engine.SetSessionPolicy("sess_2", engine.SessionPolicy("sess_1"))
+	if r := engine.Evaluate(intent, "sess_2"); r.Decision != core.DecisionAllow {
+		t.Fatalf("expected other session allowed, got %s", r.Decision)
+	}
+
+	// Counters survive a restart
+	reloaded, err := NewCounterStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded.now = func() time.Time { return now }
+	engine.Counters = reloaded
+	if list := reloaded.List("sess_1"); len(list) != 1 || list[0].Used != 2 {
+		t.Fatalf("expected persisted counter with 2 uses, got %+v", list)
+	}
+	if r := engine.Evaluate(intent, "sess_1"); r.Decision != core.DecisionDeny {
+		t.Fatalf("expected DENY after restart, got %s", r.Decision)
+	}
+
+	// Next window
+	now = now.Add(time.Hour)
+	if r := engine.Evaluate(intent, "sess_1"); r.Decision != core.DecisionAllow {
+		t.Fatalf("expected ALLOW in the next window, got %s: %s", r.Decision, r.Reason)
+	}
+}
+
+func TestByteQuotaPerRun(t *testing.T) {
+	counters, _ := NewCounterStore("")
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.Counters = counters
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "file.write", Allow: true, Limits: []Limit{{Max: 10, Metric: MetricBytes, Per: PerRun}},
+			Constraints: map[string]interface{}{"roots": []string{"/work"}}},
+	}})
+	write := func(content string) core.ToolIntent {
+		return core.ToolIntent{Tool: "file.write", Params: map[string]interface{}{"path": "/work/a", "content": content}}
+	}
+	if r := engine.EvaluateForRun(write("123456"), "sess_1", "run_1", false); r.Decision != core.DecisionAllow {
+		t.Fatalf("expected ALLOW, got %s", r.Decision)
+	}
+	r := engine.EvaluateForRun(write("123456"), "sess_1", "run_1", false)
+	if r.Decision != core.DecisionDeny || !strings.Contains(r.Reason, "new run") {
+		t.Fatalf("expected byte quota DENY, got %s: %s", r.Decision, r.Reason)
+	}
+	if r := engine.EvaluateForRun(write("123456"), "sess_1", "run_2", false); r.Decision != core.DecisionAllow {
+		t.Fatalf("expected a new run to get a fresh quota, got %s", r.Decision)
+	}
+}
+
+func TestInvalidLimitAndTimezoneRejected(t *testing.T) {
+	err := ValidateRules([]RuleOverride{
+		{Tool: "http.fetch", Allow: true, Limits: []Limit{{Max: 0}, {Max: 1, Window: "fortnight"}}},
+		{Tool: "docker.run", Allow: true, Timezone: "Mars/Olympus"},
+	})
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Rules) != 3 {
+		t.Fatalf("expected 3 rule errors, got %v", err)
+	}
+}
+
+func TestSessionQuotaIgnoresSubject(t *testing.T) {
+	counters, _ := NewCounterStore("")
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.Counters = counters
+	rule := RuleOverride{Tool: "http.fetch", Allow: true, Limits: []Limit{{Max: 2}},
+		Constraints: map[string]interface{}{"domains": []string{"api.example.com"}}}
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{rule}})
+	fetch := func(subject string) core.ToolIntent {
+		return core.ToolIntent{Tool: "http.fetch", Subject: subject, Params: map[string]interface{}{"url": "https://api.example.com/x"}}
+	}
+	engine.Evaluate(fetch("alice"), "sess_1")
+	engine.Evaluate(fetch("bob"), "sess_1")
+	if r := engine.Evaluate(fetch("mallory"), "sess_1"); r.Decision != core.DecisionDeny {
+		t.Fatalf("a new subject must not get a fresh session quota, got %s", r.Decision)
+	}
+
+	// Per "subject" counts each subject separately
+	rule.Limits = []Limit{{Max: 1, Per: PerSubject}}
+	engine.SetSessionPolicy("sess_2", &SessionPolicy{Overrides: []RuleOverride{rule}})
+	if r := engine.Evaluate(fetch("alice"), "sess_2"); r.Decision != core.DecisionAllow {
+		t.Fatalf("expected ALLOW for alice, got %s", r.Decision)
+	}
+	if r := engine.Evaluate(fetch("alice"), "sess_2"); r.Decision != core.DecisionDeny {
+		t.Fatalf("expected alice's quota used up, got %s", r.Decision)
+	}
+	if r := engine.Evaluate(fetch("bob"), "sess_2"); r.Decision != core.DecisionAllow {
+		t.Fatalf("expected bob to have his own quota, got %s", r.Decision)
+	}
+}
+
+func TestQuotaSurvivesRuleReordering(t *testing.T) {
+	counters, _ := NewCounterStore("")
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.Counters = counters
+	limited := RuleOverride{Tool: "http.fetch", Allow: true, Limits: []Limit{{Max: 1}},
+		Constraints: map[string]interface{}{"domains": []string{"api.example.com"}}}
+	other := RuleOverride{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work"}}}
+	intent := core.ToolIntent{Tool: "http.fetch", Params: map[string]interface{}{"url": "https://api.example.com/x"}}
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{limited}})
+	if r := engine.Evaluate(intent, "sess_1"); r.Decision != core.DecisionAllow {
+		t.Fatalf("expected ALLOW, got %s", r.Decision)
+	}
+	// Inserting a rule before the limited one moves it to session#2 but keeps its counter
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{other, limited}})
+	if r := engine.Evaluate(intent, "sess_1"); r.Decision != core.DecisionDeny {
+		t.Fatalf("expected the quota to follow the rule, got %s", r.Decision)
+	}
+}
+
+func TestDropRunRemovesRunCounters(t *testing.T) {
+	counters, _ := NewCounterStore(t.TempDir())
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.Counters = counters
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "http.fetch", Allow: true, Limits: []Limit{{Max: 5, Per: PerRun}, {Max: 5}},
+			Constraints: map[string]interface{}{"domains": []string{"api.example.com"}}},
+	}})
+	intent := core.ToolIntent{Tool: "http.fetch", Params: map[string]interface{}{"url": "https://api.example.com/x"}}
+	engine.EvaluateForRun(intent, "sess_1", "run_1", false)
+	if n := len(counters.List("sess_1")); n != 2 {
+		t.Fatalf("expected a run and a session counter, got %d", n)
+	}
+	if err := counters.DropRun("run_1"); err != nil {
+		t.Fatal(err)
+	}
+	list := counters.List("sess_1")
+	if len(list) != 1 || list[0].RunID != "" {
+		t.Fatalf("expected only the session counter left, got %+v", list)
+	}
+}
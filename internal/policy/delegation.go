@@ -0,0 +1,368 @@
+package policy
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"securetalon/internal/core"
+	"securetalon/internal/jcs"
+)
+
+// ErrNotDelegable is returned when delegating a token that was not issued with a delegation key.
+var ErrNotDelegable = errors.New("capability token is not delegable")
+
+// MaxCaveats bounds the length of a delegation chain.
+const MaxCaveats = 8
+
+// reIntentDigest matches the output of IntentDigest.
+var reIntentDigest = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// Delegation is the narrower grant a token holder hands to a sub-agent.
+type Delegation struct {
+	Subject     string                 // delegate identity; empty keeps the parent's subject
+	Constraints map[string]interface{} // must lie within the parent's effective constraints
+	TTLSeconds  int64                  // 0 keeps the parent's expiry; never extends it
+	// IntentDigest binds the delegate to one intent (see IntentDigest) when the parent is not bound
+	// yet; empty keeps the parent's binding. A bound parent's digest can only be repeated, never
+	// replaced, since the policy engine evaluated that intent and no other.
+	IntentDigest string
+	// MaxUses is the delegate's own use budget, at most the parent's effective one (see
+	// EffectiveMaxUses); 0 keeps the parent's. Every use also counts against each parent's budget.
+	MaxUses int
+}
+
+// Delegation tokens are macaroon-style: a delegable token carries the public half of a fresh Ed25519
+// key (DelegationKey, covered by the issuer's signature) and its holder keeps the private half (Proof).
+// Each caveat is signed with the current chain key over the previous signature and names the next
+// key, whose private half replaces Proof in the attenuated token. A delegate can therefore append
+// caveats but cannot remove or edit the ones it received, and only the holder of the last key can
+// present the token. Caveats never widen the grant (see NarrowConstraints) or the use budget, and
+// never change the intent a token is bound to.
+
+// newDelegationKey generates a chain key and returns its public half and private seed, both base64.
+func newDelegationKey() (pub, seed string, err error) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(pk), base64.StdEncoding.EncodeToString(sk.Seed()), nil
+}
+
+// Delegate returns a copy of tok attenuated by d and carrying the proof for the new caveat's key.
+// The caller must hold tok's proof. The parent token is not modified and stays valid.
+func Delegate(tok *core.CapabilityToken, d Delegation) (*core.CapabilityToken, error) {
+	if tok == nil || tok.DelegationKey == "" {
+		return nil, ErrNotDelegable
+	}
+	if len(tok.Caveats) >= MaxCaveats {
+		return nil, fmt.Errorf("delegation chain longer than %d caveats", MaxCaveats)
+	}
+	signer, err := proofKey(tok.Proof)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := EffectiveConstraints(tok)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := NarrowConstraints(parent, d.Constraints); err != nil {
+		return nil, err
+	}
+	if d.MaxUses < 0 || d.MaxUses > EffectiveMaxUses(tok) {
+		return nil, fmt.Errorf("max_uses must be between 0 and the parent's %d", EffectiveMaxUses(tok))
+	}
+	if d.IntentDigest != "" {
+		if !reIntentDigest.MatchString(d.IntentDigest) {
+			return nil, fmt.Errorf("intent_digest must be sha256:<64 hex digits>")
+		}
+		if bound := EffectiveIntentDigest(tok); bound != "" && bound != d.IntentDigest {
+			return nil, fmt.Errorf("token is bound to another intent")
+		}
+	}
+	exp := effectiveExp(tok)
+	if d.TTLSeconds > 0 {
+		if e := time.Now().UTC().Unix() + d.TTLSeconds; e < exp {
+			exp = e
+		}
+	}
+	next, seed, err := newDelegationKey()
+	if err != nil {
+		return nil, err
+	}
+	c := core.Caveat{
+		CapID:        core.NewCapID(),
+		Subject:      d.Subject,
+		Constraints:  d.Constraints,
+		Exp:          exp,
+		IntentDigest: d.IntentDigest,
+		MaxUses:      d.MaxUses,
+		NextKey:      next,
+	}
+	payload, err := caveatPayload(chainParent(tok, len(tok.Caveats)), c)
+	if err != nil {
+		return nil, err
+	}
+	c.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(signer, payload))
+	out := *tok
+	out.Caveats = append(append([]core.Caveat{}, tok.Caveats...), c)
+	out.Proof = seed
+	return &out, nil
+}
+
+// verifyChain checks every caveat signature and expiry (against now, leeway already applied) and that
+// Proof matches the last chain key. Tokens without a delegation key must not carry caveats.
+func verifyChain(tok *core.CapabilityToken, now int64) error {
+	if tok.DelegationKey == "" {
+		if len(tok.Caveats) > 0 {
+			return ErrNotDelegable
+		}
+		return nil
+	}
+	if len(tok.Caveats) > MaxCaveats {
+		return fmt.Errorf("delegation chain longer than %d caveats", MaxCaveats)
+	}
+	key, err := chainKey(tok.DelegationKey)
+	if err != nil {
+		return err
+	}
+	for i, c := range tok.Caveats {
+		sig, err := base64.StdEncoding.DecodeString(c.Signature)
+		if err != nil {
+			return fmt.Errorf("caveat %d: invalid signature", i+1)
+		}
+		payload, err := caveatPayload(chainParent(tok, i), c)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(key, payload, sig) {
+			return fmt.Errorf("caveat %d: invalid signature", i+1)
+		}
+		if c.Exp != 0 && c.Exp < now {
+			return fmt.Errorf("caveat %d: expired", i+1)
+		}
+		if key, err = chainKey(c.NextKey); err != nil {
+			return fmt.Errorf("caveat %d: %w", i+1, err)
+		}
+	}
+	signer, err := proofKey(tok.Proof)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(signer.Public().(ed25519.PublicKey), key) {
+		return fmt.Errorf("delegation proof does not match the chain")
+	}
+	return nil
+}
+
+// EffectiveConstraints folds the caveats of tok into its constraints, checking that each caveat only
+// narrows its parent (constraints, expiry, use budget and intent binding). Signatures are checked by
+// Verifier.Verify.
+func EffectiveConstraints(tok *core.CapabilityToken) (map[string]interface{}, error) {
+	constraints := tok.Constraints
+	exp := tok.Exp
+	uses := tokenMaxUses(tok)
+	digest := tok.IntentDigest
+	for i, c := range tok.Caveats {
+		if c.IntentDigest != "" {
+			if digest != "" && c.IntentDigest != digest {
+				return nil, fmt.Errorf("caveat %d: intent_digest re-binds the parent grant", i+1)
+			}
+			digest = c.IntentDigest
+		}
+		narrowed, err := NarrowConstraints(constraints, c.Constraints)
+		if err != nil {
+			return nil, fmt.Errorf("caveat %d: %w", i+1, err)
+		}
+		if c.Exp > exp {
+			return nil, fmt.Errorf("caveat %d: expiry extends the parent grant", i+1)
+		}
+		if c.MaxUses < 0 || c.MaxUses > uses {
+			return nil, fmt.Errorf("caveat %d: max_uses extends the parent grant", i+1)
+		}
+		if c.MaxUses > 0 {
+			uses = c.MaxUses
+		}
+		if c.Exp != 0 {
+			exp = c.Exp
+		}
+		constraints = narrowed
+	}
+	return constraints, nil
+}
+
+// NarrowConstraints applies a caveat's constraints to parent and returns the result. roots, domains,
+// methods, images, modes, extensions and content_types must each lie within an entry of the parent's
+// list (or replace an absent one); max_bytes and max_entries may only decrease; forbidden_domains are
+// added; follow_symlinks may only be turned off. Any other key must repeat the parent's value exactly,
+// so a caveat cannot introduce a constraint whose meaning could widen the grant.
+func NarrowConstraints(parent, caveat map[string]interface{}) (map[string]interface{}, error) {
+	out := copyConstraints(parent)
+	keys := make([]string, 0, len(caveat))
+	for k := range caveat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val := caveat[key]
+		cur, has := parent[key]
+		switch key {
+		case "max_bytes", "max_entries":
+			n, ok := number(val)
+			if !ok || n <= 0 {
+				return nil, fmt.Errorf("%s must be a positive number", key)
+			}
+			if lim, ok := number(cur); has && ok && lim > 0 && n > lim {
+				return nil, fmt.Errorf("%s %.0f exceeds the parent's %.0f", key, n, lim)
+			}
+			out[key] = n
+		case "roots", "domains", "methods", "images", "modes", "extensions", "content_types":
+			wanted, ok := stringList(val)
+			if !ok || len(wanted) == 0 {
+				return nil, fmt.Errorf("%s must be a non-empty list", key)
+			}
+			if has {
+				allowed, _ := stringList(cur)
+				for _, w := range wanted {
+					if !withinAny(key, w, allowed) {
+						return nil, fmt.Errorf("%s entry %q is outside the parent grant", key, w)
+					}
+				}
+			}
+			out[key] = toInterfaceList(wanted)
+		case "forbidden_domains":
+			added, ok := stringList(val)
+			if !ok {
+				return nil, fmt.Errorf("forbidden_domains must be a list")
+			}
+			existing, _ := stringList(cur)
+			out[key] = toInterfaceList(mergeUnique(existing, added))
+		case "follow_symlinks":
+			follow, ok := val.(bool)
+			if !ok {
+				return nil, fmt.Errorf("follow_symlinks must be a boolean")
+			}
+			if allowed, _ := cur.(bool); follow && !allowed {
+				return nil, fmt.Errorf("follow_symlinks is not allowed by the parent grant")
+			}
+			out[key] = follow
+		default:
+			if !has || !sameValue(cur, val) {
+				return nil, fmt.Errorf("caveat cannot set constraint %q", key)
+			}
+		}
+	}
+	return out, nil
+}
+
+func withinAny(key, value string, allowed []string) bool {
+	for _, a := range allowed {
+		if withinCeiling(key, value, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameValue compares constraint values by their canonical JSON, so []string and []interface{}
+// (or int and float64) holding the same data are equal.
+func sameValue(a, b interface{}) bool {
+	ca, errA := jcs.Marshal(a)
+	cb, errB := jcs.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ca, cb)
+}
+
+// EffectiveIntentDigest is the token's intent binding, else that of the first caveat that sets one.
+// Later caveats can only repeat it (see EffectiveConstraints).
+func EffectiveIntentDigest(tok *core.CapabilityToken) string {
+	if tok.IntentDigest != "" {
+		return tok.IntentDigest
+	}
+	for _, c := range tok.Caveats {
+		if c.IntentDigest != "" {
+			return c.IntentDigest
+		}
+	}
+	return ""
+}
+
+// EffectiveMaxUses is the smallest use budget along the chain: the token's max_uses or a caveat's.
+// The broker also counts each use against every parent's budget.
+func EffectiveMaxUses(tok *core.CapabilityToken) int {
+	uses := tokenMaxUses(tok)
+	for _, c := range tok.Caveats {
+		if c.MaxUses > 0 && c.MaxUses < uses {
+			uses = c.MaxUses
+		}
+	}
+	return uses
+}
+
+// tokenMaxUses is the token's own max_uses; 0 means single use.
+func tokenMaxUses(tok *core.CapabilityToken) int {
+	if tok.MaxUses > 1 {
+		return tok.MaxUses
+	}
+	return 1
+}
+
+// effectiveExp is the expiry of the last caveat that sets one, else the token's.
+func effectiveExp(tok *core.CapabilityToken) int64 {
+	exp := tok.Exp
+	for _, c := range tok.Caveats {
+		if c.Exp != 0 && c.Exp < exp {
+			exp = c.Exp
+		}
+	}
+	return exp
+}
+
+// chainParent is the signature caveat i is chained to: the token's for the first caveat, else the
+// previous caveat's.
+func chainParent(tok *core.CapabilityToken, i int) string {
+	if i == 0 {
+		return tok.Signature
+	}
+	return tok.Caveats[i-1].Signature
+}
+
+// caveatPayload is the signed payload of a caveat: its fields except the signature plus the parent
+// signature, canonicalized with JCS.
+func caveatPayload(parentSig string, c core.Caveat) ([]byte, error) {
+	payload := struct {
+		Parent       string                 `json:"parent"`
+		CapID        string                 `json:"cap_id"`
+		Subject      string                 `json:"subject,omitempty"`
+		Constraints  map[string]interface{} `json:"constraints,omitempty"`
+		Exp          int64                  `json:"exp,omitempty"`
+		IntentDigest string                 `json:"intent_digest,omitempty"`
+		MaxUses      int                    `json:"max_uses,omitempty"`
+		NextKey      string                 `json:"next_key"`
+	}{parentSig, c.CapID, c.Subject, c.Constraints, c.Exp, c.IntentDigest, c.MaxUses, c.NextKey}
+	return jcs.Marshal(payload)
+}
+
+func chainKey(s string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid delegation key")
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+func proofKey(s string) (ed25519.PrivateKey, error) {
+	if s == "" {
+		return nil, fmt.Errorf("delegation proof required")
+	}
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(raw) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid delegation proof")
+	}
+	return ed25519.NewKeyFromSeed(raw), nil
+}
@@ -0,0 +1,211 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"securetalon/internal/core"
+)
+
+func delegableGrant() Grant {
+	return Grant{
+		SessionID:   "sess_1",
+		Subject:     "orchestrator",
+		Tool:        "file.read",
+		Constraints: map[string]interface{}{"roots": []interface{}{"/work"}, "max_bytes": float64(1000)},
+		TTLSeconds:  60,
+		Delegable:   true,
+	}
+}
+
+func TestDelegateNarrowsAndVerifies(t *testing.T) {
+	issuer, verifier := NewIssuer("secret"), NewVerifier("secret")
+	root, err := issuer.IssueGrant(delegableGrant())
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := Delegate(root, Delegation{
+		Subject:     "worker-1",
+		Constraints: map[string]interface{}{"roots": []string{"/work/src"}, "max_bytes": 100},
+		TTLSeconds:  30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	grandchild, err := Delegate(child, Delegation{Subject: "worker-1a", Constraints: map[string]interface{}{"roots": []string{"/work/src/pkg"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(grandchild); err != nil {
+		t.Fatalf("verify delegated token: %v", err)
+	}
+	eff, err := EffectiveConstraints(grandchild)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, _ := stringList(eff["roots"])
+	if len(roots) != 1 || roots[0] != "/work/src/pkg" || eff["max_bytes"] != float64(100) {
+		t.Fatalf("effective constraints = %v", eff)
+	}
+	if root.Caveats != nil || child.Proof == root.Proof || grandchild.Caveats[0].Exp > root.Exp {
+		t.Fatal("delegation must copy the parent, rotate the proof and keep expiry within the parent's")
+	}
+}
+
+func TestDelegateRejectsBroadening(t *testing.T) {
+	issuer := NewIssuer("secret")
+	root, _ := issuer.IssueGrant(delegableGrant())
+	cases := []map[string]interface{}{
+		{"roots": []string{"/etc"}},
+		{"roots": []string{"/workspace"}},
+		{"roots": []string{}},
+		{"max_bytes": 5000},
+		{"follow_symlinks": true},
+	}
+	for _, c := range cases {
+		if _, err := Delegate(root, Delegation{Constraints: c}); err == nil {
+			t.Errorf("Delegate(%v) succeeded, want error", c)
+		}
+	}
+
+	plain, _ := issuer.Issue("sess_1", "agent", "file.read", map[string]interface{}{"roots": []string{"/work"}}, 60)
+	if _, err := Delegate(plain, Delegation{}); !errors.Is(err, ErrNotDelegable) {
+		t.Fatalf("non-delegable token: got %v", err)
+	}
+}
+
+func TestVerifyRejectsTamperedChain(t *testing.T) {
+	issuer, verifier := NewIssuer("secret"), NewVerifier("secret")
+	root, _ := issuer.IssueGrant(delegableGrant())
+	child, err := Delegate(root, Delegation{Constraints: map[string]interface{}{"roots": []string{"/work/src"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Widening a caveat after signing breaks its signature.
+	edited := *child
+	edited.Caveats = append(edited.Caveats[:0:0], child.Caveats...)
+	edited.Caveats[0].Constraints = map[string]interface{}{"roots": []string{"/work"}}
+	if verifier.Verify(&edited) == nil {
+		t.Error("expected edited caveat to be rejected")
+	}
+
+	// Stripping the caveat leaves a proof that does not match the root delegation key.
+	stripped := *child
+	stripped.Caveats = nil
+	if verifier.Verify(&stripped) == nil {
+		t.Error("expected stripped chain to be rejected")
+	}
+
+	// The delegate cannot present the token without the proof.
+	noProof := *child
+	noProof.Proof = ""
+	if verifier.Verify(&noProof) == nil {
+		t.Error("expected token without proof to be rejected")
+	}
+
+	// Caveats on a token issued without a delegation key are rejected.
+	plain, _ := issuer.Issue("sess_1", "agent", "file.read", map[string]interface{}{"roots": []string{"/work"}}, 60)
+	plain.Caveats = child.Caveats
+	if err := verifier.Verify(plain); !errors.Is(err, ErrNotDelegable) {
+		t.Errorf("caveats on plain token: got %v", err)
+	}
+}
+
+func TestNarrowConstraints(t *testing.T) {
+	parent := map[string]interface{}{
+		"domains":           []interface{}{"example.com"},
+		"forbidden_domains": []interface{}{"admin.example.com"},
+	}
+	out, err := NarrowConstraints(parent, map[string]interface{}{
+		"domains":           []string{"api.example.com"},
+		"forbidden_domains": []string{"internal.example.com"},
+		"methods":           []string{"GET"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forbidden, _ := stringList(out["forbidden_domains"])
+	if len(forbidden) != 2 {
+		t.Fatalf("forbidden_domains = %v, want both entries", forbidden)
+	}
+	if methods, _ := stringList(out["methods"]); len(methods) != 1 {
+		t.Fatalf("methods = %v", out["methods"])
+	}
+	if _, err := NarrowConstraints(parent, map[string]interface{}{"domains": []string{"evil.com"}}); err == nil {
+		t.Fatal("expected domain outside the parent grant to be rejected")
+	}
+	limited := map[string]interface{}{"roots": []interface{}{"/work"}, "max_entries": float64(100)}
+	if _, err := NarrowConstraints(limited, map[string]interface{}{"max_entries": 50}); err != nil {
+		t.Fatalf("lower max_entries: %v", err)
+	}
+	if _, err := NarrowConstraints(limited, map[string]interface{}{"max_entries": 500}); err == nil {
+		t.Fatal("expected a higher max_entries to be rejected")
+	}
+}
+
+func TestDelegateKeepsIntentBindingAndBudget(t *testing.T) {
+	e := NewEngine(NewIssuer("secret"))
+	e.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "file.read", Allow: true, Delegable: true, MaxUses: 3, Constraints: map[string]interface{}{"roots": []interface{}{"/work"}}},
+		{Tool: "file.read", Allow: false, Constraints: map[string]interface{}{"roots": []interface{}{"/work/secrets"}}},
+	}})
+	root := e.Evaluate(core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/a.txt"}}, "sess_1").Token
+	if root == nil || root.IntentDigest == "" {
+		t.Fatalf("expected a digest-bound token, got %+v", root)
+	}
+
+	// An intent the session denies cannot be bound to a delegate of an allowed one.
+	denied := core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/secrets/key"}}
+	if r := e.Evaluate(denied, "sess_1"); r.Decision != core.DecisionDeny {
+		t.Fatalf("expected the session to deny %v, got %s", denied.Params, r.Decision)
+	}
+	deniedDigest, _ := IntentDigest(denied.Params)
+	if _, err := Delegate(root, Delegation{Subject: "worker-1", IntentDigest: deniedDigest}); err == nil {
+		t.Fatal("delegate re-bound to a denied intent")
+	}
+
+	child, err := Delegate(root, Delegation{Subject: "worker-1", IntentDigest: root.IntentDigest, MaxUses: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewVerifier("secret").Verify(child); err != nil {
+		t.Fatalf("verify delegated token: %v", err)
+	}
+	if EffectiveIntentDigest(child) != root.IntentDigest || EffectiveMaxUses(child) != 2 || EffectiveMaxUses(root) != 3 {
+		t.Fatalf("effective digest/max_uses = %s/%d", EffectiveIntentDigest(child), EffectiveMaxUses(child))
+	}
+
+	// A caveat edited to re-bind the chain fails the narrowing check, whatever its signature.
+	forged := *child
+	forged.Caveats = append(append([]core.Caveat{}, child.Caveats...), core.Caveat{CapID: core.NewCapID(), IntentDigest: deniedDigest})
+	if _, err := EffectiveConstraints(&forged); err == nil {
+		t.Fatal("expected a re-binding caveat to be rejected")
+	}
+
+	if _, err := Delegate(child, Delegation{MaxUses: 3}); err == nil {
+		t.Error("delegate with a budget above its parent's succeeded")
+	}
+	if _, err := Delegate(root, Delegation{MaxUses: -1}); err == nil {
+		t.Error("delegate with a negative budget succeeded")
+	}
+}
+
+func TestDelegateBindsUnboundToken(t *testing.T) {
+	root, _ := NewIssuer("secret").IssueGrant(delegableGrant())
+	digest, _ := IntentDigest(map[string]interface{}{"path": "/work/a.txt"})
+	child, err := Delegate(root, Delegation{IntentDigest: digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if EffectiveIntentDigest(root) != "" || EffectiveIntentDigest(child) != digest {
+		t.Fatalf("effective digest = %q", EffectiveIntentDigest(child))
+	}
+	other, _ := IntentDigest(map[string]interface{}{"path": "/work/b.txt"})
+	if _, err := Delegate(child, Delegation{IntentDigest: other}); err == nil {
+		t.Error("grandchild re-bound its parent's intent")
+	}
+	if _, err := Delegate(root, Delegation{IntentDigest: "sha256:nothex"}); err == nil {
+		t.Error("delegate with a malformed intent digest succeeded")
+	}
+}
@@ -3,47 +3,184 @@
 package policy
 
 import (
+	"sync"
+
 	"securetalon/internal/core"
 )
 
 // SessionPolicy holds per-session overrides (allowlist rules).
+// Packs reference shared rule bundles by name@version (see packs.go).
 type SessionPolicy struct {
 	Overrides []RuleOverride `json:"overrides"`
+	Packs     []PackRef      `json:"packs,omitempty"`
 }
 
-// RuleOverride is one allowlist rule (e.g. file.read under path, http.fetch to domain).
+// RuleOverride is one allow or deny rule (e.g. file.read under path, http.fetch to domain).
+// Allow=false makes it a deny rule scoped by its constraints (see match.go for precedence).
+// RequireApproval makes a matching intent pause for a human decision instead of being allowed outright.
+// When is an optional condition (see package expr) that must also hold for the rule to apply,
+// e.g. `param.path.endsWith(".md") && time.hour < 18`; time.* is in Timezone (an IANA name, default UTC).
+// Limits are rate or quota limits on an allow rule (see counters.go). Tokens are single-use unless
+// MaxUses allows a token to be executed more than once within its TTL, and TTLSeconds sets that TTL
+// (see Engine.TokenTTL). Delegable tokens may be attenuated by their holder for sub-agents (see Delegate).
 type RuleOverride struct {
-	Tool       string                 `json:"tool"`
-	Allow      bool                   `json:"allow"`
-	Constraints map[string]interface{} `json:"constraints"`
+	Name            string                 `json:"name,omitempty"`
+	Tool            string                 `json:"tool"`
+	Allow           bool                   `json:"allow"`
+	RequireApproval bool                   `json:"require_approval,omitempty"`
+	When            string                 `json:"when,omitempty"`
+	Timezone        string                 `json:"timezone,omitempty"`
+	Limits          []Limit                `json:"limits,omitempty"`
+	MaxUses         int                    `json:"max_uses,omitempty"` // executions per issued token (default 1)
+	TTLSeconds      int64                  `json:"ttl_seconds,omitempty"`
+	Delegable       bool                   `json:"delegable,omitempty"`
+	Constraints     map[string]interface{} `json:"constraints"`
 }
 
-// Engine evaluates ToolIntent against static + session policy and returns ALLOW+token or DENY.
+// Engine evaluates ToolIntent against builtin, global and session policy and returns ALLOW+token or DENY.
+// When Revisions is set, PutSessionPolicy and RollbackSessionPolicy persist every change as a revision.
+// Sessions, when set, exposes session label and metadata to rule conditions. Counters, when set,
+// enforces rule limits; without it limits are not enforced. Capabilities, when set, records every
+// issued token for listing and revocation. Workspaces, when set, resolves relative roots and file
+// paths inside the session's workspace (see ResolveIntent).
 type Engine struct {
+	mu               sync.RWMutex
 	DefaultTTL       int64
+	ToolTTLs         map[string]int64 // per-tool default TTL in seconds, before DefaultTTL
+	MaxTTL           int64            // cap in seconds on every token lifetime when > 0 (see TokenTTL)
 	SessionOverrides map[string]*SessionPolicy
+	Global           *GlobalPolicy
 	Issuer           *Issuer
+	Revisions        *RevisionStore
+	Sessions         SessionLookup
+	Packs            *PackStore
+	Counters         *CounterStore
+	Capabilities     *CapabilityStore
+	Workspaces       WorkspaceResolver
+
+	programs sync.Map // when source -> *expr.Program
 }
 
 // NewEngine returns a deny-by-default engine. Pass issuer so ALLOW results include a signed token.
 func NewEngine(issuer *Issuer) *Engine {
 	return &Engine{
 		DefaultTTL:       60,
+		ToolTTLs:         map[string]int64{"docker.run": 300, "file.write": 30},
 		SessionOverrides: make(map[string]*SessionPolicy),
 		Issuer:           issuer,
 	}
 }
 
-// SetSessionPolicy sets overrides for a session.
+// SetSessionPolicy sets overrides for a session (in memory only; see PutSessionPolicy).
 func (e *Engine) SetSessionPolicy(sessionID string, sp *SessionPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	if e.SessionOverrides == nil {
 		e.SessionOverrides = make(map[string]*SessionPolicy)
 	}
 	e.SessionOverrides[sessionID] = sp
 }
 
-// Evaluate returns ALLOW + token or DENY + reason. SessionContext can be nil for MVP.
+// SessionPolicy returns the live overrides for a session or nil.
+func (e *Engine) SessionPolicy(sessionID string) *SessionPolicy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.SessionOverrides[sessionID]
+}
+
+// PutSessionPolicy validates sp, records it as a new revision (when Revisions is set) and makes it live.
+// Returns the revision, or nil without a revision store. An invalid policy yields a *ValidationError.
+func (e *Engine) PutSessionPolicy(sessionID, author string, sp *SessionPolicy) (*Revision, error) {
+	if err := ValidateRules(sp.Overrides); err != nil {
+		return nil, err
+	}
+	if err := e.PinPackRefs(sp); err != nil {
+		return nil, err
+	}
+	return e.putSessionPolicy(sessionID, author, sp, 0)
+}
+
+// RevisionPolicy returns a copy of the policy of an earlier revision, validated and with its pack refs
+// checked as PutSessionPolicy does: rules or packs that were valid then may not be now.
+func (e *Engine) RevisionPolicy(sessionID string, version int) (*SessionPolicy, error) {
+	if e.Revisions == nil {
+		return nil, ErrRevisionNotFound
+	}
+	target, err := e.Revisions.Get(sessionID, version)
+	if err != nil {
+		return nil, err
+	}
+	sp := &SessionPolicy{
+		Overrides: append([]RuleOverride(nil), target.Policy.Overrides...),
+		Packs:     append([]PackRef(nil), target.Policy.Packs...),
+	}
+	if err := ValidateRules(sp.Overrides); err != nil {
+		return nil, err
+	}
+	if err := e.PinPackRefs(sp); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+// RollbackSessionPolicy restores the policy of an earlier revision (see RevisionPolicy) as a new revision.
+func (e *Engine) RollbackSessionPolicy(sessionID, author string, version int) (*Revision, error) {
+	sp, err := e.RevisionPolicy(sessionID, version)
+	if err != nil {
+		return nil, err
+	}
+	return e.putSessionPolicy(sessionID, author, sp, version)
+}
+
+func (e *Engine) putSessionPolicy(sessionID, author string, sp *SessionPolicy, rollbackOf int) (*Revision, error) {
+	var rev *Revision
+	if e.Revisions != nil {
+		var err error
+		rev, err = e.Revisions.Append(sessionID, author, sp, rollbackOf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	e.SetSessionPolicy(sessionID, sp)
+	return rev, nil
+}
+
+// RestoreSessionPolicies loads the latest revision of every session from Revisions (e.g. at startup).
+func (e *Engine) RestoreSessionPolicies() {
+	if e.Revisions == nil {
+		return
+	}
+	for sessionID, rev := range e.Revisions.Latest() {
+		sp := rev.Policy
+		e.SetSessionPolicy(sessionID, &sp)
+	}
+}
+
+// Evaluate returns ALLOW + token, REQUIRE_APPROVAL, or DENY + reason. SessionContext can be nil for MVP.
 func (e *Engine) Evaluate(intent core.ToolIntent, sessionID string) core.PolicyResult {
+	return e.evaluate(intent, sessionID, "", e.SessionPolicy(sessionID), false, true)
+}
+
+// EvaluateApproved re-evaluates an intent a human has approved: a matching REQUIRE_APPROVAL rule
+// is treated as ALLOW and a token is issued. The current policy still applies, so an intent whose
+// rule was removed while it waited is denied.
+func (e *Engine) EvaluateApproved(intent core.ToolIntent, sessionID string) core.PolicyResult {
+	return e.evaluate(intent, sessionID, "", e.SessionPolicy(sessionID), true, true)
+}
+
+// EvaluateForRun is Evaluate (or EvaluateApproved when approved) for an intent of a run, so that
+// limits with per "run" are counted per run.
+func (e *Engine) EvaluateForRun(intent core.ToolIntent, sessionID, runID string, approved bool) core.PolicyResult {
+	return e.evaluate(intent, sessionID, runID, e.SessionPolicy(sessionID), approved, true)
+}
+
+// sessionOnlyTools can only be allowed by an explicit session override: allow rules for them in packs
+// and the global policy are ignored (their deny rules still apply).
+var sessionOnlyTools = map[string]bool{"file.delete": true}
+
+// evaluate decides intent against the builtin and global layers plus the given session overrides.
+// With issue=false an ALLOW carries no token and consumes no quota (dry runs, see Simulate).
+func (e *Engine) evaluate(intent core.ToolIntent, sessionID, runID string, overrides *SessionPolicy, approved, issue bool) core.PolicyResult {
 	// Deny shell.exec by default (no allowlist in MVP)
 	if intent.Tool == "shell.exec" {
 		return core.PolicyResult{
@@ -52,17 +189,164 @@ func (e *Engine) Evaluate(intent core.ToolIntent, sessionID string) core.PolicyR
 			SuggestedFix: "Use file.read/file.write or docker.run instead",
 		}
 	}
+	if e.Sessions != nil {
+		if s := e.Sessions.GetSession(sessionID); s != nil && s.Status == core.SessionClosed {
+			return core.PolicyResult{
+				Decision:     core.DecisionDeny,
+				Reason:       "session is closed",
+				SuggestedFix: "Create a new session",
+			}
+		}
+	}
 
-	// Check session overrides for an explicit allow
-	overrides := e.SessionOverrides[sessionID]
+	gp := e.GlobalPolicy()
+	var ceiling map[string]interface{}
+	var cands []candidate
 	if overrides != nil {
-		for _, r := range overrides.Overrides {
-			if r.Tool == intent.Tool && r.Allow && r.Constraints != nil {
-				// Issue token with those constraints
-				return e.allowWithConstraints(intent, sessionID, r.Constraints)
+		for i, r := range overrides.Overrides {
+			cands = append(cands, candidate{layer: LayerSession, index: i + 1, rule: r})
+		}
+		cands = append(cands, e.packCandidates(overrides)...)
+	}
+	if gp != nil {
+		for i, r := range gp.Rules {
+			cands = append(cands, candidate{layer: LayerGlobal, index: i + 1, rule: r})
+		}
+		ceiling = gp.Ceilings[intent.Tool]
+	}
+	if e.Workspaces != nil {
+		intent = e.ResolveIntent(intent, sessionID)
+		for i := range cands {
+			cands[i].rule.Constraints = e.resolveRoots(cands[i].rule.Constraints, sessionID)
+			cands[i].narrow = e.resolveRoots(cands[i].narrow, sessionID)
+		}
+		ceiling = e.resolveRoots(ceiling, sessionID)
+	}
+
+	// Conditions are evaluated once per rule. A deny rule whose condition is false does not apply;
+	// one whose condition fails to evaluate does (fail closed).
+	held := make([]bool, len(cands))
+	condErr := make([]error, len(cands))
+	var denies []candidate
+	for i, c := range cands {
+		if c.rule.Tool != intent.Tool {
+			continue
+		}
+		held[i], condErr[i] = e.condition(c.rule, intent, sessionID)
+		if !c.rule.Allow && (held[i] || condErr[i] != nil) {
+			denies = append(denies, c)
+		}
+	}
+
+	// Deny beats allow: any matching deny rule decides, the most specific one is named
+	if c := bestMatch(denies, intent.Tool, false, intent.Params); c != nil {
+		fix := "Remove or narrow the deny rule in the session policy"
+		switch c.layer {
+		case LayerGlobal:
+			fix = "Ask an administrator to change the global policy file"
+		case LayerPack:
+			fix = "Remove the pack from the session policy or publish a pack version without the deny rule"
+		}
+		return c.decided(core.PolicyResult{
+			Decision:     core.DecisionDeny,
+			Reason:       "denied by " + c.describe(),
+			SuggestedFix: fix,
+		})
+	}
+
+	// Most specific allow rule whose (ceiling-narrowed) constraints admit the intent params.
+	// Params are checked here so out-of-scope intents are denied without minting a token.
+	var best *candidate
+	var bestConstraints map[string]interface{}
+	bestSpec := -1
+	var firstMiss *candidate
+	var miss *violation
+	var quotaMiss *candidate
+	var quotaViolation *violation
+	subject := intent.Subject
+	if subject == "" {
+		subject = "agent"
+	}
+	for i := range cands {
+		c := &cands[i]
+		if c.rule.Tool != intent.Tool || !c.rule.Allow || c.rule.Constraints == nil {
+			continue
+		}
+		if sessionOnlyTools[intent.Tool] && c.layer != LayerSession {
+			continue
+		}
+		constraints, err := narrowPackRule(c.rule.Constraints, c.narrow)
+		var v *violation
+		if err != nil {
+			v = &violation{"outside the session's narrowing of the pack: " + err.Error(), "Widen the pack narrowing in the session policy or use another rule"}
+		} else if constraints, err = applyCeiling(constraints, ceiling); err != nil {
+			v = &violation{"exceeds global ceiling: " + err.Error(), "Narrow the rule's constraints to fit within the global policy ceilings"}
+		} else if v = checkParams(intent.Tool, intent.Params, constraints); v == nil {
+			if condErr[i] != nil {
+				v = &violation{"condition failed to evaluate: " + condErr[i].Error(), "Fix the rule's when expression or supply the params it reads"}
+			} else if !held[i] {
+				v = &violation{"condition not met: " + c.rule.When, "Change the intent so the rule's when condition holds"}
+			} else if len(c.rule.Limits) > 0 && e.Counters != nil {
+				checks := quotaChecks(c.rule, intent.Params)
+				if cnt := e.Counters.exceeded(sessionID, subject, intent.Tool, c.quotaKey(), runID, checks); cnt != nil {
+					v = quotaExceeded(cnt, c.rule.Limits[cnt.Limit-1])
+					if quotaMiss == nil {
+						quotaMiss, quotaViolation = c, v
+					}
+				}
+			}
+		}
+		if v != nil {
+			if firstMiss == nil {
+				firstMiss, miss = c, v
 			}
+			continue
+		}
+		_, spec := scopeMatch(RuleOverride{Constraints: constraints, When: c.rule.When}, intent.Params)
+		if spec > bestSpec {
+			best, bestConstraints, bestSpec = c, constraints, spec
 		}
 	}
+	if best != nil {
+		if best.rule.RequireApproval && !approved {
+			return best.decided(core.PolicyResult{
+				Decision:     core.DecisionRequireApproval,
+				Reason:       "approval required by " + best.describe(),
+				SuggestedFix: "Approve or reject the pending request via /v1/approvals",
+			})
+		}
+		if !issue {
+			return best.decided(core.PolicyResult{Decision: core.DecisionAllow, Reason: "allowed by " + best.describe()})
+		}
+		if len(best.rule.Limits) > 0 && e.Counters != nil {
+			cnt, err := e.Counters.consume(sessionID, subject, intent.Tool, best.quotaKey(), runID, quotaChecks(best.rule, intent.Params))
+			if cnt != nil {
+				v := quotaExceeded(cnt, best.rule.Limits[cnt.Limit-1])
+				return best.decided(core.PolicyResult{
+					Decision:     core.DecisionDeny,
+					Reason:       "intent outside " + best.describe() + ": " + v.reason,
+					SuggestedFix: v.fix,
+				})
+			}
+			if err != nil {
+				return best.decided(core.PolicyResult{Decision: core.DecisionDeny, Reason: "failed to record quota usage: " + err.Error()})
+			}
+		}
+		// Issue token with those constraints
+		result := e.allowWithConstraints(intent, sessionID, best.rule, bestConstraints, "allowed by "+best.describe())
+		return best.decided(result)
+	}
+	// A rule that would have allowed the intent but for its quota is the most useful explanation
+	if quotaMiss != nil {
+		firstMiss, miss = quotaMiss, quotaViolation
+	}
+	if firstMiss != nil {
+		return firstMiss.decided(core.PolicyResult{
+			Decision:     core.DecisionDeny,
+			Reason:       "intent outside " + firstMiss.describe() + ": " + miss.reason,
+			SuggestedFix: miss.fix,
+		})
+	}
 
 	// Deny by default
 	return core.PolicyResult{
@@ -72,16 +356,60 @@ func (e *Engine) Evaluate(intent core.ToolIntent, sessionID string) core.PolicyR
 	}
 }
 
-// allowWithConstraints issues a capability token with the given constraints.
-func (e *Engine) allowWithConstraints(intent core.ToolIntent, sessionID string, constraints map[string]interface{}) core.PolicyResult {
+// TokenTTL returns the lifetime in seconds of a token issued for tool by rule: the rule's ttl_seconds,
+// else the global default for the tool (or "*"), else the engine's per-tool default, else DefaultTTL.
+// The result is capped by the global max for the tool and for "*", and by MaxTTL: with key rotation a
+// token must not outlive the retention of the key that signed it.
+func (e *Engine) TokenTTL(tool string, rule RuleOverride) int64 {
+	gp := e.GlobalPolicy()
+	ttl := rule.TTLSeconds
+	if ttl <= 0 && gp != nil {
+		if ttl = gp.TTLs[tool].Default; ttl <= 0 {
+			ttl = gp.TTLs["*"].Default
+		}
+	}
+	if ttl <= 0 {
+		ttl = e.ToolTTLs[tool]
+	}
+	if ttl <= 0 {
+		ttl = e.DefaultTTL
+	}
+	limits := []int64{e.MaxTTL}
+	if gp != nil {
+		limits = append(limits, gp.TTLs[tool].Max, gp.TTLs["*"].Max)
+	}
+	for _, limit := range limits {
+		if limit > 0 && ttl > limit {
+			ttl = limit
+		}
+	}
+	return ttl
+}
+
+// allowWithConstraints issues a capability token for the deciding rule with the given (effective) constraints.
+func (e *Engine) allowWithConstraints(intent core.ToolIntent, sessionID string, rule RuleOverride, constraints map[string]interface{}, reason string) core.PolicyResult {
 	var token *core.CapabilityToken
 	if e.Issuer != nil {
 		subject := intent.Subject
 		if subject == "" {
 			subject = "agent"
 		}
-		var err error
-		token, err = e.Issuer.Issue(sessionID, subject, intent.Tool, constraints, e.DefaultTTL)
+		digest, err := IntentDigest(intent.Params)
+		if err == nil {
+			token, err = e.Issuer.IssueGrant(Grant{
+				SessionID:    sessionID,
+				Subject:      subject,
+				Tool:         intent.Tool,
+				Constraints:  constraints,
+				TTLSeconds:   e.TokenTTL(intent.Tool, rule),
+				MaxUses:      rule.MaxUses,
+				IntentDigest: digest,
+				Delegable:    rule.Delegable,
+			})
+		}
+		if err == nil && e.Capabilities != nil {
+			err = e.Capabilities.Record(token)
+		}
 		if err != nil {
 			return core.PolicyResult{
 				Decision: core.DecisionDeny,
@@ -91,7 +419,7 @@ func (e *Engine) allowWithConstraints(intent core.ToolIntent, sessionID string,
 	}
 	return core.PolicyResult{
 		Decision: core.DecisionAllow,
-		Reason:   "matched allowlist",
+		Reason:   reason,
 		Token:    token,
 	}
 }
@@ -1,6 +1,9 @@
 package policy
 
 import (
+	"encoding/base64"
+	"path"
+	"strings"
 	"testing"
 
 	"securetalon/internal/core"
@@ -49,3 +52,386 @@ func TestAllowWithOverride(t *testing.T) {
 		t.Fatalf("token tool: got %s", result.Token.Tool)
 	}
 }
+
+func TestRequireApprovalOverride(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{
+		Overrides: []RuleOverride{
+			{Tool: "file.write", Allow: true, RequireApproval: true, Constraints: map[string]interface{}{
+				"roots": []string{"/work"},
+			}},
+		},
+	})
+	intent := core.ToolIntent{Tool: "file.write", Params: map[string]interface{}{"path": "/work/out.txt"}}
+
+	result := engine.Evaluate(intent, "sess_1")
+	if result.Decision != core.DecisionRequireApproval {
+		t.Fatalf("expected REQUIRE_APPROVAL, got %s", result.Decision)
+	}
+	if result.Token != nil {
+		t.Fatal("expected no token before approval")
+	}
+
+	result = engine.EvaluateApproved(intent, "sess_1")
+	if result.Decision != core.DecisionAllow || result.Token == nil {
+		t.Fatalf("expected ALLOW with token after approval, got %s", result.Decision)
+	}
+
+	// Approval does not bypass policy for tools without a matching rule
+	result = engine.EvaluateApproved(core.ToolIntent{Tool: "http.fetch"}, "sess_1")
+	if result.Decision != core.DecisionDeny {
+		t.Fatalf("expected DENY for unmatched tool, got %s", result.Decision)
+	}
+}
+
+func TestDenyOverridePrecedence(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{
+		Overrides: []RuleOverride{
+			{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work"}}},
+			{Name: "no-secrets", Tool: "file.read", Allow: false, Constraints: map[string]interface{}{"roots": []string{"/work/secrets"}}},
+			{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work/secrets/public"}}},
+		},
+	})
+	read := func(path string) core.PolicyResult {
+		return engine.Evaluate(core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": path}}, "sess_1")
+	}
+
+	// Deny beats allow even when a more specific allow exists
+	for _, path := range []string{"/work/secrets/key.pem", "/work/secrets/public/a.txt", "/work/other/../secrets/key.pem"} {
+		result := read(path)
+		if result.Decision != core.DecisionDeny {
+			t.Fatalf("%s: expected DENY, got %s", path, result.Decision)
+		}
+		if result.Rule != "session#2" || !strings.Contains(result.Reason, `"no-secrets"`) {
+			t.Fatalf("%s: expected reason to name session rule #2, got %q (%s)", path, result.Reason, result.Rule)
+		}
+	}
+
+	result := read("/work/notes.txt")
+	if result.Decision != core.DecisionAllow || result.Rule != "session#1" {
+		t.Fatalf("expected ALLOW by session#1, got %s by %s", result.Decision, result.Rule)
+	}
+	// Previously Allow:false was ignored; a deny without constraints now denies the whole tool
+	engine.SetSessionPolicy("sess_2", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "http.fetch", Allow: true, Constraints: map[string]interface{}{"domains": []string{"example.com"}}},
+		{Tool: "http.fetch", Allow: false},
+	}})
+	result = engine.Evaluate(core.ToolIntent{Tool: "http.fetch", Params: map[string]interface{}{"url": "https://example.com"}}, "sess_2")
+	if result.Decision != core.DecisionDeny || result.Rule != "session#2" {
+		t.Fatalf("expected DENY by session#2, got %s by %s", result.Decision, result.Rule)
+	}
+}
+
+func TestMoreSpecificAllowDecides(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{
+		Overrides: []RuleOverride{
+			{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work"}, "max_bytes": 100.0}},
+			{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work/big"}, "max_bytes": 5000.0}},
+		},
+	})
+	result := engine.Evaluate(core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/big/data.csv"}}, "sess_1")
+	if result.Decision != core.DecisionAllow || result.Rule != "session#2" {
+		t.Fatalf("expected ALLOW by session#2, got %s by %s", result.Decision, result.Rule)
+	}
+	if mb, _ := number(result.Token.Constraints["max_bytes"]); mb != 5000 {
+		t.Fatalf("expected constraints of the more specific rule, got max_bytes %v", mb)
+	}
+}
+
+func TestOutOfScopeIntentDeniedWithoutToken(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{
+		Overrides: []RuleOverride{
+			{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work/allowed"}}},
+			{Tool: "file.write", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work"}, "max_bytes": 4.0}},
+			{Tool: "http.fetch", Allow: true, Constraints: map[string]interface{}{
+				"domains": []interface{}{"api.example.com"},
+				"methods": []interface{}{"GET"},
+			}},
+			{Tool: "docker.run", Allow: true, Constraints: map[string]interface{}{"images": []interface{}{"skill@sha256:abc"}}},
+		},
+	})
+	cases := []struct {
+		name   string
+		intent core.ToolIntent
+		reason string
+	}{
+		{"path outside roots", core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/etc/passwd"}}, "not under allowed roots"},
+		{"traversal out of root", core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/allowed/../../etc/passwd"}}, "not under allowed roots"},
+		{"missing path", core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{}}, "path param required"},
+		{"write too large", core.ToolIntent{Tool: "file.write", Params: map[string]interface{}{"path": "/work/a", "content": "hello"}}, "exceeds max_bytes"},
+		{"domain not allowed", core.ToolIntent{Tool: "http.fetch", Params: map[string]interface{}{"url": "https://evil.com/"}}, "not in allowed domains"},
+		{"method not allowed", core.ToolIntent{Tool: "http.fetch", Params: map[string]interface{}{"url": "https://api.example.com/", "method": "POST"}}, "method POST"},
+		{"image not pinned", core.ToolIntent{Tool: "docker.run", Params: map[string]interface{}{"image": "skill:latest"}}, "not pinned by digest"},
+		{"image not allowed", core.ToolIntent{Tool: "docker.run", Params: map[string]interface{}{"image": "other@sha256:def"}}, "not in allowed images"},
+	}
+	for _, tc := range cases {
+		result := engine.Evaluate(tc.intent, "sess_1")
+		if result.Decision != core.DecisionDeny {
+			t.Fatalf("%s: expected DENY, got %s", tc.name, result.Decision)
+		}
+		if result.Token != nil {
+			t.Fatalf("%s: no token may be minted for a denied intent", tc.name)
+		}
+		if !strings.Contains(result.Reason, tc.reason) || result.SuggestedFix == "" {
+			t.Fatalf("%s: expected reason containing %q with a fix, got %q / %q", tc.name, tc.reason, result.Reason, result.SuggestedFix)
+		}
+	}
+
+	result := engine.Evaluate(core.ToolIntent{Tool: "http.fetch", Params: map[string]interface{}{"url": "https://api.example.com/v1"}}, "sess_1")
+	if result.Decision != core.DecisionAllow || result.Token == nil {
+		t.Fatalf("expected in-scope fetch allowed, got %s: %s", result.Decision, result.Reason)
+	}
+}
+
+func TestWhenConditions(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{
+		Overrides: []RuleOverride{
+			{Tool: "file.read", Allow: true, When: `param.path.endsWith(".md")`, Constraints: map[string]interface{}{"roots": []string{"/work"}}},
+			{Tool: "file.read", Allow: false, When: `param.path.contains("secret")`, Constraints: map[string]interface{}{"roots": []string{"/work"}}},
+			{Tool: "http.fetch", Allow: false, When: `param.headers.startsWith("x")`},
+			{Tool: "http.fetch", Allow: true, Constraints: map[string]interface{}{"domains": []string{"api.example.com"}}},
+		},
+	})
+	cases := []struct {
+		name   string
+		intent core.ToolIntent
+		want   core.Decision
+		rule   string
+	}{
+		{"condition holds", core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/README.md"}}, core.DecisionAllow, "session#1"},
+		{"condition false", core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/main.go"}}, core.DecisionDeny, "session#1"},
+		{"deny condition holds", core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/secret.md"}}, core.DecisionDeny, "session#2"},
+		{"deny condition errors fails closed", core.ToolIntent{Tool: "http.fetch", Params: map[string]interface{}{"url": "https://api.example.com/"}}, core.DecisionDeny, "session#3"},
+	}
+	for _, tc := range cases {
+		result := engine.Evaluate(tc.intent, "sess_1")
+		if result.Decision != tc.want || result.Rule != tc.rule {
+			t.Fatalf("%s: expected %s by %s, got %s by %s (%s)", tc.name, tc.want, tc.rule, result.Decision, result.Rule, result.Reason)
+		}
+	}
+}
+
+func TestPutSessionPolicyRejectsInvalidCondition(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	_, err := engine.PutSessionPolicy("sess_1", "admin", &SessionPolicy{
+		Overrides: []RuleOverride{
+			{Tool: "file.read", Allow: true, When: `param.path.startsWith(`},
+			{Tool: "file.read", Allow: true, When: `time.hour + "x"`},
+		},
+	})
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Rules) != 2 {
+		t.Fatalf("expected 2 rule errors, got %v", err)
+	}
+	if engine.SessionPolicy("sess_1") != nil {
+		t.Fatal("invalid policy must not become live")
+	}
+}
+
+// fakeWorkspaces resolves relative paths under /data/workspaces/<session>.
+type fakeWorkspaces struct{}
+
+func (fakeWorkspaces) Resolve(sessionID, p string) string {
+	if strings.HasPrefix(p, "/") || p == "" {
+		return p
+	}
+	return path.Join("/data/workspaces", sessionID, p)
+}
+
+func TestRelativeRootsResolveInWorkspace(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.Workspaces = fakeWorkspaces{}
+	roots := []string{"workspace"}
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": roots}},
+	}})
+
+	intent := engine.ResolveIntent(core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "notes.md"}}, "sess_1")
+	if intent.Params["path"] != "/data/workspaces/sess_1/notes.md" {
+		t.Fatalf("resolved path = %v", intent.Params["path"])
+	}
+	result := engine.Evaluate(intent, "sess_1")
+	if result.Decision != core.DecisionAllow || result.Token == nil {
+		t.Fatalf("expected ALLOW, got %s (%s)", result.Decision, result.Reason)
+	}
+	got, _ := stringList(result.Token.Constraints["roots"])
+	if len(got) != 1 || got[0] != "/data/workspaces/sess_1" {
+		t.Fatalf("token roots = %v", got)
+	}
+	if roots[0] != "workspace" {
+		t.Fatal("session policy was modified")
+	}
+
+	// Another session's workspace is a different directory.
+	if r := engine.Evaluate(core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/data/workspaces/sess_2/notes.md"}}, "sess_1"); r.Decision != core.DecisionDeny {
+		t.Fatalf("expected DENY for another session's workspace, got %s", r.Decision)
+	}
+}
+
+func TestWorkspaceRoots(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.Workspaces = fakeWorkspaces{}
+	cases := map[string]string{
+		"workspace":     "/data/workspaces/sess_1",
+		".":             "/data/workspaces/sess_1",
+		"workspace/src": "/data/workspaces/sess_1/src",
+		"src":           "/data/workspaces/sess_1/src",
+		"/work":         "/work",
+	}
+	for root, want := range cases {
+		out := engine.resolveRoots(map[string]interface{}{"roots": []interface{}{root}}, "sess_1")
+		got, _ := stringList(out["roots"])
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("root %q resolved to %v, want %s", root, got, want)
+		}
+	}
+}
+
+func TestFileDeleteRequiresSessionOverride(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	work := map[string]interface{}{"roots": []string{"/work"}}
+	engine.SetGlobalPolicy(&GlobalPolicy{Rules: []RuleOverride{
+		{Tool: "file.delete", Allow: true, Constraints: work},
+		{Tool: "file.stat", Allow: true, Constraints: work},
+	}})
+	intent := func(tool string) core.ToolIntent {
+		return core.ToolIntent{Tool: tool, Params: map[string]interface{}{"path": "/work/old.txt"}}
+	}
+	if r := engine.Evaluate(intent("file.stat"), "sess_1"); r.Decision != core.DecisionAllow {
+		t.Fatalf("file.stat via global rule: %s (%s)", r.Decision, r.Reason)
+	}
+	if r := engine.Evaluate(intent("file.delete"), "sess_1"); r.Decision != core.DecisionDeny {
+		t.Fatalf("file.delete via global rule: expected DENY, got %s", r.Decision)
+	}
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{{Tool: "file.delete", Allow: true, Constraints: work}}})
+	if r := engine.Evaluate(intent("file.delete"), "sess_1"); r.Decision != core.DecisionAllow {
+		t.Fatalf("file.delete via session override: %s (%s)", r.Decision, r.Reason)
+	}
+}
+
+func TestFileMoveChecksDest(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "file.move", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work"}}},
+		{Tool: "file.move", Allow: false, Constraints: map[string]interface{}{"roots": []string{"/work/locked"}}},
+	}})
+	move := func(dest string) core.PolicyResult {
+		return engine.Evaluate(core.ToolIntent{Tool: "file.move", Params: map[string]interface{}{"path": "/work/a.txt", "dest": dest}}, "sess_1")
+	}
+	if r := move("/work/b.txt"); r.Decision != core.DecisionAllow {
+		t.Fatalf("move within roots: %s (%s)", r.Decision, r.Reason)
+	}
+	if r := move("/tmp/b.txt"); r.Decision != core.DecisionDeny || !strings.Contains(r.Reason, "not under allowed roots") {
+		t.Fatalf("move out of roots: %s (%s)", r.Decision, r.Reason)
+	}
+	if r := move("/work/locked/b.txt"); r.Decision != core.DecisionDeny || !strings.Contains(r.Reason, "denied by") {
+		t.Fatalf("move into a denied root: %s (%s)", r.Decision, r.Reason)
+	}
+}
+
+func TestFileWriteModes(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "file.write", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work"}}},
+		{Tool: "file.write", Allow: false, Constraints: map[string]interface{}{"roots": []string{"/work/logs"}, "modes": []string{"overwrite", "patch"}}},
+	}})
+	write := func(path, mode string) core.PolicyResult {
+		params := map[string]interface{}{"path": path, "content": "x"}
+		if mode != "" {
+			params["mode"] = mode
+		}
+		return engine.Evaluate(core.ToolIntent{Tool: "file.write", Params: params}, "sess_1")
+	}
+	if r := write("/work/logs/app.log", "append"); r.Decision != core.DecisionAllow {
+		t.Fatalf("append to logs: %s (%s)", r.Decision, r.Reason)
+	}
+	if r := write("/work/logs/app.log", ""); r.Decision != core.DecisionDeny || !strings.Contains(r.Reason, "denied by") {
+		t.Fatalf("overwrite logs: %s (%s)", r.Decision, r.Reason)
+	}
+	if r := write("/work/a.txt", "truncate"); r.Decision != core.DecisionDeny || !strings.Contains(r.Reason, "unknown write mode") {
+		t.Fatalf("unknown mode: %s (%s)", r.Decision, r.Reason)
+	}
+
+	engine.SetSessionPolicy("sess_2", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "file.write", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work"}, "modes": []string{"create_only"}}},
+	}})
+	r := engine.Evaluate(core.ToolIntent{Tool: "file.write", Params: map[string]interface{}{"path": "/work/a.txt", "content": "x"}}, "sess_2")
+	if r.Decision != core.DecisionDeny || !strings.Contains(r.Reason, "not in allowed modes") {
+		t.Fatalf("overwrite under create_only rule: %s (%s)", r.Decision, r.Reason)
+	}
+	r = engine.Evaluate(core.ToolIntent{Tool: "file.write", Params: map[string]interface{}{"path": "/work/a.txt", "content": "x", "mode": "create_only", "expected_sha256": "abc"}}, "sess_2")
+	if r.Decision != core.DecisionDeny || !strings.Contains(r.Reason, "expected_sha256") {
+		t.Fatalf("malformed expected_sha256: %s (%s)", r.Decision, r.Reason)
+	}
+}
+
+func TestFileContentConstraints(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "file.write", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work"}, "content_types": []string{"text/*", "application/json"}}},
+		{Tool: "file.write", Allow: false, Constraints: map[string]interface{}{"roots": []string{"/work"}, "extensions": []string{"sh", ".exe"}}},
+	}})
+	write := func(path, content, encoding string) core.PolicyResult {
+		params := map[string]interface{}{"path": path, "content": content}
+		if encoding != "" {
+			params["encoding"] = encoding
+		}
+		return engine.Evaluate(core.ToolIntent{Tool: "file.write", Params: params}, "sess_1")
+	}
+	if r := write("/work/notes.txt", "hello", ""); r.Decision != core.DecisionAllow {
+		t.Fatalf("text write: %s (%s)", r.Decision, r.Reason)
+	}
+	if r := write("/work/run.SH", "echo hi", ""); r.Decision != core.DecisionDeny || !strings.Contains(r.Reason, "denied by") {
+		t.Fatalf("denied extension: %s (%s)", r.Decision, r.Reason)
+	}
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	if r := write("/work/notes.txt", png, "base64"); r.Decision != core.DecisionDeny || !strings.Contains(r.Reason, "content type image/png") {
+		t.Fatalf("png under text/*: %s (%s)", r.Decision, r.Reason)
+	}
+	if r := write("/work/notes.txt", "%%%", "base64"); r.Decision != core.DecisionDeny || !strings.Contains(r.Reason, "base64") {
+		t.Fatalf("invalid base64: %s (%s)", r.Decision, r.Reason)
+	}
+
+	for _, c := range []struct {
+		mediaType string
+		allowed   []string
+		want      bool
+	}{
+		{"text/plain; charset=utf-8", []string{"text/plain"}, true},
+		{"text/html; charset=utf-8", []string{"text/*"}, true},
+		{"image/png", []string{"text/*"}, false},
+		{"image/png", []string{"*/*"}, true},
+		{"application/json", []string{"Application/JSON"}, true},
+	} {
+		if got := ContentTypeAllowed(c.mediaType, c.allowed); got != c.want {
+			t.Errorf("ContentTypeAllowed(%q, %v) = %v", c.mediaType, c.allowed, got)
+		}
+	}
+	if !ExtensionAllowed("/work/a.tar.GZ", []string{"gz"}) || ExtensionAllowed("/work/Makefile", []string{"txt"}) {
+		t.Error("ExtensionAllowed")
+	}
+}
+
+func TestFileReadRangeParams(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work"}, "max_bytes": 4096.0}},
+	}})
+	read := func(params map[string]interface{}) core.PolicyResult {
+		params["path"] = "/work/app.log"
+		return engine.Evaluate(core.ToolIntent{Tool: "file.read", Params: params}, "sess_1")
+	}
+	if r := read(map[string]interface{}{"offset": 8192.0, "length": 4096.0}); r.Decision != core.DecisionAllow {
+		t.Fatalf("range within max_bytes: %s (%s)", r.Decision, r.Reason)
+	}
+	if r := read(map[string]interface{}{"length": 8192.0}); r.Decision != core.DecisionDeny || !strings.Contains(r.Reason, "exceeds the rule's max_bytes") {
+		t.Fatalf("length above max_bytes: %s (%s)", r.Decision, r.Reason)
+	}
+	if r := read(map[string]interface{}{"tail_lines": -1.0}); r.Decision != core.DecisionDeny || !strings.Contains(r.Reason, "non-negative integer") {
+		t.Fatalf("negative tail_lines: %s (%s)", r.Decision, r.Reason)
+	}
+}
@@ -0,0 +1,304 @@
+package expr
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Type is a static type. TAny values (e.g. intent params) are checked at evaluation time.
+type Type int
+
+const (
+	TAny Type = iota
+	TBool
+	TNumber
+	TString
+	TList
+	TMap
+	TNull
+)
+
+func (t Type) String() string {
+	return [...]string{"any", "bool", "number", "string", "list", "map", "null"}[t]
+}
+
+// schema describes a value in the environment. Maps with Fields have a fixed set of keys;
+// maps without Fields have arbitrary keys whose values have type Elem.
+type schema struct {
+	typ    Type
+	fields map[string]*schema
+	elem   *schema
+}
+
+var (
+	anyS    = &schema{typ: TAny}
+	boolS   = &schema{typ: TBool}
+	numberS = &schema{typ: TNumber}
+	stringS = &schema{typ: TString}
+	nullS   = &schema{typ: TNull}
+	listS   = &schema{typ: TList, elem: anyS}
+	paramsS = &schema{typ: TMap, elem: anyS}
+)
+
+// envSchema is the policy environment visible to expressions.
+var envSchema = map[string]*schema{
+	"param": paramsS,
+	"intent": {typ: TMap, fields: map[string]*schema{
+		"tool":    stringS,
+		"subject": stringS,
+		"params":  paramsS,
+	}},
+	"subject": stringS,
+	"session": {typ: TMap, fields: map[string]*schema{
+		"id":       stringS,
+		"label":    stringS,
+		"metadata": {typ: TMap, elem: stringS},
+	}},
+	"time": {typ: TMap, fields: map[string]*schema{
+		"unix":    numberS,
+		"hour":    numberS,
+		"minute":  numberS,
+		"weekday": numberS,
+		"date":    stringS,
+	}},
+}
+
+type method struct {
+	recv   Type
+	args   []Type
+	result *schema
+}
+
+var methods = map[string]method{
+	"startsWith": {TString, []Type{TString}, boolS},
+	"endsWith":   {TString, []Type{TString}, boolS},
+	"contains":   {TAny, []Type{TAny}, boolS}, // string contains substring, list contains element
+	"matches":    {TString, []Type{TString}, boolS},
+	"lower":      {TString, nil, stringS},
+	"upper":      {TString, nil, stringS},
+	"cleanPath":  {TString, nil, stringS},
+	"size":       {TAny, nil, numberS}, // string, list or map
+	"has":        {TMap, []Type{TString}, boolS},
+}
+
+// compatible reports whether a value of static type got may be used where want is expected.
+func compatible(got, want Type) bool {
+	return got == want || got == TAny || want == TAny
+}
+
+// check type-checks n and returns its schema.
+func check(n *node) (*schema, error) {
+	switch n.kind {
+	case nLiteral:
+		switch n.value.(type) {
+		case bool:
+			return boolS, nil
+		case float64:
+			return numberS, nil
+		case string:
+			return stringS, nil
+		}
+		return nullS, nil
+	case nIdent:
+		s, ok := envSchema[n.op]
+		if !ok {
+			return nil, errorf(n.pos, "unknown identifier %q (available: %s)", n.op, strings.Join(envNames(), ", "))
+		}
+		return s, nil
+	case nMember:
+		x, err := check(n.x)
+		if err != nil {
+			return nil, err
+		}
+		return member(x, n.op, n.pos)
+	case nIndex:
+		x, err := check(n.x)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := check(n.y)
+		if err != nil {
+			return nil, err
+		}
+		switch x.typ {
+		case TList:
+			if !compatible(idx.typ, TNumber) {
+				return nil, errorf(n.pos, "list index must be a number, got %s", idx.typ)
+			}
+			return x.elem, nil
+		case TMap:
+			if !compatible(idx.typ, TString) {
+				return nil, errorf(n.pos, "map key must be a string, got %s", idx.typ)
+			}
+			if x.fields != nil {
+				if lit, ok := n.y.value.(string); ok && n.y.kind == nLiteral {
+					return member(x, lit, n.pos)
+				}
+				return anyS, nil
+			}
+			return x.elem, nil
+		case TAny:
+			return anyS, nil
+		}
+		return nil, errorf(n.pos, "cannot index %s", x.typ)
+	case nCall:
+		return checkCall(n)
+	case nUnary:
+		x, err := check(n.x)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "!" {
+			if !compatible(x.typ, TBool) {
+				return nil, errorf(n.pos, "operator ! needs bool, got %s", x.typ)
+			}
+			return boolS, nil
+		}
+		if !compatible(x.typ, TNumber) {
+			return nil, errorf(n.pos, "unary - needs number, got %s", x.typ)
+		}
+		return numberS, nil
+	case nBinary:
+		return checkBinary(n)
+	case nList:
+		for _, e := range n.args {
+			if _, err := check(e); err != nil {
+				return nil, err
+			}
+		}
+		return listS, nil
+	}
+	return nil, errorf(n.pos, "invalid expression")
+}
+
+func member(x *schema, name string, pos int) (*schema, error) {
+	switch x.typ {
+	case TAny:
+		return anyS, nil
+	case TMap:
+		if x.fields != nil {
+			f, ok := x.fields[name]
+			if !ok {
+				keys := make([]string, 0, len(x.fields))
+				for k := range x.fields {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				return nil, errorf(pos, "unknown field %q (available: %s)", name, strings.Join(keys, ", "))
+			}
+			return f, nil
+		}
+		return x.elem, nil
+	}
+	return nil, errorf(pos, "%s has no field %q", x.typ, name)
+}
+
+func checkCall(n *node) (*schema, error) {
+	m, ok := methods[n.op]
+	if !ok {
+		names := make([]string, 0, len(methods))
+		for k := range methods {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return nil, errorf(n.pos, "unknown method %q (available: %s)", n.op, strings.Join(names, ", "))
+	}
+	recv, err := check(n.x)
+	if err != nil {
+		return nil, err
+	}
+	if !compatible(recv.typ, m.recv) {
+		return nil, errorf(n.pos, "%s() not defined on %s", n.op, recv.typ)
+	}
+	if (n.op == "size" || n.op == "contains") && recv.typ != TAny && recv.typ != TString && recv.typ != TList && !(n.op == "size" && recv.typ == TMap) {
+		return nil, errorf(n.pos, "%s() not defined on %s", n.op, recv.typ)
+	}
+	if len(n.args) != len(m.args) {
+		return nil, errorf(n.pos, "%s() takes %d argument(s), got %d", n.op, len(m.args), len(n.args))
+	}
+	for i, a := range n.args {
+		at, err := check(a)
+		if err != nil {
+			return nil, err
+		}
+		want := m.args[i]
+		if n.op == "contains" && recv.typ == TString {
+			want = TString
+		}
+		if !compatible(at.typ, want) {
+			return nil, errorf(a.pos, "%s() argument %d must be %s, got %s", n.op, i+1, want, at.typ)
+		}
+	}
+	if n.op == "matches" {
+		lit, ok := n.args[0].value.(string)
+		if n.args[0].kind != nLiteral || !ok {
+			return nil, errorf(n.args[0].pos, "matches() pattern must be a string literal")
+		}
+		re, err := regexp.Compile(lit)
+		if err != nil {
+			return nil, errorf(n.args[0].pos, "invalid pattern: %v", err)
+		}
+		n.re = re
+	}
+	return m.result, nil
+}
+
+func checkBinary(n *node) (*schema, error) {
+	x, err := check(n.x)
+	if err != nil {
+		return nil, err
+	}
+	y, err := check(n.y)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "&&", "||":
+		if !compatible(x.typ, TBool) || !compatible(y.typ, TBool) {
+			return nil, errorf(n.pos, "operator %s needs bool operands, got %s and %s", n.op, x.typ, y.typ)
+		}
+		return boolS, nil
+	case "==", "!=":
+		if x.typ != TAny && y.typ != TAny && x.typ != TNull && y.typ != TNull && x.typ != y.typ {
+			return nil, errorf(n.pos, "cannot compare %s with %s", x.typ, y.typ)
+		}
+		return boolS, nil
+	case "<", "<=", ">", ">=":
+		ok := (compatible(x.typ, TNumber) && compatible(y.typ, TNumber)) || (compatible(x.typ, TString) && compatible(y.typ, TString))
+		if !ok {
+			return nil, errorf(n.pos, "operator %s needs two numbers or two strings, got %s and %s", n.op, x.typ, y.typ)
+		}
+		return boolS, nil
+	case "in":
+		if y.typ != TAny && y.typ != TList && y.typ != TMap && y.typ != TString {
+			return nil, errorf(n.pos, "right side of in must be a list, map or string, got %s", y.typ)
+		}
+		return boolS, nil
+	case "+":
+		if compatible(x.typ, TString) && compatible(y.typ, TString) && (x.typ == TString || y.typ == TString) {
+			return stringS, nil
+		}
+		if compatible(x.typ, TNumber) && compatible(y.typ, TNumber) {
+			if x.typ == TAny && y.typ == TAny {
+				return anyS, nil
+			}
+			return numberS, nil
+		}
+		return nil, errorf(n.pos, "operator + needs two numbers or two strings, got %s and %s", x.typ, y.typ)
+	default: // - * / %
+		if !compatible(x.typ, TNumber) || !compatible(y.typ, TNumber) {
+			return nil, errorf(n.pos, "operator %s needs numbers, got %s and %s", n.op, x.typ, y.typ)
+		}
+		return numberS, nil
+	}
+}
+
+func envNames() []string {
+	names := make([]string, 0, len(envSchema))
+	for k := range envSchema {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
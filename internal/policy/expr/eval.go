@@ -0,0 +1,443 @@
+package expr
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Program is a compiled, type-checked condition. It is safe for concurrent use.
+type Program struct {
+	src  string
+	root *node
+}
+
+// Env is the data a condition can read: the intent, its subject, the session and the current time.
+// time.* fields are computed in Now's location (zero Now means time.Now() in UTC).
+type Env struct {
+	Tool            string
+	Subject         string
+	Params          map[string]interface{}
+	SessionID       string
+	SessionLabel    string
+	SessionMetadata map[string]string
+	Now             time.Time
+}
+
+// Compile parses and type-checks src. The expression must evaluate to bool.
+func Compile(src string) (*Program, error) {
+	root, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	s, err := check(root)
+	if err != nil {
+		return nil, err
+	}
+	if s.typ != TBool && s.typ != TAny {
+		return nil, &Error{Msg: fmt.Sprintf("condition must be bool, got %s", s.typ)}
+	}
+	return &Program{src: src, root: root}, nil
+}
+
+// String returns the source of the program.
+func (p *Program) String() string { return p.src }
+
+// Eval evaluates the condition. Errors (e.g. calling startsWith on a missing param) are returned
+// rather than treated as false; callers decide whether to fail closed.
+func (p *Program) Eval(env Env) (bool, error) {
+	vars := env.vars()
+	v, err := eval(p.root, vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, &Error{Msg: fmt.Sprintf("condition evaluated to %s, not bool", typeOf(v))}
+	}
+	return b, nil
+}
+
+func (env Env) vars() map[string]interface{} {
+	params := normalize(env.Params)
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	meta := make(map[string]interface{}, len(env.SessionMetadata))
+	for k, v := range env.SessionMetadata {
+		meta[k] = v
+	}
+	now := env.Now
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+	return map[string]interface{}{
+		"param": params,
+		"intent": map[string]interface{}{
+			"tool":    env.Tool,
+			"subject": env.Subject,
+			"params":  params,
+		},
+		"subject": env.Subject,
+		"session": map[string]interface{}{
+			"id":       env.SessionID,
+			"label":    env.SessionLabel,
+			"metadata": meta,
+		},
+		"time": map[string]interface{}{
+			"unix":    float64(now.Unix()),
+			"hour":    float64(now.Hour()),
+			"minute":  float64(now.Minute()),
+			"weekday": float64(now.Weekday()),
+			"date":    now.Format("2006-01-02"),
+		},
+	}
+}
+
+// normalize converts Go values from callers (ints, []string, ...) into the JSON-shaped values
+// the evaluator works with: float64, string, bool, nil, []interface{}, map[string]interface{}.
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil, bool, float64, string:
+		return x
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			out[k] = normalize(e)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, e := range x {
+			out[i] = normalize(e)
+		}
+		return out
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			out[i] = normalize(rv.Index(i).Interface())
+		}
+		return out
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			out := make(map[string]interface{}, rv.Len())
+			iter := rv.MapRange()
+			for iter.Next() {
+				out[iter.Key().String()] = normalize(iter.Value().Interface())
+			}
+			return out
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+func typeOf(v interface{}) Type {
+	switch v.(type) {
+	case bool:
+		return TBool
+	case float64:
+		return TNumber
+	case string:
+		return TString
+	case []interface{}:
+		return TList
+	case map[string]interface{}:
+		return TMap
+	case nil:
+		return TNull
+	}
+	return TAny
+}
+
+func eval(n *node, vars map[string]interface{}) (interface{}, error) {
+	switch n.kind {
+	case nLiteral:
+		return n.value, nil
+	case nIdent:
+		return vars[n.op], nil
+	case nMember:
+		x, err := eval(n.x, vars)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := x.(map[string]interface{})
+		if !ok {
+			return nil, errorf(n.pos, "cannot read field %q of %s", n.op, typeOf(x))
+		}
+		return m[n.op], nil // missing keys are null
+	case nIndex:
+		x, err := eval(n.x, vars)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := eval(n.y, vars)
+		if err != nil {
+			return nil, err
+		}
+		switch c := x.(type) {
+		case []interface{}:
+			f, ok := idx.(float64)
+			if !ok || f != float64(int(f)) {
+				return nil, errorf(n.pos, "list index must be an integer")
+			}
+			if int(f) < 0 || int(f) >= len(c) {
+				return nil, nil
+			}
+			return c[int(f)], nil
+		case map[string]interface{}:
+			k, ok := idx.(string)
+			if !ok {
+				return nil, errorf(n.pos, "map key must be a string")
+			}
+			return c[k], nil
+		}
+		return nil, errorf(n.pos, "cannot index %s", typeOf(x))
+	case nCall:
+		return evalCall(n, vars)
+	case nUnary:
+		x, err := eval(n.x, vars)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "!" {
+			b, ok := x.(bool)
+			if !ok {
+				return nil, errorf(n.pos, "operator ! needs bool, got %s", typeOf(x))
+			}
+			return !b, nil
+		}
+		f, ok := x.(float64)
+		if !ok {
+			return nil, errorf(n.pos, "unary - needs number, got %s", typeOf(x))
+		}
+		return -f, nil
+	case nBinary:
+		return evalBinary(n, vars)
+	case nList:
+		out := make([]interface{}, len(n.args))
+		for i, a := range n.args {
+			v, err := eval(a, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	}
+	return nil, errorf(n.pos, "invalid expression")
+}
+
+func evalCall(n *node, vars map[string]interface{}) (interface{}, error) {
+	recv, err := eval(n.x, vars)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		if args[i], err = eval(a, vars); err != nil {
+			return nil, err
+		}
+	}
+	strArg := func(i int) (string, error) {
+		s, ok := args[i].(string)
+		if !ok {
+			return "", errorf(n.args[i].pos, "%s() argument %d must be string, got %s", n.op, i+1, typeOf(args[i]))
+		}
+		return s, nil
+	}
+	switch r := recv.(type) {
+	case string:
+		switch n.op {
+		case "startsWith", "endsWith", "contains":
+			a, err := strArg(0)
+			if err != nil {
+				return nil, err
+			}
+			switch n.op {
+			case "startsWith":
+				return strings.HasPrefix(r, a), nil
+			case "endsWith":
+				return strings.HasSuffix(r, a), nil
+			}
+			return strings.Contains(r, a), nil
+		case "matches":
+			return n.re.MatchString(r), nil
+		case "lower":
+			return strings.ToLower(r), nil
+		case "upper":
+			return strings.ToUpper(r), nil
+		case "cleanPath":
+			return path.Clean(strings.ReplaceAll(r, "\\", "/")), nil
+		case "size":
+			return float64(len(r)), nil
+		}
+	case []interface{}:
+		switch n.op {
+		case "contains":
+			for _, e := range r {
+				if equal(e, args[0]) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case "size":
+			return float64(len(r)), nil
+		}
+	case map[string]interface{}:
+		switch n.op {
+		case "has":
+			k, err := strArg(0)
+			if err != nil {
+				return nil, err
+			}
+			_, ok := r[k]
+			return ok, nil
+		case "size":
+			return float64(len(r)), nil
+		}
+	}
+	return nil, errorf(n.pos, "%s() not defined on %s", n.op, typeOf(recv))
+}
+
+func evalBinary(n *node, vars map[string]interface{}) (interface{}, error) {
+	x, err := eval(n.x, vars)
+	if err != nil {
+		return nil, err
+	}
+	// Short-circuit logic
+	if n.op == "&&" || n.op == "||" {
+		xb, ok := x.(bool)
+		if !ok {
+			return nil, errorf(n.pos, "operator %s needs bool, got %s", n.op, typeOf(x))
+		}
+		if (n.op == "&&" && !xb) || (n.op == "||" && xb) {
+			return xb, nil
+		}
+		y, err := eval(n.y, vars)
+		if err != nil {
+			return nil, err
+		}
+		yb, ok := y.(bool)
+		if !ok {
+			return nil, errorf(n.pos, "operator %s needs bool, got %s", n.op, typeOf(y))
+		}
+		return yb, nil
+	}
+	y, err := eval(n.y, vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(x, y), nil
+	case "!=":
+		return !equal(x, y), nil
+	case "in":
+		switch c := y.(type) {
+		case []interface{}:
+			for _, e := range c {
+				if equal(e, x) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			k, ok := x.(string)
+			if !ok {
+				return nil, errorf(n.pos, "map key must be a string")
+			}
+			_, found := c[k]
+			return found, nil
+		case string:
+			k, ok := x.(string)
+			if !ok {
+				return nil, errorf(n.pos, "left side of in must be a string")
+			}
+			return strings.Contains(c, k), nil
+		}
+		return nil, errorf(n.pos, "right side of in must be a list, map or string, got %s", typeOf(y))
+	case "<", "<=", ">", ">=":
+		if xf, ok := x.(float64); ok {
+			if yf, ok := y.(float64); ok {
+				return compare(n.op, cmpFloat(xf, yf)), nil
+			}
+		}
+		if xs, ok := x.(string); ok {
+			if ys, ok := y.(string); ok {
+				return compare(n.op, strings.Compare(xs, ys)), nil
+			}
+		}
+		return nil, errorf(n.pos, "operator %s needs two numbers or two strings, got %s and %s", n.op, typeOf(x), typeOf(y))
+	case "+":
+		if xs, ok := x.(string); ok {
+			if ys, ok := y.(string); ok {
+				return xs + ys, nil
+			}
+		}
+	}
+	xf, ok1 := x.(float64)
+	yf, ok2 := y.(float64)
+	if !ok1 || !ok2 {
+		return nil, errorf(n.pos, "operator %s needs numbers, got %s and %s", n.op, typeOf(x), typeOf(y))
+	}
+	switch n.op {
+	case "+":
+		return xf + yf, nil
+	case "-":
+		return xf - yf, nil
+	case "*":
+		return xf * yf, nil
+	case "/":
+		if yf == 0 {
+			return nil, errorf(n.pos, "division by zero")
+		}
+		return xf / yf, nil
+	case "%":
+		if int64(yf) == 0 {
+			return nil, errorf(n.pos, "division by zero")
+		}
+		return float64(int64(xf) % int64(yf)), nil
+	}
+	return nil, errorf(n.pos, "unknown operator %s", n.op)
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compare(op string, c int) bool {
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case []interface{}, map[string]interface{}:
+		return reflect.DeepEqual(x, b)
+	}
+	return a == b
+}
@@ -0,0 +1,100 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+	env := Env{
+		Tool:            "file.read",
+		Subject:         "agent",
+		Params:          map[string]interface{}{"path": "/work/docs/../notes.md", "size": 42, "tags": []string{"a", "b"}},
+		SessionID:       "sess_1",
+		SessionLabel:    "demo",
+		SessionMetadata: map[string]string{"team": "infra"},
+		Now:             time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC), // Tuesday
+	}
+	cases := []struct {
+		src  string
+		want bool
+	}{
+		{`param.path.startsWith("/work")`, true},
+		{`param.path.cleanPath() == "/work/notes.md"`, true},
+		{`param.path.endsWith(".env")`, false},
+		{`param.size > 40 && param.size <= 42`, true},
+		{`param.size * 2 == 84`, true},
+		{`"b" in param.tags && !("c" in param.tags)`, true},
+		{`param.tags.contains("a") && param.tags.size() == 2`, true},
+		{`param.missing == null`, true},
+		{`param.has("path") && !param.has("missing")`, true},
+		{`intent.tool == "file.read" && subject == "agent"`, true},
+		{`session.metadata.team == "infra" && session.label.upper() == "DEMO"`, true},
+		{`time.hour >= 9 && time.hour < 18 && time.weekday in [1, 2, 3, 4, 5]`, true},
+		{`time.date == "2024-03-05"`, true},
+		{`param.path.matches("^/work/[a-z]+/")`, true},
+		{`false && param.missing.startsWith("x")`, false}, // short-circuit: rhs never runs
+		{`true || 1 / 0 == 1`, true},
+		{`'single' + "double" == "singledouble"`, true},
+	}
+	for _, tc := range cases {
+		p, err := Compile(tc.src)
+		if err != nil {
+			t.Fatalf("%s: compile: %v", tc.src, err)
+		}
+		got, err := p.Eval(env)
+		if err != nil {
+			t.Fatalf("%s: eval: %v", tc.src, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%s: got %v, want %v", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	cases := []struct {
+		src string
+		msg string
+	}{
+		{`param.path.startsWith(`, "unexpected end"},
+		{`param.path ==`, "unexpected end"},
+		{`foo == 1`, "unknown identifier"},
+		{`time.year == 2024`, "unknown field"},
+		{`param.path.explode()`, "unknown method"},
+		{`time.hour.startsWith("1")`, "not defined on number"},
+		{`time.hour == "9"`, "cannot compare"},
+		{`time.hour + 1`, "must be bool"},
+		{`param.path.matches(param.re)`, "string literal"},
+		{`param.path.matches("(")`, "invalid pattern"},
+		{`"unterminated`, "unterminated string"},
+		{`param.path # 1`, "unexpected character"},
+		{strings.Repeat("(", 100) + "true" + strings.Repeat(")", 100), "nested too deeply"},
+		{strings.Repeat("a", MaxSourceLen+1), "too long"},
+	}
+	for _, tc := range cases {
+		_, err := Compile(tc.src)
+		if err == nil || !strings.Contains(err.Error(), tc.msg) {
+			t.Fatalf("%.40s: expected error containing %q, got %v", tc.src, tc.msg, err)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	env := Env{Params: map[string]interface{}{"n": 0, "s": "x"}}
+	for _, src := range []string{
+		`param.missing.startsWith("/")`,
+		`1 / param.n == 1`,
+		`param.s > 1`,
+		`param.s`,
+	} {
+		p, err := Compile(src)
+		if err != nil {
+			t.Fatalf("%s: compile: %v", src, err)
+		}
+		if _, err := p.Eval(env); err == nil {
+			t.Fatalf("%s: expected evaluation error", src)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package expr is a small, sandboxed, side-effect-free expression language for policy rule conditions,
+// e.g. param.path.startsWith("/work") && !param.path.endsWith(".env").
+//
+// Expressions have no loops, assignments or I/O; evaluation cost is bounded by the size of the source.
+// Compile parses and type-checks against the policy environment (param, intent, subject, session, time)
+// so that bad rules are rejected when the policy is saved rather than when it is evaluated.
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// MaxSourceLen bounds expression size (and so evaluation cost).
+const MaxSourceLen = 2048
+
+// Error is a compile or evaluation error with the 1-based column it refers to (0 if unknown).
+type Error struct {
+	Col int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	if e.Col > 0 {
+		return fmt.Sprintf("col %d: %s", e.Col, e.Msg)
+	}
+	return e.Msg
+}
+
+func errorf(pos int, format string, args ...interface{}) *Error {
+	return &Error{Col: pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string // identifier, operator, or decoded string literal
+	num  float64
+	pos  int
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "!", "<", ">", "+", "-", "*", "/", "%", "(", ")", "[", "]", ".", ","}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			start := i
+			quote := c
+			i++
+			var b strings.Builder
+			closed := false
+			for i < len(src) {
+				ch := src[i]
+				if ch == quote {
+					closed = true
+					i++
+					break
+				}
+				if ch == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					case '\\', '"', '\'':
+						b.WriteByte(src[i])
+					default:
+						return nil, errorf(i, "unknown escape \\%c", src[i])
+					}
+					i++
+					continue
+				}
+				b.WriteByte(ch)
+				i++
+			}
+			if !closed {
+				return nil, errorf(start, "unterminated string")
+			}
+			toks = append(toks, token{kind: tokString, text: b.String(), pos: start})
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.') {
+				i++
+			}
+			var n float64
+			if _, err := fmt.Sscanf(src[start:i], "%g", &n); err != nil {
+				return nil, errorf(start, "invalid number %q", src[start:i])
+			}
+			toks = append(toks, token{kind: tokNumber, num: n, text: src[start:i], pos: start})
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, text: src[start:i], pos: start})
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					toks = append(toks, token{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, errorf(i, "unexpected character %q", c)
+			}
+		}
+	}
+	toks = append(toks, token{kind: tokEOF, pos: len(src)})
+	return toks, nil
+}
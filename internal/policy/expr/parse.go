@@ -0,0 +1,308 @@
+package expr
+
+import "regexp"
+
+// maxDepth bounds nesting so deeply nested input cannot exhaust the stack.
+const maxDepth = 64
+
+type nodeKind int
+
+const (
+	nLiteral nodeKind = iota
+	nIdent
+	nMember // x.name
+	nIndex  // x[i]
+	nCall   // x.name(args)
+	nUnary
+	nBinary
+	nList
+)
+
+type node struct {
+	kind  nodeKind
+	pos   int
+	op    string      // operator, identifier, member or method name
+	value interface{} // literal value
+	x, y  *node
+	args  []*node
+	re    *regexp.Regexp // compiled pattern for matches()
+}
+
+type parser struct {
+	toks  []token
+	i     int
+	depth int
+}
+
+func parse(src string) (*node, error) {
+	if len(src) > MaxSourceLen {
+		return nil, &Error{Msg: "expression too long"}
+	}
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorf(t.pos, "unexpected %q", t.text)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return (t.kind == tokOp || t.kind == tokIdent) && t.text == op
+}
+
+func (p *parser) expect(op string) error {
+	t := p.next()
+	if t.kind != tokOp || t.text != op {
+		if t.kind == tokEOF {
+			return errorf(t.pos, "expected %q, got end of expression", op)
+		}
+		return errorf(t.pos, "expected %q, got %q", op, t.text)
+	}
+	return nil
+}
+
+func (p *parser) enter(pos int) error {
+	p.depth++
+	if p.depth > maxDepth {
+		return errorf(pos, "expression nested too deeply")
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (*node, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		t := p.next()
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = &node{kind: nBinary, pos: t.pos, op: "||", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseAnd() (*node, error) {
+	x, err := p.parseCmp()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		t := p.next()
+		y, err := p.parseCmp()
+		if err != nil {
+			return nil, err
+		}
+		x = &node{kind: nBinary, pos: t.pos, op: "&&", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseCmp() (*node, error) {
+	x, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.isOp(op) {
+			t := p.next()
+			y, err := p.parseAdd()
+			if err != nil {
+				return nil, err
+			}
+			return &node{kind: nBinary, pos: t.pos, op: op, x: x, y: y}, nil
+		}
+	}
+	return x, nil
+}
+
+func (p *parser) parseAdd() (*node, error) {
+	x, err := p.parseMul()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		t := p.next()
+		y, err := p.parseMul()
+		if err != nil {
+			return nil, err
+		}
+		x = &node{kind: nBinary, pos: t.pos, op: t.text, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseMul() (*node, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*") || p.isOp("/") || p.isOp("%") {
+		t := p.next()
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = &node{kind: nBinary, pos: t.pos, op: t.text, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseUnary() (*node, error) {
+	if p.isOp("!") || p.isOp("-") {
+		t := p.next()
+		if err := p.enter(t.pos); err != nil {
+			return nil, err
+		}
+		x, err := p.parseUnary()
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		return &node{kind: nUnary, pos: t.pos, op: t.text, x: x}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (*node, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.isOp("."):
+			p.next()
+			name := p.next()
+			if name.kind != tokIdent {
+				return nil, errorf(name.pos, "expected field or method name after '.'")
+			}
+			if p.isOp("(") {
+				p.next()
+				if err := p.enter(name.pos); err != nil {
+					return nil, err
+				}
+				args, err := p.parseArgs(")")
+				p.depth--
+				if err != nil {
+					return nil, err
+				}
+				x = &node{kind: nCall, pos: name.pos, op: name.text, x: x, args: args}
+			} else {
+				x = &node{kind: nMember, pos: name.pos, op: name.text, x: x}
+			}
+		case p.isOp("["):
+			t := p.next()
+			if err := p.enter(t.pos); err != nil {
+				return nil, err
+			}
+			idx, err := p.parseOr()
+			p.depth--
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &node{kind: nIndex, pos: t.pos, x: x, y: idx}
+		default:
+			return x, nil
+		}
+	}
+}
+
+// parseArgs parses a comma-separated list up to the closing token (already past the opener).
+func (p *parser) parseArgs(closer string) ([]*node, error) {
+	var args []*node
+	if p.isOp(closer) {
+		p.next()
+		return args, nil
+	}
+	for {
+		a, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+		if p.isOp(",") {
+			p.next()
+			continue
+		}
+		if err := p.expect(closer); err != nil {
+			return nil, err
+		}
+		return args, nil
+	}
+}
+
+func (p *parser) parsePrimary() (*node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &node{kind: nLiteral, pos: t.pos, value: t.num}, nil
+	case tokString:
+		return &node{kind: nLiteral, pos: t.pos, value: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &node{kind: nLiteral, pos: t.pos, value: true}, nil
+		case "false":
+			return &node{kind: nLiteral, pos: t.pos, value: false}, nil
+		case "null":
+			return &node{kind: nLiteral, pos: t.pos, value: nil}, nil
+		case "in":
+			return nil, errorf(t.pos, "unexpected %q", t.text)
+		}
+		return &node{kind: nIdent, pos: t.pos, op: t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			if err := p.enter(t.pos); err != nil {
+				return nil, err
+			}
+			x, err := p.parseOr()
+			p.depth--
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		case "[":
+			if err := p.enter(t.pos); err != nil {
+				return nil, err
+			}
+			elems, err := p.parseArgs("]")
+			p.depth--
+			if err != nil {
+				return nil, err
+			}
+			return &node{kind: nList, pos: t.pos, args: elems}, nil
+		}
+	case tokEOF:
+		return nil, errorf(t.pos, "unexpected end of expression")
+	}
+	return nil, errorf(t.pos, "unexpected %q", t.text)
+}
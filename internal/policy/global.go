@@ -0,0 +1,330 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GlobalPolicy is the organization-wide layer beneath per-session overrides, loaded from a JSON file.
+// Rules with allow=false deny a tool for every session; rules with allow=true grant it where no session
+// rule matches. Ceilings bound the constraints of every grant per tool: session overrides can narrow
+// them but never widen them. TTLs set the default and maximum token lifetime per tool ("*" for all tools).
+// Redaction configures the broker's output filter (see RedactionRule).
+//
+//	{
+//	  "rules":     [{"tool": "docker.run", "allow": false}],
+//	  "ceilings":  {"file.read": {"roots": ["/work"], "max_bytes": 1048576},
+//	                "http.fetch": {"forbidden_domains": ["internal.example.com"]}},
+//	  "ttls":      {"docker.run": {"default": 300}, "*": {"max": 600}},
+//	  "redaction": [{"name": "pem", "action": "block"}]
+//	}
+type GlobalPolicy struct {
+	Rules     []RuleOverride                    `json:"rules"`
+	Ceilings  map[string]map[string]interface{} `json:"ceilings"`
+	TTLs      map[string]TTLPolicy              `json:"ttls,omitempty"`
+	Redaction []RedactionRule                   `json:"redaction,omitempty"`
+}
+
+// TTLPolicy bounds the lifetime, in seconds, of tokens issued for a tool.
+type TTLPolicy struct {
+	Default int64 `json:"default,omitempty"` // used when the deciding rule sets no ttl_seconds
+	Max     int64 `json:"max,omitempty"`     // cap on any token's lifetime, including rule ttl_seconds
+}
+
+// Policy layers, in the order they are consulted.
+const (
+	LayerBuiltin = "builtin"
+	LayerGlobal  = "global"
+	LayerPack    = "pack"
+	LayerSession = "session"
+)
+
+// LoadGlobalPolicy reads a global policy file. A missing file yields an empty policy.
+func LoadGlobalPolicy(path string) (*GlobalPolicy, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &GlobalPolicy{}, nil
+		}
+		return nil, err
+	}
+	var gp GlobalPolicy
+	if err := json.Unmarshal(raw, &gp); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := ValidateGlobal(&gp); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &gp, nil
+}
+
+// ceilingKeys are the constraint keys a global ceiling can bound (see applyCeiling).
+var ceilingKeys = map[string]bool{
+	"max_bytes": true, "max_entries": true, "roots": true, "domains": true, "methods": true, "images": true,
+	"modes": true, "extensions": true, "content_types": true, "forbidden_domains": true, "follow_symlinks": true,
+}
+
+// ValidateGlobal checks a global policy's rules, ceilings, TTLs and redaction rules. Ceilings may only
+// use ceilingKeys: an unknown key could not be capped and would otherwise be copied into every grant.
+func ValidateGlobal(gp *GlobalPolicy) error {
+	if err := ValidateRules(gp.Rules); err != nil {
+		return err
+	}
+	for tool, c := range gp.Ceilings {
+		for key, v := range c {
+			if !ceilingKeys[key] {
+				return fmt.Errorf("ceilings[%s]: unknown key %q", tool, key)
+			}
+			if _, ok := v.(bool); key == "follow_symlinks" && !ok {
+				return fmt.Errorf("ceilings[%s]: follow_symlinks must be a boolean", tool)
+			}
+		}
+	}
+	for tool, t := range gp.TTLs {
+		if t.Default < 0 || t.Max < 0 {
+			return fmt.Errorf("ttls[%s]: seconds must not be negative", tool)
+		}
+	}
+	return validateRedaction(gp.Redaction)
+}
+
+// SetGlobalPolicy replaces the global layer.
+func (e *Engine) SetGlobalPolicy(gp *GlobalPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Global = gp
+}
+
+// GlobalPolicy returns the current global layer or nil.
+func (e *Engine) GlobalPolicy() *GlobalPolicy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.Global
+}
+
+// WatchGlobalPolicyFile loads path and then polls it every interval, reloading when its modification
+// time or size changes. A file that fails to parse leaves the previous policy in place. Blocks until stop
+// is closed (nil blocks forever); run it in a goroutine. logf may be nil.
+func (e *Engine) WatchGlobalPolicyFile(path string, interval time.Duration, stop <-chan struct{}, logf func(format string, args ...interface{})) {
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+	var lastMod time.Time
+	var lastSize int64 = -1
+	for {
+		fi, err := os.Stat(path)
+		var mod time.Time
+		var size int64
+		if err == nil {
+			mod, size = fi.ModTime(), fi.Size()
+		}
+		if !mod.Equal(lastMod) || size != lastSize {
+			lastMod, lastSize = mod, size
+			gp, err := LoadGlobalPolicy(path)
+			if err != nil {
+				logf("global policy: %v (keeping previous)", err)
+			} else {
+				e.SetGlobalPolicy(gp)
+				logf("global policy loaded from %s (%d rules, %d ceilings)", path, len(gp.Rules), len(gp.Ceilings))
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// applyCeiling narrows constraints to a tool's global ceiling. Keys the rule omits take the ceiling value;
+// max_bytes and max_entries take the minimum; roots, domains, methods, images, modes, extensions and
+// content_types keep only entries within the ceiling. forbidden_domains is merged so the broker
+// enforces it at execution time; follow_symlinks=false in the ceiling overrides the rule, while true
+// leaves it as the rule has it. Keys outside ceilingKeys are ignored. Returns an error naming the key
+// when nothing of the rule's grant fits under the ceiling.
+func applyCeiling(constraints, ceiling map[string]interface{}) (map[string]interface{}, error) {
+	if len(ceiling) == 0 {
+		return constraints, nil
+	}
+	out := copyConstraints(constraints)
+	keys := make([]string, 0, len(ceiling))
+	for k := range ceiling {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		limit := ceiling[key]
+		cur, has := out[key]
+		switch key {
+		case "max_bytes", "max_entries":
+			lim, ok := number(limit)
+			if !ok {
+				continue
+			}
+			if n, ok := number(cur); !has || !ok || n <= 0 || n > lim {
+				out[key] = lim
+			}
+		case "roots", "domains", "methods", "images", "modes", "extensions", "content_types":
+			allowed, _ := stringList(limit)
+			if !has {
+				out[key] = toInterfaceList(allowed)
+				continue
+			}
+			wanted, _ := stringList(cur)
+			var kept []string
+			for _, w := range wanted {
+				for _, a := range allowed {
+					if withinCeiling(key, w, a) {
+						kept = append(kept, w)
+						break
+					}
+				}
+			}
+			if len(kept) == 0 {
+				return nil, fmt.Errorf("%s outside ceiling", key)
+			}
+			out[key] = toInterfaceList(kept)
+		case "forbidden_domains":
+			forbidden, _ := stringList(limit)
+			existing, _ := stringList(cur)
+			out[key] = toInterfaceList(mergeUnique(existing, forbidden))
+			if domains, ok := stringList(out["domains"]); ok {
+				var kept []string
+				for _, d := range domains {
+					blocked := false
+					for _, f := range forbidden {
+						if domainUnder(d, f) {
+							blocked = true
+							break
+						}
+					}
+					if !blocked {
+						kept = append(kept, d)
+					}
+				}
+				if len(kept) == 0 {
+					return nil, fmt.Errorf("domains forbidden by ceiling")
+				}
+				out["domains"] = toInterfaceList(kept)
+			}
+		case "follow_symlinks":
+			if follow, ok := limit.(bool); ok && !follow {
+				out[key] = false
+			}
+		}
+	}
+	return out, nil
+}
+
+func withinCeiling(key, value, limit string) bool {
+	switch key {
+	case "roots":
+		return pathUnderRoot(value, limit)
+	case "domains":
+		return domainUnder(value, limit)
+	case "methods":
+		return strings.EqualFold(value, limit)
+	case "extensions":
+		return normalizeExt(value) == normalizeExt(limit)
+	case "content_types":
+		return ContentTypeAllowed(value, []string{limit})
+	default:
+		return value == limit
+	}
+}
+
+func mergeUnique(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var out []string
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// EffectiveRule is one rule of the merged policy with the layer that contributed it.
+type EffectiveRule struct {
+	Layer string `json:"layer"`
+	// Pack is the name@version of the pack that contributed the rule (layer "pack").
+	Pack string `json:"pack,omitempty"`
+	RuleOverride
+	// Error is set when a session rule cannot fit under the global ceiling and is therefore inert.
+	Error string `json:"error,omitempty"`
+}
+
+// EffectivePolicy is the merged view of builtin, global and session layers for one session.
+type EffectivePolicy struct {
+	Default  string                            `json:"default"`
+	Rules    []EffectiveRule                   `json:"rules"`
+	Ceilings map[string]map[string]interface{} `json:"ceilings"`
+}
+
+// Effective returns the merged policy for a session (sessionID may be empty for global only),
+// in evaluation order, with session constraints already narrowed by the global ceilings.
+func (e *Engine) Effective(sessionID string) EffectivePolicy {
+	ep := EffectivePolicy{
+		Default:  "deny",
+		Rules:    []EffectiveRule{{Layer: LayerBuiltin, RuleOverride: RuleOverride{Tool: "shell.exec", Allow: false}}},
+		Ceilings: map[string]map[string]interface{}{},
+	}
+	gp := e.GlobalPolicy()
+	if gp != nil {
+		for tool, c := range gp.Ceilings {
+			ep.Ceilings[tool] = c
+		}
+		for _, r := range gp.Rules {
+			if !r.Allow {
+				ep.Rules = append(ep.Rules, EffectiveRule{Layer: LayerGlobal, RuleOverride: r})
+			}
+		}
+	}
+	if sp := e.SessionPolicy(sessionID); sessionID != "" && sp != nil {
+		for _, r := range sp.Overrides {
+			er := EffectiveRule{Layer: LayerSession, RuleOverride: r}
+			if r.Allow && r.Constraints != nil {
+				if c, err := applyCeiling(r.Constraints, ep.Ceilings[r.Tool]); err != nil {
+					er.Error = err.Error()
+				} else {
+					er.Constraints = c
+				}
+			}
+			ep.Rules = append(ep.Rules, er)
+		}
+		for _, c := range e.packCandidates(sp) {
+			er := EffectiveRule{Layer: LayerPack, Pack: fmt.Sprintf("%s@%d", c.pack, c.packVersion), RuleOverride: c.rule}
+			if c.rule.Allow && c.rule.Constraints != nil {
+				c2, err := narrowPackRule(c.rule.Constraints, c.narrow)
+				if err == nil {
+					c2, err = applyCeiling(c2, ep.Ceilings[c.rule.Tool])
+				}
+				if err != nil {
+					er.Error = err.Error()
+				} else {
+					er.Constraints = c2
+				}
+			}
+			ep.Rules = append(ep.Rules, er)
+		}
+	}
+	if gp != nil {
+		for _, r := range gp.Rules {
+			if r.Allow {
+				er := EffectiveRule{Layer: LayerGlobal, RuleOverride: r}
+				if c, err := applyCeiling(r.Constraints, ep.Ceilings[r.Tool]); err != nil {
+					er.Error = err.Error()
+				} else {
+					er.Constraints = c
+				}
+				ep.Rules = append(ep.Rules, er)
+			}
+		}
+	}
+	return ep
+}
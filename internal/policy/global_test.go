@@ -0,0 +1,220 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"securetalon/internal/core"
+)
+
+func TestGlobalDenyBeatsSessionAllow(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.SetGlobalPolicy(&GlobalPolicy{Rules: []RuleOverride{{Tool: "docker.run", Allow: false}}})
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "docker.run", Allow: true, Constraints: map[string]interface{}{"images": []string{"a@sha256:1"}}},
+	}})
+	result := engine.Evaluate(core.ToolIntent{Tool: "docker.run"}, "sess_1")
+	if result.Decision != core.DecisionDeny {
+		t.Fatalf("expected global deny, got %s", result.Decision)
+	}
+}
+
+func TestGlobalCeilingNarrowsSessionConstraints(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.SetGlobalPolicy(&GlobalPolicy{Ceilings: map[string]map[string]interface{}{
+		"file.read":  {"roots": []interface{}{"/work"}, "max_bytes": 4096.0},
+		"http.fetch": {"forbidden_domains": []interface{}{"internal.example.com"}},
+	}})
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{
+			"roots":     []string{"/work/project", "/etc"},
+			"max_bytes": 1 << 30,
+		}},
+		{Tool: "http.fetch", Allow: true, Constraints: map[string]interface{}{
+			"domains": []string{"example.com"},
+		}},
+	}})
+
+	result := engine.Evaluate(core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/project/a"}}, "sess_1")
+	if result.Decision != core.DecisionAllow {
+		t.Fatalf("expected ALLOW, got %s: %s", result.Decision, result.Reason)
+	}
+	roots, _ := stringList(result.Token.Constraints["roots"])
+	if len(roots) != 1 || roots[0] != "/work/project" {
+		t.Fatalf("expected roots narrowed to /work/project, got %v", roots)
+	}
+	if mb, _ := number(result.Token.Constraints["max_bytes"]); mb != 4096 {
+		t.Fatalf("expected max_bytes capped at 4096, got %v", mb)
+	}
+
+	result = engine.Evaluate(core.ToolIntent{Tool: "http.fetch", Params: map[string]interface{}{"url": "https://api.example.com/x"}}, "sess_1")
+	if result.Decision != core.DecisionAllow {
+		t.Fatalf("expected ALLOW, got %s: %s", result.Decision, result.Reason)
+	}
+	forbidden, _ := stringList(result.Token.Constraints["forbidden_domains"])
+	if len(forbidden) != 1 || forbidden[0] != "internal.example.com" {
+		t.Fatalf("expected forbidden_domains on token, got %v", forbidden)
+	}
+
+	// A session rule entirely outside the ceiling is denied
+	engine.SetSessionPolicy("sess_2", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/etc"}}},
+	}})
+	result = engine.Evaluate(core.ToolIntent{Tool: "file.read"}, "sess_2")
+	if result.Decision != core.DecisionDeny {
+		t.Fatalf("expected DENY for rule outside ceiling, got %s", result.Decision)
+	}
+
+	ep := engine.Effective("sess_2")
+	var found bool
+	for _, r := range ep.Rules {
+		if r.Layer == LayerSession && r.Tool == "file.read" && r.Error != "" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected inert session rule with error in effective policy: %+v", ep.Rules)
+	}
+}
+
+func TestWatchGlobalPolicyFileReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "global.json")
+	engine := NewEngine(NewIssuer("test-secret"))
+	stop := make(chan struct{})
+	defer close(stop)
+	go engine.WatchGlobalPolicyFile(path, 10*time.Millisecond, stop, nil)
+
+	intent := core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/a"}}
+	if err := os.WriteFile(path, []byte(`{"rules":[{"tool":"file.read","allow":true,"constraints":{"roots":["/work"]}}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for engine.Evaluate(intent, "sess_1").Decision != core.DecisionAllow {
+		if time.Now().After(deadline) {
+			t.Fatal("global policy not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Invalid JSON keeps the previous policy
+	os.WriteFile(path, []byte(`{not json`), 0600)
+	time.Sleep(50 * time.Millisecond)
+	if engine.Evaluate(intent, "sess_1").Decision != core.DecisionAllow {
+		t.Fatal("expected previous policy kept after parse error")
+	}
+}
+
+func TestTokenTTLPrecedenceAndCap(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	if ttl := engine.TokenTTL("file.read", RuleOverride{}); ttl != 60 {
+		t.Fatalf("default TTL = %d, want 60", ttl)
+	}
+	if ttl := engine.TokenTTL("docker.run", RuleOverride{}); ttl != 300 {
+		t.Fatalf("docker.run TTL = %d, want 300", ttl)
+	}
+	engine.SetGlobalPolicy(&GlobalPolicy{TTLs: map[string]TTLPolicy{
+		"file.read":  {Default: 20},
+		"docker.run": {Max: 120},
+		"*":          {Max: 600},
+	}})
+	cases := []struct {
+		tool string
+		rule RuleOverride
+		want int64
+	}{
+		{"file.read", RuleOverride{}, 20},                  // global per-tool default
+		{"file.read", RuleOverride{TTLSeconds: 90}, 90},    // rule beats defaults
+		{"file.read", RuleOverride{TTLSeconds: 3600}, 600}, // capped by "*"
+		{"docker.run", RuleOverride{}, 120},                // engine default capped by the tool max
+		{"docker.run", RuleOverride{TTLSeconds: 900}, 120}, // rule capped by the tool max
+		{"file.write", RuleOverride{}, 30},                 // engine per-tool default
+	}
+	for _, c := range cases {
+		if got := engine.TokenTTL(c.tool, c.rule); got != c.want {
+			t.Errorf("TokenTTL(%s, ttl_seconds=%d) = %d, want %d", c.tool, c.rule.TTLSeconds, got, c.want)
+		}
+	}
+
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{Overrides: []RuleOverride{
+		{Tool: "file.read", Allow: true, TTLSeconds: 45, Constraints: map[string]interface{}{"roots": []string{"/work"}}},
+	}})
+	result := engine.Evaluate(core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/a"}}, "sess_1")
+	if result.Token == nil || result.Token.Exp-result.Token.Iat != 45 {
+		t.Fatalf("expected a 45s token, got %+v", result.Token)
+	}
+
+	// MaxTTL (the signing key retention) caps everything, including the global max
+	engine.MaxTTL = 40
+	if got := engine.TokenTTL("file.read", RuleOverride{TTLSeconds: 3600}); got != 40 {
+		t.Fatalf("TokenTTL with MaxTTL 40 = %d, want 40", got)
+	}
+	if got := engine.TokenTTL("file.read", RuleOverride{}); got != 20 {
+		t.Fatalf("MaxTTL must not raise shorter TTLs, got %d", got)
+	}
+}
+
+func TestCeilingDisablesFollowSymlinks(t *testing.T) {
+	ceiling := map[string]interface{}{"follow_symlinks": false}
+	out, err := applyCeiling(map[string]interface{}{"roots": []string{"/work"}, "follow_symlinks": true}, ceiling)
+	if err != nil || out["follow_symlinks"] != false {
+		t.Fatalf("follow_symlinks = %v (%v), want false", out["follow_symlinks"], err)
+	}
+	out, _ = applyCeiling(map[string]interface{}{"roots": []string{"/work"}, "follow_symlinks": false}, map[string]interface{}{"follow_symlinks": true})
+	if out["follow_symlinks"] != false {
+		t.Fatalf("a ceiling allowing symlinks must not turn them on for a rule, got %v", out["follow_symlinks"])
+	}
+	out, _ = applyCeiling(map[string]interface{}{"roots": []string{"/work"}}, map[string]interface{}{"follow_symlinks": true, "network": "host"})
+	if _, ok := out["follow_symlinks"]; ok {
+		t.Fatalf("a rule omitting follow_symlinks must not inherit the ceiling's true, got %v", out)
+	}
+	if _, ok := out["network"]; ok {
+		t.Fatalf("unknown ceiling keys must not be copied into rules, got %v", out)
+	}
+}
+
+func TestValidateGlobalRejectsUnknownCeilingKeys(t *testing.T) {
+	gp := &GlobalPolicy{Ceilings: map[string]map[string]interface{}{"docker.run": {"network": "host"}}}
+	if err := ValidateGlobal(gp); err == nil || !strings.Contains(err.Error(), "network") {
+		t.Fatalf("expected an unknown ceiling key error, got %v", err)
+	}
+	gp.Ceilings = map[string]map[string]interface{}{"file.read": {"follow_symlinks": "yes"}}
+	if err := ValidateGlobal(gp); err == nil {
+		t.Fatal("expected a non-boolean follow_symlinks ceiling to be rejected")
+	}
+	gp.Ceilings = map[string]map[string]interface{}{"file.read": {"roots": []interface{}{"/work"}, "follow_symlinks": false}}
+	if err := ValidateGlobal(gp); err != nil {
+		t.Fatalf("valid ceiling rejected: %v", err)
+	}
+}
+
+func TestLoadGlobalPolicyValidatesRedaction(t *testing.T) {
+	dir := t.TempDir()
+	load := func(redaction string) (*GlobalPolicy, error) {
+		path := filepath.Join(dir, "global.json")
+		if err := os.WriteFile(path, []byte(`{"redaction":`+redaction+`}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return LoadGlobalPolicy(path)
+	}
+	gp, err := load(`[{"name":"pem","action":"block"},{"name":"ticket","pattern":"TICKET-[0-9]+","action":"mask"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.SetGlobalPolicy(gp)
+	if rules := engine.RedactionRules(); len(rules) != 2 || rules[1].Pattern != "TICKET-[0-9]+" {
+		t.Fatalf("RedactionRules = %+v", rules)
+	}
+	for _, bad := range []string{
+		`[{"name":"pem","action":"shred"}]`,
+		`[{"name":"ticket","action":"redact"}]`,
+		`[{"name":"ticket","pattern":"([","action":"redact"}]`,
+		`[{"name":"email","pattern":"x","action":"redact"}]`,
+	} {
+		if _, err := load(bad); err == nil {
+			t.Errorf("accepted redaction %s", bad)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package policy
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey is returned when a token names a key the verifier does not know (or no longer keeps).
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// SigningKey is one Ed25519 token signing key. The newest key signs; older keys are retired and only
+// verify tokens issued before the rotation, until they are pruned.
+type SigningKey struct {
+	Kid        string             `json:"kid"`
+	PrivateKey ed25519.PrivateKey `json:"private_key"`
+	CreatedAt  time.Time          `json:"created_at"`
+	RetiredAt  *time.Time         `json:"retired_at,omitempty"`
+}
+
+// PublicKeyInfo is the public half of a signing key, safe to publish to verifiers.
+type PublicKeyInfo struct {
+	Kid       string            `json:"kid"`
+	Alg       string            `json:"alg"`
+	PublicKey ed25519.PublicKey `json:"public_key"` // base64
+	CreatedAt time.Time         `json:"created_at"`
+	RetiredAt *time.Time        `json:"retired_at,omitempty"`
+	Active    bool              `json:"active"`
+}
+
+// PublicKeySource resolves a key ID to a public key. Verifiers depend only on this, so a component
+// that verifies tokens cannot mint them.
+type PublicKeySource interface {
+	PublicKey(kid string) (ed25519.PublicKey, bool)
+}
+
+// Keyring holds the active signing key and retired keys, persisted in a private file
+// (e.g. data/keys/keyring.json, mode 0600).
+type Keyring struct {
+	mu   sync.RWMutex
+	path string // empty for in-memory
+	keys []*SigningKey
+	now  func() time.Time
+}
+
+// NewKeyring loads the keyring from dir/keyring.json, creating it with a fresh key if missing.
+// An empty dir keeps the keyring in memory only.
+func NewKeyring(dir string) (*Keyring, error) {
+	kr := &Keyring{now: time.Now}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		kr.path = filepath.Join(dir, "keyring.json")
+		raw, err := os.ReadFile(kr.path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(raw, &kr.keys); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", kr.path, err)
+			}
+		}
+	}
+	for _, k := range kr.keys {
+		if len(k.PrivateKey) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("key %s: invalid private key", k.Kid)
+		}
+	}
+	if len(kr.keys) == 0 {
+		if _, err := kr.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+func newSigningKey(now time.Time) (*SigningKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(pub)
+	return &SigningKey{Kid: "k_" + hex.EncodeToString(sum[:8]), PrivateKey: priv, CreatedAt: now.UTC()}, nil
+}
+
+// Active returns the key that signs new tokens.
+func (kr *Keyring) Active() *SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	if len(kr.keys) == 0 {
+		return nil
+	}
+	return kr.keys[len(kr.keys)-1]
+}
+
+// Rotate generates a new active key and retires the previous one. Retired keys keep verifying
+// in-flight tokens until Prune removes them.
+func (kr *Keyring) Rotate() (*SigningKey, error) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	now := kr.now().UTC()
+	k, err := newSigningKey(now)
+	if err != nil {
+		return nil, err
+	}
+	keys := append([]*SigningKey{}, kr.keys...)
+	if n := len(keys); n > 0 && keys[n-1].RetiredAt == nil {
+		retired := *keys[n-1]
+		retired.RetiredAt = &now
+		keys[n-1] = &retired
+	}
+	keys = append(keys, k)
+	if err := kr.save(keys); err != nil {
+		return nil, err
+	}
+	kr.keys = keys
+	return k, nil
+}
+
+// Prune removes keys retired for longer than retain and returns how many were removed.
+// retain must exceed the longest token TTL so that in-flight tokens stay verifiable.
+func (kr *Keyring) Prune(retain time.Duration) (int, error) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	cutoff := kr.now().UTC().Add(-retain)
+	var keys []*SigningKey
+	for _, k := range kr.keys {
+		if k.RetiredAt != nil && k.RetiredAt.Before(cutoff) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	removed := len(kr.keys) - len(keys)
+	if removed == 0 {
+		return 0, nil
+	}
+	if err := kr.save(keys); err != nil {
+		return 0, err
+	}
+	kr.keys = keys
+	return removed, nil
+}
+
+// save writes keys via temp file + rename. Caller holds kr.mu.
+func (kr *Keyring) save(keys []*SigningKey) error {
+	if kr.path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := kr.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, kr.path)
+}
+
+// PublicKey returns the public key for kid, active or retired.
+func (kr *Keyring) PublicKey(kid string) (ed25519.PublicKey, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	for _, k := range kr.keys {
+		if k.Kid == kid {
+			return k.PrivateKey.Public().(ed25519.PublicKey), true
+		}
+	}
+	return nil, false
+}
+
+// Public returns a view of the keyring that only resolves public keys, for verifiers.
+func (kr *Keyring) Public() PublicKeySource {
+	return publicKeys{kr}
+}
+
+type publicKeys struct{ kr *Keyring }
+
+func (p publicKeys) PublicKey(kid string) (ed25519.PublicKey, bool) {
+	return p.kr.PublicKey(kid)
+}
+
+// PublicKeys lists the public halves of all keys, oldest first.
+func (kr *Keyring) PublicKeys() []PublicKeyInfo {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	out := make([]PublicKeyInfo, 0, len(kr.keys))
+	for i, k := range kr.keys {
+		out = append(out, PublicKeyInfo{
+			Kid:       k.Kid,
+			Alg:       "Ed25519",
+			PublicKey: k.PrivateKey.Public().(ed25519.PublicKey),
+			CreatedAt: k.CreatedAt,
+			RetiredAt: k.RetiredAt,
+			Active:    i == len(kr.keys)-1,
+		})
+	}
+	return out
+}
+
+// RunRotation rotates the active key once it is older than interval and prunes keys retired for
+// longer than retain, checking every check period. Blocks until stop is closed (nil blocks forever);
+// run it in a goroutine. logf may be nil.
+func (kr *Keyring) RunRotation(interval, retain, check time.Duration, stop <-chan struct{}, logf func(format string, args ...interface{})) {
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+	for {
+		if active := kr.Active(); interval > 0 && active != nil && kr.now().Sub(active.CreatedAt) >= interval {
+			if k, err := kr.Rotate(); err != nil {
+				logf("keyring: rotate: %v", err)
+			} else {
+				logf("keyring: rotated signing key, active kid %s", k.Kid)
+			}
+		}
+		if n, err := kr.Prune(retain); err != nil {
+			logf("keyring: prune: %v", err)
+		} else if n > 0 {
+			logf("keyring: pruned %d retired key(s)", n)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(check):
+		}
+	}
+}
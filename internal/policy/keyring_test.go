@@ -0,0 +1,121 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyringIssueAndVerify(t *testing.T) {
+	kr, err := NewKeyring("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := NewKeyringIssuer(kr)
+	verifier := NewKeyringVerifier(kr.Public())
+
+	tok, err := issuer.Issue("sess_1", "agent", "file.read", map[string]interface{}{"roots": []string{"/work"}}, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Kid != kr.Active().Kid {
+		t.Fatalf("kid = %q, want active %q", tok.Kid, kr.Active().Kid)
+	}
+	if err := verifier.Verify(tok); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	tok.Constraints = map[string]interface{}{"roots": []string{"/"}}
+	if verifier.Verify(tok) == nil {
+		t.Fatal("expected verify to fail for tampered constraints")
+	}
+}
+
+func TestKeyringVerifierRejectsHMAC(t *testing.T) {
+	kr, _ := NewKeyring("")
+	tok, _ := NewIssuer("secret").Issue("sess_1", "agent", "file.read", nil, 60)
+	if NewKeyringVerifier(kr.Public()).Verify(tok) == nil {
+		t.Fatal("expected keyring verifier to reject a token without kid")
+	}
+	if _, err := NewIssuer("").Issue("sess_1", "agent", "file.read", nil, 60); err == nil {
+		t.Fatal("expected issuer without secret or keyring to fail")
+	}
+}
+
+func TestKeyringRotationKeepsInFlightTokens(t *testing.T) {
+	kr, _ := NewKeyring("")
+	now := time.Now()
+	kr.now = func() time.Time { return now }
+	issuer := NewKeyringIssuer(kr)
+	verifier := NewKeyringVerifier(kr.Public())
+
+	old, _ := issuer.Issue("sess_1", "agent", "file.read", nil, 60)
+	if _, err := kr.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	fresh, _ := issuer.Issue("sess_1", "agent", "file.read", nil, 60)
+	if fresh.Kid == old.Kid {
+		t.Fatal("expected new tokens to use the rotated key")
+	}
+	if err := verifier.Verify(old); err != nil {
+		t.Fatalf("token signed by retired key rejected: %v", err)
+	}
+	if n, _ := kr.Prune(time.Hour); n != 0 {
+		t.Fatalf("pruned %d keys inside retention", n)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if n, _ := kr.Prune(time.Hour); n != 1 {
+		t.Fatalf("pruned %d keys, want 1", n)
+	}
+	if err := verifier.Verify(old); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("verify after prune = %v, want ErrUnknownKey", err)
+	}
+	if err := verifier.Verify(fresh); err != nil {
+		t.Fatalf("active key token rejected: %v", err)
+	}
+}
+
+func TestKeyringPersists(t *testing.T) {
+	dir := t.TempDir()
+	kr, err := NewKeyring(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, _ := NewKeyringIssuer(kr).Issue("sess_1", "agent", "file.read", nil, 60)
+	kr.Rotate()
+
+	info, err := os.Stat(filepath.Join(dir, "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("keyring mode = %v, want 0600", info.Mode().Perm())
+	}
+	reloaded, err := NewKeyring(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Active().Kid != kr.Active().Kid || len(reloaded.PublicKeys()) != 2 {
+		t.Fatalf("reloaded keyring differs: %+v", reloaded.PublicKeys())
+	}
+	if err := NewKeyringVerifier(reloaded.Public()).Verify(tok); err != nil {
+		t.Fatalf("verify with reloaded keyring: %v", err)
+	}
+}
+
+func TestRunRotation(t *testing.T) {
+	kr, _ := NewKeyring("")
+	first := kr.Active().Kid
+	kr.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	stop := make(chan struct{})
+	close(stop)
+	kr.RunRotation(24*time.Hour, time.Hour, time.Millisecond, stop, nil)
+	if kr.Active().Kid == first {
+		t.Fatal("expected the aged key to be rotated")
+	}
+	if keys := kr.PublicKeys(); len(keys) != 2 || keys[0].RetiredAt == nil || !keys[1].Active {
+		t.Fatalf("keys after rotation: %+v", keys)
+	}
+}
@@ -0,0 +1,211 @@
+package policy
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Lint severities. Policies with error findings are rejected on PUT; warnings and info are reported.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Finding is one problem the linter found in a rule.
+type Finding struct {
+	Rule     int    `json:"rule"` // 1-based position of the rule
+	Name     string `json:"name,omitempty"`
+	Tool     string `json:"tool"`
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Fix      string `json:"fix,omitempty"`
+}
+
+// LintReport is the result of linting a session policy. Score is 0 (no risk) to 100.
+type LintReport struct {
+	Score    int       `json:"score"`
+	Level    string    `json:"level"` // low, medium, high, critical
+	Findings []Finding `json:"findings"`
+}
+
+// HasErrors reports whether any finding is an error.
+func (r LintReport) HasErrors() bool {
+	for _, f := range r.Findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// severityWeight is each finding's contribution to the risk score.
+var severityWeight = map[string]int{SeverityError: 40, SeverityWarning: 15, SeverityInfo: 5}
+
+// knownTools are the tools the broker executes (plus shell.exec, which is always denied).
+var knownTools = map[string]bool{
+	"file.read": true, "file.write": true, "file.list": true, "file.stat": true, "file.delete": true, "file.move": true,
+	"http.fetch": true, "docker.run": true, "shell.exec": true,
+}
+
+// sensitiveRoots hold credentials or system configuration.
+var sensitiveRoots = []string{"/etc", "/root", "/proc", "/sys", "/dev", "/boot", "/usr", "/bin", "/sbin"}
+
+// Lint checks sp for dangerous or ineffective allow rules: filesystem-root or sensitive roots, missing
+// required constraints (roots, domains, images), wildcard or overly broad domains, and unpinned images.
+// Constraints a rule omits are taken from the global ceilings in gp (may be nil), as at evaluation time.
+// A rule that requires approval contributes half the risk.
+func Lint(sp *SessionPolicy, gp *GlobalPolicy) LintReport {
+	report := LintReport{Findings: []Finding{}}
+	if sp == nil {
+		report.Level = riskLevel(0)
+		return report
+	}
+	score := 0
+	for i, r := range sp.Overrides {
+		var ceiling map[string]interface{}
+		if gp != nil {
+			ceiling = gp.Ceilings[r.Tool]
+		}
+		findings := lintRule(r, ceiling)
+		for _, f := range findings {
+			f.Rule, f.Name, f.Tool = i+1, r.Name, r.Tool
+			report.Findings = append(report.Findings, f)
+			w := severityWeight[f.Severity]
+			if r.RequireApproval {
+				w /= 2
+			}
+			score += w
+		}
+	}
+	if score > 100 {
+		score = 100
+	}
+	report.Score = score
+	report.Level = riskLevel(score)
+	return report
+}
+
+func riskLevel(score int) string {
+	switch {
+	case score >= 75:
+		return "critical"
+	case score >= 50:
+		return "high"
+	case score >= 25:
+		return "medium"
+	}
+	return "low"
+}
+
+func lintRule(r RuleOverride, ceiling map[string]interface{}) []Finding {
+	var out []Finding
+	add := func(sev, code, msg, fix string) {
+		out = append(out, Finding{Severity: sev, Code: code, Message: msg, Fix: fix})
+	}
+	if !knownTools[r.Tool] {
+		add(SeverityWarning, "UNKNOWN_TOOL", fmt.Sprintf("tool %q is not a known tool", r.Tool), "Use one of file.read, file.write, file.list, file.stat, file.delete, file.move, http.fetch, docker.run")
+		return out
+	}
+	if !r.Allow {
+		return out
+	}
+	if r.Tool == "shell.exec" {
+		add(SeverityWarning, "NO_EFFECT", "shell.exec is always denied; this rule has no effect", "Remove the rule")
+		return out
+	}
+	// Constraints the rule omits are inherited from the global ceiling.
+	constraint := func(key string) ([]string, bool) {
+		if v, ok := stringList(r.Constraints[key]); ok {
+			return v, true
+		}
+		return stringList(ceiling[key])
+	}
+	switch r.Tool {
+	case "file.read", "file.write", "file.list", "file.stat", "file.delete", "file.move":
+		roots, ok := constraint("roots")
+		if !ok || len(roots) == 0 {
+			add(SeverityError, "MISSING_ROOTS", r.Tool+" rule has no roots constraint", "Add roots listing the directories the tool may access")
+		}
+		for _, root := range roots {
+			clean := filepath.ToSlash(filepath.Clean(root))
+			switch {
+			case root == "" || clean == "/" || (len(clean) == 3 && clean[1] == ':' && clean[2] == '/'):
+				add(SeverityError, "ROOT_FILESYSTEM", fmt.Sprintf("root %q grants the whole filesystem", root), "Use a dedicated working directory such as /work")
+			case isSensitiveRoot(clean):
+				add(SeverityWarning, "SENSITIVE_ROOT", fmt.Sprintf("root %q covers system or credential files", root), "Use a dedicated working directory such as /work")
+			}
+		}
+		if follow, _ := r.Constraints["follow_symlinks"].(bool); follow {
+			add(SeverityInfo, "FOLLOW_SYMLINKS", r.Tool+" rule follows symlinks; their targets must still lie under the roots", "Remove follow_symlinks unless the roots contain symlinks the tool needs")
+		}
+		if (r.Tool == "file.delete" || r.Tool == "file.move") && !r.RequireApproval {
+			add(SeverityInfo, "DESTRUCTIVE_TOOL", r.Tool+" rule lets the agent remove or replace files under its roots without approval", "Set require_approval or narrow the roots")
+		}
+		types, _ := stringList(r.Constraints["content_types"])
+		for _, ct := range types {
+			if parts := strings.SplitN(ct, "/", 2); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				add(SeverityWarning, "INVALID_CONTENT_TYPE", fmt.Sprintf("content type %q is not a type/subtype media type", ct), `Use media types such as "text/plain" or "image/*"`)
+			}
+		}
+		if r.Tool == "file.write" {
+			modes, _ := stringList(r.Constraints["modes"])
+			for _, m := range modes {
+				if !WriteModes[m] {
+					add(SeverityWarning, "UNKNOWN_MODE", fmt.Sprintf("write mode %q is not a known mode", m), "Use overwrite, append, create_only or patch")
+				}
+			}
+			if _, ok := number(r.Constraints["max_bytes"]); !ok {
+				if _, ok := number(ceiling["max_bytes"]); !ok {
+					add(SeverityWarning, "MISSING_MAX_BYTES", "file.write rule has no max_bytes limit", "Add max_bytes")
+				}
+			}
+		}
+	case "http.fetch":
+		domains, ok := constraint("domains")
+		if !ok || len(domains) == 0 {
+			add(SeverityError, "MISSING_DOMAINS", "http.fetch rule has no domains allowlist, so any domain is reachable", "Add domains listing the hosts the tool may fetch")
+		}
+		for _, d := range domains {
+			switch {
+			case strings.Contains(d, "*"):
+				add(SeverityError, "WILDCARD_DOMAIN", fmt.Sprintf("wildcard domain %q", d), "List domains explicitly; subdomains of a listed domain already match")
+			case !strings.Contains(strings.Trim(d, "."), "."):
+				add(SeverityError, "BROAD_DOMAIN", fmt.Sprintf("domain %q matches every host under a top-level domain", d), "List registered domains such as api.example.com")
+			}
+		}
+		methods, ok := constraint("methods")
+		if !ok || len(methods) == 0 {
+			add(SeverityWarning, "MISSING_METHODS", "http.fetch rule allows every HTTP method", `Add methods, e.g. ["GET"]`)
+		}
+		for _, m := range methods {
+			switch strings.ToUpper(m) {
+			case "GET", "HEAD", "OPTIONS":
+			default:
+				add(SeverityInfo, "WRITE_METHOD", fmt.Sprintf("method %s can change remote state", strings.ToUpper(m)), "Allow only the methods the task needs")
+			}
+		}
+	case "docker.run":
+		images, ok := constraint("images")
+		if !ok || len(images) == 0 {
+			add(SeverityError, "MISSING_IMAGES", "docker.run rule has no images allowlist", "Add images pinned by digest (image@sha256:...)")
+		}
+		for _, img := range images {
+			if !strings.Contains(img, "@sha256:") {
+				add(SeverityError, "UNPINNED_IMAGE", fmt.Sprintf("image %q is not pinned by digest", img), "Use image@sha256:...")
+			}
+		}
+	}
+	return out
+}
+
+func isSensitiveRoot(root string) bool {
+	for _, s := range sensitiveRoots {
+		if root == s || strings.HasPrefix(root, s+"/") {
+			return true
+		}
+	}
+	return strings.Contains(root, "/.ssh") || strings.Contains(root, "/.aws") || strings.Contains(root, "/.gnupg")
+}
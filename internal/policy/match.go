@@ -0,0 +1,235 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"securetalon/internal/core"
+)
+
+// Rule precedence (see docs/backend/API-SPEC.md):
+//  1. builtin shell.exec deny
+//  2. deny beats allow: any matching deny rule (global or session) denies the intent
+//  3. more specific beats less specific: among matching rules of the same effect, the one whose
+//     scope is narrowest (deepest root, longest domain, plus methods/images/modes/extensions) decides
+//  4. on equal specificity, session rules come before pack rules, then global rules, then list order
+//
+// A rule's scope is its roots, domains, methods, images, modes and extensions constraints. A rule
+// without scope constraints matches every intent for its tool with specificity 0. A when condition
+// narrows the rule further and adds 1 to its specificity.
+
+// scopeKeys are the constraints that define which intents a rule applies to.
+var scopeKeys = []string{"roots", "domains", "methods", "images", "modes", "extensions"}
+
+// candidate is a rule with its position, used to pick and name the deciding rule.
+type candidate struct {
+	layer string
+	index int // 1-based position within its layer (or pack)
+	rule  RuleOverride
+
+	// Pack rules only: the pack version and the session's narrowing for the rule's tool.
+	pack        string
+	packVersion int
+	narrow      map[string]interface{}
+}
+
+// ref is a short stable identifier of the rule, e.g. "session#2" or "pack:crm-sync@3#1".
+func (c candidate) ref() string {
+	if c.pack != "" {
+		return fmt.Sprintf("%s:%s@%d#%d", c.layer, c.pack, c.packVersion, c.index)
+	}
+	return fmt.Sprintf("%s#%d", c.layer, c.index)
+}
+
+// quotaKey identifies the rule for its limit counters independently of its position, so reordering
+// or inserting rules neither resets nor shares quotas: the rule's name within its layer (and pack,
+// across pack versions), or for an unnamed rule a digest of its content without the limits (editing
+// an unnamed rule's scope starts new counters; raising its limits does not).
+func (c candidate) quotaKey() string {
+	prefix := c.layer
+	if c.pack != "" {
+		prefix += ":" + c.pack
+	}
+	if c.rule.Name != "" {
+		return prefix + ":" + c.rule.Name
+	}
+	r := c.rule
+	r.Limits = nil
+	raw, _ := json.Marshal(r)
+	sum := sha256.Sum256(raw)
+	return prefix + ":" + hex.EncodeToString(sum[:8])
+}
+
+// decided stamps the deciding rule (and its pack) on a result.
+func (c candidate) decided(r core.PolicyResult) core.PolicyResult {
+	r.Rule = c.ref()
+	r.Pack, r.PackVersion = c.pack, c.packVersion
+	return r
+}
+
+// describe names the rule for PolicyResult.Reason, e.g. `session rule #2 "no-secrets" (deny file.read roots=[/work/secrets])`.
+func (c candidate) describe() string {
+	var b strings.Builder
+	if c.pack != "" {
+		fmt.Fprintf(&b, "%s %s@%d rule #%d", c.layer, c.pack, c.packVersion, c.index)
+	} else {
+		fmt.Fprintf(&b, "%s rule #%d", c.layer, c.index)
+	}
+	if c.rule.Name != "" {
+		fmt.Fprintf(&b, " %q", c.rule.Name)
+	}
+	effect := "deny"
+	if c.rule.Allow {
+		effect = "allow"
+	}
+	fmt.Fprintf(&b, " (%s %s", effect, c.rule.Tool)
+	for _, key := range scopeKeys {
+		if vals, ok := stringList(c.rule.Constraints[key]); ok {
+			fmt.Fprintf(&b, " %s=[%s]", key, strings.Join(vals, ","))
+		}
+	}
+	if c.rule.When != "" {
+		fmt.Fprintf(&b, " when=%q", c.rule.When)
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// bestMatch returns the most specific candidate for intent's tool with the given effect whose scope
+// contains the intent params, or nil. A deny rule matches file.move by its path or its dest.
+func bestMatch(cands []candidate, tool string, allow bool, params map[string]interface{}) *candidate {
+	var best *candidate
+	bestSpec := -1
+	for i := range cands {
+		c := &cands[i]
+		if c.rule.Tool != tool || c.rule.Allow != allow {
+			continue
+		}
+		ok, spec := scopeMatch(c.rule, params)
+		if dest, isMove := params["dest"].(string); !ok && !allow && isMove && tool == "file.move" {
+			// A deny rule also covers a move into its scope.
+			ok, spec = scopeMatch(c.rule, map[string]interface{}{"path": dest})
+		}
+		if ok && spec > bestSpec {
+			best, bestSpec = c, spec
+		}
+	}
+	return best
+}
+
+// scopeMatch reports whether params fall inside every scope constraint of the rule, and how specific
+// the matching entries are.
+func scopeMatch(r RuleOverride, params map[string]interface{}) (bool, int) {
+	spec := 0
+	if roots, ok := stringList(r.Constraints["roots"]); ok {
+		path, _ := params["path"].(string)
+		depth := -1
+		for _, root := range roots {
+			if pathUnderRoot(path, root) {
+				if d := pathDepth(root); d > depth {
+					depth = d
+				}
+			}
+		}
+		if depth < 0 {
+			return false, 0
+		}
+		spec += depth
+	}
+	if domains, ok := stringList(r.Constraints["domains"]); ok {
+		rawURL, _ := params["url"].(string)
+		host := hostOf(rawURL)
+		labels := -1
+		for _, d := range domains {
+			if host != "" && domainUnder(host, d) {
+				if n := strings.Count(d, ".") + 1; n > labels {
+					labels = n
+				}
+			}
+		}
+		if labels < 0 {
+			return false, 0
+		}
+		spec += labels
+	}
+	if methods, ok := stringList(r.Constraints["methods"]); ok {
+		method, _ := params["method"].(string)
+		if method == "" {
+			method = "GET"
+		}
+		found := false
+		for _, m := range methods {
+			if strings.EqualFold(m, method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, 0
+		}
+		spec++
+	}
+	if modes, ok := stringList(r.Constraints["modes"]); ok {
+		mode, _ := params["mode"].(string)
+		if mode == "" {
+			mode = "overwrite"
+		}
+		found := false
+		for _, m := range modes {
+			if m == mode {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, 0
+		}
+		spec++
+	}
+	if images, ok := stringList(r.Constraints["images"]); ok {
+		image, _ := params["image"].(string)
+		found := false
+		for _, img := range images {
+			if img == image {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, 0
+		}
+		spec++
+	}
+	if exts, ok := stringList(r.Constraints["extensions"]); ok {
+		path, _ := params["path"].(string)
+		if !ExtensionAllowed(path, exts) {
+			return false, 0
+		}
+		spec++
+	}
+	if r.When != "" {
+		spec++
+	}
+	return true, spec
+}
+
+func pathDepth(root string) int {
+	root = strings.Trim(strings.ReplaceAll(root, "\\", "/"), "/")
+	if root == "" {
+		return 0
+	}
+	return strings.Count(root, "/") + 1
+}
+
+// hostOf returns the lowercase host of a URL without port, or "".
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
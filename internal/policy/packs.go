@@ -0,0 +1,337 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrPackNotFound is returned when a pack (or the requested version of it) does not exist.
+var ErrPackNotFound = errors.New("policy pack not found")
+
+var rePackName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// Pack is one immutable version of a named, reusable bundle of rules (e.g. "read-only-workspace").
+// Sessions reference packs by name@version in SessionPolicy.Packs; rules are resolved at evaluation time.
+type Pack struct {
+	Name        string         `json:"name"`
+	Version     int            `json:"version"`
+	Description string         `json:"description,omitempty"`
+	Rules       []RuleOverride `json:"rules"`
+	Author      string         `json:"author"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Hash        string         `json:"hash"`
+	// Deleted marks a tombstone record: the pack is hidden and cannot be newly referenced,
+	// but versions already referenced by sessions keep resolving.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// PackRef references a pack version from a session policy. Narrow optionally narrows the pack's
+// allow rules per tool, like a ceiling (e.g. {"file.read": {"roots": ["/work/docs"]}}).
+type PackRef struct {
+	Ref    string                            `json:"ref"` // name@version
+	Narrow map[string]map[string]interface{} `json:"narrow,omitempty"`
+}
+
+// ParsePackRef splits "name@version". version is 0 when omitted (meaning latest).
+func ParsePackRef(ref string) (string, int, error) {
+	name, ver, hasVer := strings.Cut(ref, "@")
+	if !rePackName.MatchString(name) {
+		return "", 0, fmt.Errorf("invalid pack name %q", name)
+	}
+	if !hasVer {
+		return name, 0, nil
+	}
+	v, err := strconv.Atoi(ver)
+	if err != nil || v < 1 {
+		return "", 0, fmt.Errorf("invalid pack version %q", ver)
+	}
+	return name, v, nil
+}
+
+// PackStore is an append-only JSONL log of pack versions and deletions (e.g. data/policy/packs.jsonl).
+type PackStore struct {
+	mu       sync.Mutex
+	dir      string
+	versions map[string][]*Pack
+	deleted  map[string]bool
+}
+
+// NewPackStore creates a pack store under dir and loads existing packs.
+func NewPackStore(dir string) (*PackStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &PackStore{dir: dir, versions: make(map[string][]*Pack), deleted: make(map[string]bool)}
+	f, err := os.Open(s.path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		var p Pack
+		if err := dec.Decode(&p); err != nil {
+			break
+		}
+		s.apply(&p)
+	}
+	return s, nil
+}
+
+func (s *PackStore) path() string {
+	return filepath.Join(s.dir, "packs.jsonl")
+}
+
+func (s *PackStore) apply(p *Pack) {
+	if p.Deleted {
+		s.deleted[p.Name] = true
+		return
+	}
+	s.deleted[p.Name] = false
+	s.versions[p.Name] = append(s.versions[p.Name], p)
+}
+
+func (s *PackStore) write(p *Pack) error {
+	f, err := os.OpenFile(s.path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(p); err != nil {
+		return err
+	}
+	s.apply(p)
+	return nil
+}
+
+// Put records rules as the next version of the named pack (version 1 for a new name). Putting a
+// deleted pack restores it.
+func (s *PackStore) Put(name, description, author string, rules []RuleOverride) (*Pack, error) {
+	if !rePackName.MatchString(name) {
+		return nil, fmt.Errorf("invalid pack name %q", name)
+	}
+	if rules == nil {
+		rules = []RuleOverride{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := &Pack{
+		Name:        name,
+		Version:     1,
+		Description: description,
+		Rules:       rules,
+		Author:      author,
+		CreatedAt:   time.Now().UTC(),
+		Hash:        PolicyHash(&SessionPolicy{Overrides: rules}),
+	}
+	if vs := s.versions[name]; len(vs) > 0 {
+		p.Version = vs[len(vs)-1].Version + 1
+	}
+	if err := s.write(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Delete hides the pack from List and from new references. Referenced versions keep resolving.
+func (s *PackStore) Delete(name, author string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vs := s.versions[name]
+	if len(vs) == 0 || s.deleted[name] {
+		return ErrPackNotFound
+	}
+	return s.write(&Pack{Name: name, Version: vs[len(vs)-1].Version, Author: author, CreatedAt: time.Now().UTC(), Deleted: true})
+}
+
+// Get returns a version of a pack; version 0 returns the latest version of a pack that is not deleted.
+func (s *PackStore) Get(name string, version int) (*Pack, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vs := s.versions[name]
+	if version == 0 {
+		if len(vs) == 0 || s.deleted[name] {
+			return nil, ErrPackNotFound
+		}
+		return vs[len(vs)-1], nil
+	}
+	for _, p := range vs {
+		if p.Version == version {
+			return p, nil
+		}
+	}
+	return nil, ErrPackNotFound
+}
+
+// Versions returns every version of a pack, oldest first.
+func (s *PackStore) Versions(name string) []*Pack {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Pack{}, s.versions[name]...)
+}
+
+// List returns the latest version of every pack that is not deleted, sorted by name.
+func (s *PackStore) List() []*Pack {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []*Pack{}
+	for name, vs := range s.versions {
+		if len(vs) > 0 && !s.deleted[name] {
+			out = append(out, vs[len(vs)-1])
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// PinPackRefs checks that every pack sp references exists and that its narrowing is valid (see
+// validateNarrow), and pins refs without a version to the current latest version, so a session keeps
+// its behavior when a pack is updated.
+// Returns a *ValidationError listing bad references.
+func (e *Engine) PinPackRefs(sp *SessionPolicy) error {
+	if sp == nil || len(sp.Packs) == 0 {
+		return nil
+	}
+	var errs []RuleError
+	for i := range sp.Packs {
+		ref := &sp.Packs[i]
+		name, version, err := ParsePackRef(ref.Ref)
+		if err == nil {
+			err = validateNarrow(ref.Narrow)
+		}
+		if err == nil && e.Packs == nil {
+			err = errors.New("policy packs are not available")
+		}
+		if err == nil {
+			var p *Pack
+			if p, err = e.Packs.Get(name, version); err == nil {
+				if version == 0 {
+					ref.Ref = fmt.Sprintf("%s@%d", p.Name, p.Version)
+				} else if latest, lerr := e.Packs.Get(name, 0); lerr != nil || latest == nil {
+					err = fmt.Errorf("pack %s is deleted", name)
+				}
+			}
+		}
+		if err != nil {
+			errs = append(errs, RuleError{Index: i + 1, Field: "packs", Error: err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Rules: errs}
+	}
+	return nil
+}
+
+// validateNarrow checks a pack reference's narrowing. Like a ceiling it may only use ceilingKeys, and
+// follow_symlinks may only be false: narrowing must never loosen a pack rule.
+func validateNarrow(narrow map[string]map[string]interface{}) error {
+	for tool, c := range narrow {
+		for key, v := range c {
+			if !ceilingKeys[key] {
+				return fmt.Errorf("narrow[%s]: unknown key %q", tool, key)
+			}
+			if follow, ok := v.(bool); key == "follow_symlinks" && (!ok || follow) {
+				return fmt.Errorf("narrow[%s]: follow_symlinks can only be false", tool)
+			}
+		}
+	}
+	return nil
+}
+
+// packCandidates resolves a session policy's pack references into candidates. Unresolvable references
+// contribute no rules.
+func (e *Engine) packCandidates(sp *SessionPolicy) []candidate {
+	if sp == nil || e.Packs == nil {
+		return nil
+	}
+	var cands []candidate
+	for _, ref := range sp.Packs {
+		name, version, err := ParsePackRef(ref.Ref)
+		if err != nil {
+			continue
+		}
+		p, err := e.Packs.Get(name, version)
+		if err != nil {
+			continue
+		}
+		for j, r := range p.Rules {
+			cands = append(cands, candidate{
+				layer: LayerPack, index: j + 1, rule: r,
+				pack: p.Name, packVersion: p.Version, narrow: ref.Narrow[r.Tool],
+			})
+		}
+	}
+	return cands
+}
+
+// narrowPackRule intersects a pack rule's constraints with the session's narrowing for its tool.
+// Unlike a ceiling, narrowing may name entries beneath the rule's (e.g. roots /work/crm under /work):
+// roots and domains keep the narrower of each overlapping pair, methods, images, modes, extensions and
+// content_types the common entries, max_bytes and max_entries the minimum, and forbidden_domains
+// are added; follow_symlinks may only be turned off. Returns an error naming the key when nothing
+// overlaps, or for any other key, which could loosen the rule (see validateNarrow).
+func narrowPackRule(constraints, narrow map[string]interface{}) (map[string]interface{}, error) {
+	if len(narrow) == 0 {
+		return constraints, nil
+	}
+	out := copyConstraints(constraints)
+	for key, limit := range narrow {
+		cur, has := out[key]
+		switch key {
+		case "max_bytes", "max_entries":
+			lim, ok := number(limit)
+			if !ok {
+				continue
+			}
+			if n, ok := number(cur); !has || !ok || n <= 0 || n > lim {
+				out[key] = lim
+			}
+		case "roots", "domains", "methods", "images", "modes", "extensions", "content_types":
+			allowed, _ := stringList(limit)
+			if !has {
+				out[key] = toInterfaceList(allowed)
+				continue
+			}
+			wanted, _ := stringList(cur)
+			var kept []string
+			for _, w := range wanted {
+				for _, a := range allowed {
+					switch {
+					case withinCeiling(key, w, a):
+						kept = append(kept, w)
+					case withinCeiling(key, a, w):
+						kept = append(kept, a)
+					}
+				}
+			}
+			if len(kept) == 0 {
+				return nil, fmt.Errorf("%s outside narrowing", key)
+			}
+			out[key] = toInterfaceList(mergeUnique(kept, nil))
+		case "forbidden_domains":
+			added, _ := stringList(limit)
+			existing, _ := stringList(cur)
+			out[key] = toInterfaceList(mergeUnique(existing, added))
+		case "follow_symlinks":
+			if follow, ok := limit.(bool); !ok || follow {
+				return nil, fmt.Errorf("follow_symlinks can only be narrowed to false")
+			}
+			out[key] = false
+		default:
+			return nil, fmt.Errorf("%s cannot be narrowed", key)
+		}
+	}
+	return out, nil
+}
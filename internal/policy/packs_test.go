@@ -0,0 +1,117 @@
+package policy
+
+import (
+	"testing"
+
+	"securetalon/internal/core"
+)
+
+func TestPackStoreVersionsAndReload(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewPackStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := []RuleOverride{{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work"}}}}
+	if p, _ := s.Put("read-only-workspace", "", "stan", rules); p.Version != 1 {
+		t.Fatalf("expected version 1, got %d", p.Version)
+	}
+	if p, _ := s.Put("read-only-workspace", "", "stan", nil); p.Version != 2 {
+		t.Fatalf("expected version 2, got %d", p.Version)
+	}
+	if err := s.Delete("read-only-workspace", "stan"); err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewPackStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.List()) != 0 {
+		t.Fatal("deleted pack must not be listed")
+	}
+	if _, err := s.Get("read-only-workspace", 0); err != ErrPackNotFound {
+		t.Fatalf("expected latest of deleted pack not found, got %v", err)
+	}
+	if p, err := s.Get("read-only-workspace", 1); err != nil || len(p.Rules) != 1 {
+		t.Fatalf("pinned version must keep resolving, got %v", err)
+	}
+}
+
+func TestPackRulesResolvedAtEvaluation(t *testing.T) {
+	packs, err := NewPackStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	packs.Put("crm-sync", "", "stan", []RuleOverride{
+		{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work"}}},
+		{Tool: "file.read", Allow: false, Constraints: map[string]interface{}{"roots": []string{"/work/secrets"}}},
+	})
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.Packs = packs
+	sp := &SessionPolicy{Packs: []PackRef{{Ref: "crm-sync", Narrow: map[string]map[string]interface{}{
+		"file.read": {"roots": []string{"/work/crm"}},
+	}}}}
+	if _, err := engine.PutSessionPolicy("sess_1", "stan", sp); err != nil {
+		t.Fatal(err)
+	}
+	if sp.Packs[0].Ref != "crm-sync@1" {
+		t.Fatalf("expected ref pinned to crm-sync@1, got %s", sp.Packs[0].Ref)
+	}
+	// A newer pack version does not change the pinned session
+	packs.Put("crm-sync", "", "stan", nil)
+
+	result := engine.Evaluate(core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/crm/a.csv"}}, "sess_1")
+	if result.Decision != core.DecisionAllow || result.Pack != "crm-sync" || result.PackVersion != 1 || result.Rule != "pack:crm-sync@1#1" {
+		t.Fatalf("expected ALLOW by pack:crm-sync@1#1, got %s by %s (%s@%d)", result.Decision, result.Rule, result.Pack, result.PackVersion)
+	}
+	if roots, _ := stringList(result.Token.Constraints["roots"]); len(roots) != 1 || roots[0] != "/work/crm" {
+		t.Fatalf("expected token roots narrowed to /work/crm, got %v", roots)
+	}
+	result = engine.Evaluate(core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/other/a.csv"}}, "sess_1")
+	if result.Decision != core.DecisionDeny {
+		t.Fatalf("expected narrowing to deny /work/other, got %s", result.Decision)
+	}
+	result = engine.Evaluate(core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/secrets/key"}}, "sess_1")
+	if result.Decision != core.DecisionDeny || result.Rule != "pack:crm-sync@1#2" {
+		t.Fatalf("expected DENY by pack deny rule, got %s by %s", result.Decision, result.Rule)
+	}
+
+	if _, err := engine.PutSessionPolicy("sess_2", "stan", &SessionPolicy{Packs: []PackRef{{Ref: "missing@1"}}}); err == nil {
+		t.Fatal("expected unknown pack to be rejected")
+	}
+}
+
+func TestPackNarrowingCannotLoosen(t *testing.T) {
+	packs, err := NewPackStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	packs.Put("read-only-workspace", "", "stan", []RuleOverride{
+		{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work"}}},
+	})
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.Packs = packs
+	for _, narrow := range []map[string]interface{}{
+		{"follow_symlinks": true},
+		{"unknown": "anything"},
+	} {
+		sp := &SessionPolicy{Packs: []PackRef{{Ref: "read-only-workspace", Narrow: map[string]map[string]interface{}{"file.read": narrow}}}}
+		if _, err := engine.PutSessionPolicy("sess_1", "stan", sp); err == nil {
+			t.Errorf("narrowing %v accepted", narrow)
+		}
+	}
+	if _, err := narrowPackRule(map[string]interface{}{"roots": []string{"/work"}}, map[string]interface{}{"follow_symlinks": true}); err == nil {
+		t.Error("narrowPackRule copied follow_symlinks: true into the grant")
+	}
+
+	sp := &SessionPolicy{Packs: []PackRef{{Ref: "read-only-workspace", Narrow: map[string]map[string]interface{}{
+		"file.read": {"follow_symlinks": false, "max_bytes": 100.0},
+	}}}}
+	if _, err := engine.PutSessionPolicy("sess_1", "stan", sp); err != nil {
+		t.Fatal(err)
+	}
+	result := engine.Evaluate(core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/a.txt"}}, "sess_1")
+	if result.Token == nil || result.Token.Constraints["follow_symlinks"] != false || result.Token.Constraints["max_bytes"] != 100.0 {
+		t.Fatalf("expected a narrowed grant, got %s %+v", result.Decision, result.Token)
+	}
+}
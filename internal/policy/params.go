@@ -0,0 +1,296 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"securetalon/internal/safefs"
+)
+
+// WriteModes are the file.write modes, shared by the decision (checkParams, lint) and the broker's
+// doFileWrite so the two cannot disagree.
+var WriteModes = map[string]bool{"overwrite": true, "append": true, "create_only": true, "patch": true}
+
+var reSHA256 = regexp.MustCompile(`^(sha256:)?[0-9a-fA-F]{64}$`)
+
+// violation explains why intent params fall outside a rule's constraints.
+type violation struct {
+	reason string
+	fix    string
+}
+
+// FileContent returns the content param of a file.write intent decoded per its encoding param (utf8,
+// the default, or base64).
+func FileContent(params map[string]interface{}) ([]byte, error) {
+	content, ok := params["content"].(string)
+	if !ok && params["content"] != nil {
+		return nil, fmt.Errorf("content must be a string")
+	}
+	switch enc, _ := params["encoding"].(string); enc {
+	case "", "utf8":
+		return []byte(content), nil
+	case "base64":
+		b, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return nil, fmt.Errorf("content is not valid base64: %v", err)
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", enc)
+	}
+}
+
+// SummarizeParams returns params for records that must not keep file contents, such as the audit log:
+// a string content is replaced by its sha256, decoded size and sniffed MIME type, which the policy
+// checks in place of the content (a summarized intent is never executable: the broker needs the bytes).
+func SummarizeParams(params map[string]interface{}) map[string]interface{} {
+	content, ok := params["content"].(string)
+	if !ok {
+		return params
+	}
+	data, err := FileContent(params)
+	if err != nil {
+		data = []byte(content)
+	}
+	sum := sha256.Sum256(data)
+	out := copyConstraints(params)
+	out["content"] = map[string]interface{}{
+		"sha256": hex.EncodeToString(sum[:]),
+		"bytes":  len(data),
+		"mime":   http.DetectContentType(data),
+	}
+	return out
+}
+
+// contentInfo returns the decoded size and sniffed MIME type of a file.write content, or the ones
+// recorded by SummarizeParams.
+func contentInfo(params map[string]interface{}) (int, string, error) {
+	if summary, ok := params["content"].(map[string]interface{}); ok {
+		size, _ := number(summary["bytes"])
+		mime, _ := summary["mime"].(string)
+		return int(size), mime, nil
+	}
+	content, err := FileContent(params)
+	if err != nil {
+		return 0, "", err
+	}
+	return len(content), http.DetectContentType(content), nil
+}
+
+// checkParams evaluates intent params against a rule's (ceiling-narrowed) constraints at decision time,
+// mirroring what the broker enforces at execution time, so out-of-scope intents never receive a token.
+func checkParams(tool string, params, constraints map[string]interface{}) *violation {
+	switch tool {
+	case "file.read", "file.write", "file.list", "file.stat", "file.delete", "file.move":
+		path, _ := params["path"].(string)
+		if path == "" {
+			return &violation{"path param required", "Set params.path"}
+		}
+		roots, ok := stringList(constraints["roots"])
+		if !ok || len(roots) == 0 {
+			return &violation{"rule has no roots constraint", "Add a roots constraint to the rule"}
+		}
+		paths := []string{path}
+		if tool == "file.move" {
+			dest, _ := params["dest"].(string)
+			if dest == "" {
+				return &violation{"dest param required", "Set params.dest"}
+			}
+			paths = append(paths, dest)
+		}
+		for _, p := range paths {
+			if v := checkPath(p, roots); v != nil {
+				return v
+			}
+		}
+		if tool == "file.read" || tool == "file.write" {
+			if enc, _ := params["encoding"].(string); enc != "" && enc != "utf8" && enc != "base64" {
+				return &violation{fmt.Sprintf("unknown encoding %q", enc), "Use encoding utf8 or base64"}
+			}
+			if exts, ok := stringList(constraints["extensions"]); ok && !ExtensionAllowed(path, exts) {
+				return &violation{
+					fmt.Sprintf("extension of %s not in allowed extensions [%s]", path, strings.Join(exts, ",")),
+					fmt.Sprintf("Use a file with one of [%s] or add its extension to the rule's extensions", strings.Join(exts, ",")),
+				}
+			}
+		}
+		if tool == "file.read" {
+			for _, key := range []string{"offset", "length", "tail_lines", "start_line", "end_line"} {
+				if v, ok := params[key]; ok {
+					if n, ok := number(v); !ok || n < 0 || n != math.Trunc(n) {
+						return &violation{key + " must be a non-negative integer", "Set " + key + " to a whole number of bytes or lines"}
+					}
+				}
+			}
+			n, hasN := number(params["length"])
+			if max, ok := number(constraints["max_bytes"]); ok && max > 0 && hasN && n > max {
+				return &violation{
+					fmt.Sprintf("length %.0f exceeds the rule's max_bytes %.0f", n, max),
+					"Read a smaller range or raise the rule's max_bytes",
+				}
+			}
+		}
+		if tool == "file.write" {
+			size, ct, err := contentInfo(params)
+			if err != nil {
+				return &violation{err.Error(), "Encode content as standard base64 or use encoding utf8"}
+			}
+			if max, ok := number(constraints["max_bytes"]); ok && max > 0 && float64(size) > max {
+				return &violation{
+					fmt.Sprintf("content of %d bytes exceeds max_bytes %.0f", size, max),
+					"Write smaller content or raise the rule's max_bytes",
+				}
+			}
+			mode, _ := params["mode"].(string)
+			if mode == "" {
+				mode = "overwrite"
+			}
+			// A patch's content is a diff; the broker checks the patched file's type.
+			if types, ok := stringList(constraints["content_types"]); ok && mode != "patch" {
+				if !ContentTypeAllowed(ct, types) {
+					return &violation{
+						fmt.Sprintf("content type %s not in allowed content types [%s]", ct, strings.Join(types, ",")),
+						"Write content of an allowed type or add its type to the rule's content_types",
+					}
+				}
+			}
+			if !WriteModes[mode] {
+				return &violation{fmt.Sprintf("unknown write mode %q", mode), "Use mode overwrite, append, create_only or patch"}
+			}
+			if modes, ok := stringList(constraints["modes"]); ok && !ContainsString(modes, mode) {
+				return &violation{
+					fmt.Sprintf("write mode %s not in allowed modes [%s]", mode, strings.Join(modes, ",")),
+					fmt.Sprintf("Use one of [%s] or add %s to the rule's modes", strings.Join(modes, ","), mode),
+				}
+			}
+			if expected, ok := params["expected_sha256"].(string); ok && expected != "" && !reSHA256.MatchString(expected) {
+				return &violation{"expected_sha256 is not a hex SHA-256", "Set expected_sha256 to the 64 hex digits of the file's SHA-256"}
+			}
+		}
+		if tool == "file.list" {
+			n, hasN := number(params["max_entries"])
+			if max, ok := number(constraints["max_entries"]); ok && max > 0 && hasN && n > max {
+				return &violation{
+					fmt.Sprintf("max_entries %.0f exceeds the rule's max_entries %.0f", n, max),
+					"Request fewer entries or raise the rule's max_entries",
+				}
+			}
+		}
+	case "http.fetch":
+		rawURL, _ := params["url"].(string)
+		if rawURL == "" {
+			return &violation{"url param required", "Set params.url"}
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Hostname() == "" {
+			return &violation{fmt.Sprintf("url %q is not an absolute URL", rawURL), "Use an absolute http(s) URL"}
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return &violation{fmt.Sprintf("url scheme %q not allowed", u.Scheme), "Use an http or https URL"}
+		}
+		host := strings.ToLower(u.Hostname())
+		if forbidden, ok := stringList(constraints["forbidden_domains"]); ok {
+			for _, f := range forbidden {
+				if domainUnder(host, f) {
+					return &violation{fmt.Sprintf("domain %s is forbidden by policy", host), "Use a different domain"}
+				}
+			}
+		}
+		if domains, ok := stringList(constraints["domains"]); ok {
+			allowed := false
+			for _, d := range domains {
+				if domainUnder(host, d) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return &violation{
+					fmt.Sprintf("domain %s not in allowed domains [%s]", host, strings.Join(domains, ",")),
+					fmt.Sprintf("Add %s to the rule's domains", host),
+				}
+			}
+		}
+		if methods, ok := stringList(constraints["methods"]); ok && len(methods) > 0 {
+			method, _ := params["method"].(string)
+			if method == "" {
+				method = "GET"
+			}
+			allowed := false
+			for _, m := range methods {
+				if strings.EqualFold(m, method) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return &violation{
+					fmt.Sprintf("method %s not in allowed methods [%s]", strings.ToUpper(method), strings.Join(methods, ",")),
+					fmt.Sprintf("Use one of [%s] or add %s to the rule's methods", strings.Join(methods, ","), strings.ToUpper(method)),
+				}
+			}
+		}
+	case "docker.run":
+		image, _ := params["image"].(string)
+		if image == "" {
+			return &violation{"image param required", "Set params.image to image@sha256:..."}
+		}
+		if !strings.Contains(image, "@sha256:") {
+			return &violation{fmt.Sprintf("image %s is not pinned by digest", image), "Use image@sha256:..."}
+		}
+		if images, ok := stringList(constraints["images"]); ok && len(images) > 0 {
+			allowed := false
+			for _, img := range images {
+				if img == image {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return &violation{
+					fmt.Sprintf("image %s not in allowed images", image),
+					"Add the image digest to the rule's images",
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkPath checks a file tool path against the rule's roots.
+func checkPath(path string, roots []string) *violation {
+	under := false
+	for _, root := range roots {
+		if pathUnderRoot(path, root) {
+			under = true
+			break
+		}
+	}
+	if !under {
+		return &violation{
+			fmt.Sprintf("path %s not under allowed roots [%s]", path, strings.Join(roots, ",")),
+			fmt.Sprintf("Use a path under [%s] or add its directory to the rule's roots", strings.Join(roots, ",")),
+		}
+	}
+	if safefs.HasDotDot(path) {
+		return &violation{fmt.Sprintf("path %s contains '..'", path), "Use an absolute path without '..' components"}
+	}
+	return nil
+}
+
+// ContainsString reports whether list contains s.
+func ContainsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
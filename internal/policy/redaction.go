@@ -0,0 +1,60 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// RedactionRule configures one detector of the broker's output filter (see broker.Redactor). A rule
+// without a pattern sets the action of a built-in detector (secrets, pem, jwt, email); a rule with a
+// pattern adds a custom detector. Tools limits the rule to those tools (default all filtered tools).
+//
+//	"redaction": [{"name": "email", "action": "off"},
+//	              {"name": "ticket", "pattern": "TICKET-[0-9]+", "action": "mask", "tools": ["http.fetch"]}]
+type RedactionRule struct {
+	Name    string   `json:"name"`
+	Pattern string   `json:"pattern,omitempty"`
+	Action  string   `json:"action"` // redact, mask, block or off
+	Tools   []string `json:"tools,omitempty"`
+}
+
+// RedactionActions are the actions a redaction rule can take on a finding.
+var RedactionActions = map[string]bool{"redact": true, "mask": true, "block": true, "off": true}
+
+// builtinRedactors are the detectors built into the broker's output filter.
+var builtinRedactors = map[string]bool{"secrets": true, "pem": true, "jwt": true, "email": true}
+
+// validateRedaction checks that every rule is named, has a known action and either names a built-in
+// detector or has a pattern that compiles.
+func validateRedaction(rules []RedactionRule) error {
+	seen := map[string]bool{}
+	for i, r := range rules {
+		switch {
+		case r.Name == "":
+			return fmt.Errorf("redaction[%d]: name required", i)
+		case seen[r.Name]:
+			return fmt.Errorf("redaction[%d]: duplicate name %q", i, r.Name)
+		case !RedactionActions[r.Action]:
+			return fmt.Errorf("redaction[%d]: unknown action %q (use redact, mask, block or off)", i, r.Action)
+		case r.Pattern == "" && !builtinRedactors[r.Name]:
+			return fmt.Errorf("redaction[%d]: %q is not a built-in detector; set a pattern", i, r.Name)
+		case r.Pattern != "" && builtinRedactors[r.Name]:
+			return fmt.Errorf("redaction[%d]: %q is a built-in detector; rename the custom rule", i, r.Name)
+		}
+		if r.Pattern != "" {
+			if _, err := regexp.Compile(r.Pattern); err != nil {
+				return fmt.Errorf("redaction[%d]: %v", i, err)
+			}
+		}
+		seen[r.Name] = true
+	}
+	return nil
+}
+
+// RedactionRules returns the global policy's redaction rules, or nil.
+func (e *Engine) RedactionRules() []RedactionRule {
+	if gp := e.GlobalPolicy(); gp != nil {
+		return gp.Redaction
+	}
+	return nil
+}
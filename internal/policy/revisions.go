@@ -0,0 +1,179 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrRevisionNotFound is returned when a session has no revision with the requested version.
+var ErrRevisionNotFound = errors.New("policy revision not found")
+
+// Revision is one version of a session policy. Every PUT or rollback appends a new revision;
+// revisions are never rewritten.
+type Revision struct {
+	SessionID  string        `json:"session_id"`
+	Version    int           `json:"version"`
+	Author     string        `json:"author"`
+	CreatedAt  time.Time     `json:"created_at"`
+	Policy     SessionPolicy `json:"policy"`
+	Hash       string        `json:"hash"`
+	PrevHash   string        `json:"prev_hash"`
+	Diff       PolicyDiff    `json:"diff"`
+	RollbackOf int           `json:"rollback_of,omitempty"`
+}
+
+// PolicyDiff lists rules added and removed relative to the previous revision.
+type PolicyDiff struct {
+	Added   []RuleOverride `json:"added"`
+	Removed []RuleOverride `json:"removed"`
+}
+
+// RevisionStore is an append-only JSONL log of session policy revisions (e.g. data/policy/revisions.jsonl).
+type RevisionStore struct {
+	mu        sync.Mutex
+	dir       string
+	bySession map[string][]*Revision
+}
+
+// NewRevisionStore creates a revision store under dir and loads existing revisions.
+func NewRevisionStore(dir string) (*RevisionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &RevisionStore{dir: dir, bySession: make(map[string][]*Revision)}
+	f, err := os.Open(s.path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		var rev Revision
+		if err := dec.Decode(&rev); err != nil {
+			break
+		}
+		s.bySession[rev.SessionID] = append(s.bySession[rev.SessionID], &rev)
+	}
+	return s, nil
+}
+
+func (s *RevisionStore) path() string {
+	return filepath.Join(s.dir, "revisions.jsonl")
+}
+
+// Append records sp as the next revision for the session. rollbackOf is the version being restored, or 0.
+func (s *RevisionStore) Append(sessionID, author string, sp *SessionPolicy, rollbackOf int) (*Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var prev *Revision
+	if revs := s.bySession[sessionID]; len(revs) > 0 {
+		prev = revs[len(revs)-1]
+	}
+	rev := &Revision{
+		SessionID:  sessionID,
+		Version:    1,
+		Author:     author,
+		CreatedAt:  time.Now().UTC(),
+		Policy:     *sp,
+		Hash:       PolicyHash(sp),
+		PrevHash:   PolicyHash(nil),
+		RollbackOf: rollbackOf,
+	}
+	var before []RuleOverride
+	if prev != nil {
+		rev.Version = prev.Version + 1
+		rev.PrevHash = prev.Hash
+		before = prev.Policy.Overrides
+	}
+	rev.Diff = diffRules(before, sp.Overrides)
+	f, err := os.OpenFile(s.path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(rev); err != nil {
+		return nil, err
+	}
+	s.bySession[sessionID] = append(s.bySession[sessionID], rev)
+	return rev, nil
+}
+
+// List returns all revisions for a session, oldest first.
+func (s *RevisionStore) List(sessionID string) []*Revision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Revision{}, s.bySession[sessionID]...)
+}
+
+// Get returns one revision of a session's policy.
+func (s *RevisionStore) Get(sessionID string, version int) (*Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rev := range s.bySession[sessionID] {
+		if rev.Version == version {
+			return rev, nil
+		}
+	}
+	return nil, ErrRevisionNotFound
+}
+
+// Latest returns the current revision per session.
+func (s *RevisionStore) Latest() map[string]*Revision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]*Revision, len(s.bySession))
+	for id, revs := range s.bySession {
+		if len(revs) > 0 {
+			out[id] = revs[len(revs)-1]
+		}
+	}
+	return out
+}
+
+// PolicyHash returns the sha256 (hex) of the policy's JSON encoding. A nil policy hashes as empty overrides.
+func PolicyHash(sp *SessionPolicy) string {
+	if sp == nil {
+		sp = &SessionPolicy{}
+	}
+	raw, _ := json.Marshal(sp)
+	h := sha256.Sum256(raw)
+	return hex.EncodeToString(h[:])
+}
+
+// diffRules compares rules by their JSON encoding; duplicates are counted.
+func diffRules(before, after []RuleOverride) PolicyDiff {
+	diff := PolicyDiff{Added: []RuleOverride{}, Removed: []RuleOverride{}}
+	key := func(r RuleOverride) string {
+		raw, _ := json.Marshal(r)
+		return string(raw)
+	}
+	remaining := make(map[string]int)
+	for _, r := range before {
+		remaining[key(r)]++
+	}
+	for _, r := range after {
+		k := key(r)
+		if remaining[k] > 0 {
+			remaining[k]--
+			continue
+		}
+		diff.Added = append(diff.Added, r)
+	}
+	for _, r := range before {
+		k := key(r)
+		if remaining[k] > 0 {
+			remaining[k]--
+			diff.Removed = append(diff.Removed, r)
+		}
+	}
+	return diff
+}
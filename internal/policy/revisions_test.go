@@ -0,0 +1,88 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"securetalon/internal/core"
+)
+
+func TestPolicyRevisionsAndRollback(t *testing.T) {
+	dir := t.TempDir()
+	revs, err := NewRevisionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.Revisions = revs
+
+	readRule := RuleOverride{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []interface{}{"/work"}}}
+	fetchRule := RuleOverride{Tool: "http.fetch", Allow: true, Constraints: map[string]interface{}{"domains": []interface{}{"example.com"}}}
+
+	r1, err := engine.PutSessionPolicy("sess_1", "alice", &SessionPolicy{Overrides: []RuleOverride{readRule}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r1.Version != 1 || len(r1.Diff.Added) != 1 || r1.PrevHash != PolicyHash(nil) {
+		t.Fatalf("unexpected first revision: %+v", r1)
+	}
+	r2, _ := engine.PutSessionPolicy("sess_1", "bob", &SessionPolicy{Overrides: []RuleOverride{fetchRule}})
+	if r2.Version != 2 || r2.PrevHash != r1.Hash || len(r2.Diff.Added) != 1 || len(r2.Diff.Removed) != 1 {
+		t.Fatalf("unexpected second revision: %+v", r2)
+	}
+	intent := core.ToolIntent{Tool: "file.read", Params: map[string]interface{}{"path": "/work/a"}}
+	if engine.Evaluate(intent, "sess_1").Decision != core.DecisionDeny {
+		t.Fatal("expected file.read denied after revision 2")
+	}
+
+	r3, err := engine.RollbackSessionPolicy("sess_1", "alice", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r3.Version != 3 || r3.RollbackOf != 1 || r3.Hash != r1.Hash {
+		t.Fatalf("unexpected rollback revision: %+v", r3)
+	}
+	if engine.Evaluate(intent, "sess_1").Decision != core.DecisionAllow {
+		t.Fatal("expected file.read allowed after rollback")
+	}
+	if _, err := engine.RollbackSessionPolicy("sess_1", "alice", 9); err != ErrRevisionNotFound {
+		t.Fatalf("expected ErrRevisionNotFound, got %v", err)
+	}
+
+	// Reload: history and live policy survive
+	reloaded, err := NewRevisionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(reloaded.List("sess_1")); n != 3 {
+		t.Fatalf("expected 3 revisions after reload, got %d", n)
+	}
+	restored := NewEngine(NewIssuer("test-secret"))
+	restored.Revisions = reloaded
+	restored.RestoreSessionPolicies()
+	if restored.Evaluate(intent, "sess_1").Decision != core.DecisionAllow {
+		t.Fatal("expected restored policy to allow file.read")
+	}
+}
+
+func TestRollbackRevalidatesPolicy(t *testing.T) {
+	revs, err := NewRevisionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.Revisions = revs
+	// Revisions written before the checks they would now fail
+	revs.Append("sess_1", "alice", &SessionPolicy{Overrides: []RuleOverride{{Tool: "file.read", Allow: true, When: "param.path ==="}}}, 0)
+	revs.Append("sess_1", "alice", &SessionPolicy{Packs: []PackRef{{Ref: "gone@1"}}}, 0)
+	for _, version := range []int{1, 2} {
+		_, err := engine.RollbackSessionPolicy("sess_1", "bob", version)
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("rollback to %d: expected a ValidationError, got %v", version, err)
+		}
+	}
+	if n := len(revs.List("sess_1")); n != 2 {
+		t.Fatalf("a rejected rollback must not add a revision, got %d", n)
+	}
+}
@@ -0,0 +1,65 @@
+package policy
+
+import "securetalon/internal/core"
+
+// Change kinds in a simulation, comparing the candidate decision with the current one.
+const (
+	ChangeNone      = ""
+	ChangeLoosened  = "loosened"  // candidate is more permissive (e.g. DENY -> ALLOW)
+	ChangeTightened = "tightened" // candidate is more restrictive
+	ChangeRule      = "rule"      // same decision, decided by a different rule
+)
+
+// SimulatedDecision is a decision made without issuing a token.
+type SimulatedDecision struct {
+	Decision     core.Decision `json:"decision"`
+	Reason       string        `json:"reason"`
+	Rule         string        `json:"rule,omitempty"`
+	SuggestedFix string        `json:"suggested_fix,omitempty"`
+}
+
+// SimulationResult compares one intent under the current and candidate session policy.
+type SimulationResult struct {
+	Intent    core.ToolIntent   `json:"intent"`
+	Current   SimulatedDecision `json:"current"`
+	Candidate SimulatedDecision `json:"candidate"`
+	Changed   bool              `json:"changed"`
+	Change    string            `json:"change,omitempty"`
+}
+
+// Simulate evaluates intents under the session's live policy and under candidate (replacing the
+// session layer; builtin and global layers apply to both). Nothing is executed and no tokens are issued.
+func (e *Engine) Simulate(sessionID string, candidate *SessionPolicy, intents []core.ToolIntent) []SimulationResult {
+	current := e.SessionPolicy(sessionID)
+	results := make([]SimulationResult, 0, len(intents))
+	for _, intent := range intents {
+		cur := simulated(e.evaluate(intent, sessionID, "", current, false, false))
+		cand := simulated(e.evaluate(intent, sessionID, "", candidate, false, false))
+		res := SimulationResult{Intent: intent, Current: cur, Candidate: cand}
+		switch rc, rn := permissiveness(cur.Decision), permissiveness(cand.Decision); {
+		case rn > rc:
+			res.Change = ChangeLoosened
+		case rn < rc:
+			res.Change = ChangeTightened
+		case cur.Rule != cand.Rule:
+			res.Change = ChangeRule
+		}
+		res.Changed = res.Change != ChangeNone
+		results = append(results, res)
+	}
+	return results
+}
+
+func simulated(r core.PolicyResult) SimulatedDecision {
+	return SimulatedDecision{Decision: r.Decision, Reason: r.Reason, Rule: r.Rule, SuggestedFix: r.SuggestedFix}
+}
+
+func permissiveness(d core.Decision) int {
+	switch d {
+	case core.DecisionAllow:
+		return 2
+	case core.DecisionRequireApproval:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,71 @@
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"securetalon/internal/core"
+)
+
+func TestSimulateComparesCurrentAndCandidate(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	engine.SetSessionPolicy("sess_1", &SessionPolicy{
+		Overrides: []RuleOverride{
+			{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work"}}},
+		},
+	})
+	candidate := &SessionPolicy{
+		Overrides: []RuleOverride{
+			{Tool: "file.read", Allow: true, Constraints: map[string]interface{}{"roots": []string{"/work/docs"}}},
+			{Tool: "http.fetch", Allow: true, Constraints: map[string]interface{}{"domains": []string{"api.example.com"}}},
+		},
+	}
+	intents := []core.ToolIntent{
+		{Tool: "file.read", Params: map[string]interface{}{"path": "/work/docs/a.md"}},
+		{Tool: "file.read", Params: map[string]interface{}{"path": "/work/src/main.go"}},
+		{Tool: "http.fetch", Params: map[string]interface{}{"url": "https://api.example.com/x"}},
+		{Tool: "shell.exec", Params: map[string]interface{}{"cmd": "ls"}},
+	}
+	results := engine.Simulate("sess_1", candidate, intents)
+	want := []string{ChangeNone, ChangeTightened, ChangeLoosened, ChangeNone}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %d", len(want), len(results))
+	}
+	for i, res := range results {
+		if res.Change != want[i] || res.Changed != (want[i] != ChangeNone) {
+			t.Fatalf("intent %d: expected change %q, got %q (%s -> %s)", i, want[i], res.Change, res.Current.Decision, res.Candidate.Decision)
+		}
+	}
+	if results[0].Current.Rule != "session#1" || results[0].Candidate.Rule != "session#1" {
+		t.Fatalf("expected both decided by session#1, got %s / %s", results[0].Current.Rule, results[0].Candidate.Rule)
+	}
+	// The live policy is untouched
+	if r := engine.Evaluate(intents[2], "sess_1"); r.Decision != core.DecisionDeny {
+		t.Fatalf("simulation must not change the live policy, got %s", r.Decision)
+	}
+}
+
+func TestSimulateSummarizedContent(t *testing.T) {
+	engine := NewEngine(NewIssuer("test-secret"))
+	write := func(content string) core.ToolIntent {
+		params := map[string]interface{}{"path": "/work/a.txt", "content": content}
+		// As recorded in the audit log and decoded again by the simulator
+		raw, _ := json.Marshal(SummarizeParams(params))
+		var recorded map[string]interface{}
+		json.Unmarshal(raw, &recorded)
+		return core.ToolIntent{Tool: "file.write", Params: recorded}
+	}
+	summary, _ := write("hello").Params["content"].(map[string]interface{})
+	if summary["bytes"] != float64(5) || summary["sha256"] != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("unexpected content summary %v", summary)
+	}
+	candidate := &SessionPolicy{Overrides: []RuleOverride{{Tool: "file.write", Allow: true, Constraints: map[string]interface{}{
+		"roots": []string{"/work"}, "max_bytes": float64(8), "content_types": []string{"text/plain"},
+	}}}}
+	results := engine.Simulate("sess_1", candidate, []core.ToolIntent{write("hello"), write("too long for it"), write("\x89PNG\r\n\x1a\n")})
+	for i, want := range []core.Decision{core.DecisionAllow, core.DecisionDeny, core.DecisionDeny} {
+		if results[i].Candidate.Decision != want {
+			t.Fatalf("intent %d: expected %s, got %s (%s)", i, want, results[i].Candidate.Decision, results[i].Candidate.Reason)
+		}
+	}
+}
@@ -1,33 +1,59 @@
 // Package policy provides capability token signing and verification.
-// HMAC-SHA256 using server secret for MVP.
+// Tokens are signed with the Ed25519 key of a Keyring and carry its kid; verifiers hold only public keys,
+// so a component that can verify tokens cannot mint them. HMAC-SHA256 with a shared secret remains
+// for tests and embedded use.
 package policy
 
 import (
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"securetalon/internal/core"
+	"securetalon/internal/jcs"
 	"time"
 )
 
-// Issuer signs capability tokens.
+// Issuer signs capability tokens with the active key of Keys, or with Secret (HMAC) when Keys is nil.
 type Issuer struct {
 	Secret []byte
+	Keys   *Keyring
 }
 
-// NewIssuer creates an issuer with the given secret (e.g. from config).
+// NewIssuer creates an HMAC issuer with the given shared secret.
 func NewIssuer(secret string) *Issuer {
-	if secret == "" {
-		secret = "default-secret-change-in-production"
-	}
 	return &Issuer{Secret: []byte(secret)}
 }
 
-// Issue creates a signed capability token for the given session, subject, tool, and constraints.
+// NewKeyringIssuer creates an issuer that signs with the keyring's active Ed25519 key.
+func NewKeyringIssuer(keys *Keyring) *Issuer {
+	return &Issuer{Keys: keys}
+}
+
+// Grant is what a capability token authorizes.
+type Grant struct {
+	SessionID    string
+	Subject      string
+	Tool         string
+	Constraints  map[string]interface{}
+	TTLSeconds   int64  // default 60
+	MaxUses      int    // executions allowed within the TTL; 0 or 1 means single-use
+	IntentDigest string // binds the token to the exact intent params (see IntentDigest); empty leaves them unbound
+	Delegable    bool   // the holder may attenuate the token for sub-agents (see Delegate)
+}
+
+// Issue creates a signed single-use capability token for the given session, subject, tool, and constraints.
 func (i *Issuer) Issue(sessionID, subject, tool string, constraints map[string]interface{}, ttlSeconds int64) (*core.CapabilityToken, error) {
+	return i.IssueGrant(Grant{SessionID: sessionID, Subject: subject, Tool: tool, Constraints: constraints, TTLSeconds: ttlSeconds})
+}
+
+// IssueGrant creates a signed capability token for g.
+func (i *Issuer) IssueGrant(g Grant) (*core.CapabilityToken, error) {
 	now := time.Now().UTC().Unix()
+	ttlSeconds := g.TTLSeconds
 	if ttlSeconds <= 0 {
 		ttlSeconds = 60
 	}
@@ -35,48 +61,106 @@ func (i *Issuer) Issue(sessionID, subject, tool string, constraints map[string]i
 	capID := core.NewCapID()
 	nonce := fmt.Sprintf("%d-%s", now, capID)
 	tok := &core.CapabilityToken{
-		CapID:       capID,
-		SessionID:   sessionID,
-		Subject:     subject,
-		Tool:        tool,
-		Constraints: constraints,
-		Iat:         now,
-		Exp:         exp,
-		Nonce:       nonce,
-	}
-	sig, err := signToken(tok, i.Secret)
-	if err != nil {
+		CapID:        capID,
+		SessionID:    g.SessionID,
+		Subject:      g.Subject,
+		Tool:         g.Tool,
+		Constraints:  g.Constraints,
+		Iat:          now,
+		Exp:          exp,
+		Nonce:        nonce,
+		IntentDigest: g.IntentDigest,
+	}
+	if g.MaxUses > 1 {
+		tok.MaxUses = g.MaxUses
+	}
+	if g.Delegable {
+		pub, seed, err := newDelegationKey()
+		if err != nil {
+			return nil, err
+		}
+		tok.DelegationKey, tok.Proof = pub, seed
+	}
+	if err := i.sign(tok); err != nil {
 		return nil, err
 	}
-	tok.Signature = sig
 	return tok, nil
 }
 
-// Verifier checks token signature and expiry.
+// sign sets the token's kid (for keyring signing) and signature.
+func (i *Issuer) sign(tok *core.CapabilityToken) error {
+	if i.Keys == nil {
+		if len(i.Secret) == 0 {
+			return errors.New("no signing key configured")
+		}
+		sig, err := signToken(tok, i.Secret)
+		if err != nil {
+			return err
+		}
+		tok.Signature = sig
+		return nil
+	}
+	key := i.Keys.Active()
+	if key == nil {
+		return errors.New("no signing key configured")
+	}
+	tok.Kid = key.Kid
+	payload, err := tokenPayload(tok)
+	if err != nil {
+		return err
+	}
+	tok.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key.PrivateKey, payload))
+	return nil
+}
+
+// Verifier checks token signature and expiry. Tokens with a kid are checked against the public keys
+// of Keys (active or retired), so tokens issued before a rotation stay valid until they expire.
+// Tokens without a kid are checked against Secret (HMAC) and rejected when no secret is set.
+// Leeway tolerates clock skew between issuer and verifier on iat and exp.
 type Verifier struct {
 	Secret []byte
+	Keys   PublicKeySource
+	Now    func() time.Time // clock for expiry checks; nil means time.Now
+	Leeway time.Duration
 }
 
-// NewVerifier creates a verifier with the same secret as the issuer.
+// NewVerifier creates an HMAC verifier with the same secret as the issuer.
 func NewVerifier(secret string) *Verifier {
-	if secret == "" {
-		secret = "default-secret-change-in-production"
-	}
 	return &Verifier{Secret: []byte(secret)}
 }
 
-// Verify returns nil if the token is valid and not expired.
+// NewKeyringVerifier creates a verifier for Ed25519 tokens. Pass the Keyring as a PublicKeySource
+// so the verifier can only read public keys.
+func NewKeyringVerifier(keys PublicKeySource) *Verifier {
+	return &Verifier{Keys: keys}
+}
+
+// Verify returns nil if the token is valid and not expired, including every caveat of a delegated token.
 func (v *Verifier) Verify(tok *core.CapabilityToken) error {
 	if tok == nil {
 		return fmt.Errorf("nil token")
 	}
-	now := time.Now().UTC().Unix()
-	if tok.Exp < now {
+	clock := v.Now
+	if clock == nil {
+		clock = time.Now
+	}
+	now := clock().UTC().Unix()
+	leeway := int64(v.Leeway / time.Second)
+	if tok.Exp < now-leeway {
 		return fmt.Errorf("token expired")
 	}
-	if tok.Iat > now {
+	if tok.Iat > now+leeway {
 		return fmt.Errorf("token not yet valid")
 	}
+	if tok.Kid != "" {
+		if err := v.verifyKey(tok); err != nil {
+			return err
+		}
+		return verifyChain(tok, now-leeway)
+	}
+	if len(v.Secret) == 0 {
+		return fmt.Errorf("token has no kid")
+	}
 	expectedSig, err := signToken(tok, v.Secret)
 	if err != nil {
 		return err
@@ -84,24 +168,34 @@ func (v *Verifier) Verify(tok *core.CapabilityToken) error {
 	if !hmac.Equal([]byte(tok.Signature), []byte(expectedSig)) {
 		return fmt.Errorf("invalid signature")
 	}
+	return verifyChain(tok, now-leeway)
+}
+
+func (v *Verifier) verifyKey(tok *core.CapabilityToken) error {
+	if v.Keys == nil {
+		return fmt.Errorf("%w %q", ErrUnknownKey, tok.Kid)
+	}
+	pub, ok := v.Keys.PublicKey(tok.Kid)
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKey, tok.Kid)
+	}
+	sig, err := base64.StdEncoding.DecodeString(tok.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature")
+	}
+	payload, err := tokenPayload(tok)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, payload, sig) {
+		return fmt.Errorf("invalid signature")
+	}
 	return nil
 }
 
 // signToken computes HMAC-SHA256 of canonical token payload (without signature).
 func signToken(tok *core.CapabilityToken, secret []byte) (string, error) {
-	payload := struct {
-		CapID       string                 `json:"cap_id"`
-		SessionID   string                 `json:"session_id"`
-		Subject     string                 `json:"subject"`
-		Tool        string                 `json:"tool"`
-		Constraints map[string]interface{} `json:"constraints"`
-		Iat         int64                  `json:"iat"`
-		Exp         int64                  `json:"exp"`
-		Nonce       string                 `json:"nonce"`
-	}{
-		tok.CapID, tok.SessionID, tok.Subject, tok.Tool, tok.Constraints, tok.Iat, tok.Exp, tok.Nonce,
-	}
-	canon, err := json.Marshal(payload)
+	canon, err := tokenPayload(tok)
 	if err != nil {
 		return "", err
 	}
@@ -109,3 +203,40 @@ func signToken(tok *core.CapabilityToken, secret []byte) (string, error) {
 	h.Write(canon)
 	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
 }
+
+// tokenPayload is the signed payload: every field except the signature, caveats and proof, canonicalized with JCS (RFC 8785)
+// so verifiers in other languages can reproduce it.
+func tokenPayload(tok *core.CapabilityToken) ([]byte, error) {
+	payload := struct {
+		CapID         string                 `json:"cap_id"`
+		SessionID     string                 `json:"session_id"`
+		Subject       string                 `json:"subject"`
+		Tool          string                 `json:"tool"`
+		Constraints   map[string]interface{} `json:"constraints"`
+		Iat           int64                  `json:"iat"`
+		Exp           int64                  `json:"exp"`
+		Nonce         string                 `json:"nonce"`
+		Kid           string                 `json:"kid,omitempty"`
+		MaxUses       int                    `json:"max_uses,omitempty"`
+		IntentDigest  string                 `json:"intent_digest,omitempty"`
+		DelegationKey string                 `json:"delegation_key,omitempty"`
+	}{
+		tok.CapID, tok.SessionID, tok.Subject, tok.Tool, tok.Constraints, tok.Iat, tok.Exp, tok.Nonce, tok.Kid, tok.MaxUses, tok.IntentDigest,
+		tok.DelegationKey,
+	}
+	return jcs.Marshal(payload)
+}
+
+// IntentDigest is the canonical hash of intent params, "sha256:<hex>" over their JCS (RFC 8785)
+// encoding. Nil and empty params hash alike.
+func IntentDigest(params map[string]interface{}) (string, error) {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	canon, err := jcs.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canon)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
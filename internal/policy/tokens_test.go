@@ -1,8 +1,17 @@
 package policy
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"securetalon/internal/core"
 )
 
 func TestIssueAndVerify(t *testing.T) {
@@ -44,3 +53,122 @@ func TestVerifyRejectsExpired(t *testing.T) {
 		t.Fatal("expected verify to fail for expired token")
 	}
 }
+
+func TestIntentDigestCanonical(t *testing.T) {
+	a, _ := IntentDigest(map[string]interface{}{"path": "/work/a", "max": 1, "opts": map[string]interface{}{"y": true, "x": "1"}})
+	b, _ := IntentDigest(map[string]interface{}{"opts": map[string]interface{}{"x": "1", "y": true}, "max": float64(1), "path": "/work/a"})
+	if a != b {
+		t.Fatalf("digest depends on key order or number type: %s != %s", a, b)
+	}
+	c, _ := IntentDigest(map[string]interface{}{"path": "/work/b", "max": 1, "opts": map[string]interface{}{"y": true, "x": "1"}})
+	if a == c {
+		t.Fatal("different params produced the same digest")
+	}
+	empty, _ := IntentDigest(map[string]interface{}{})
+	if none, _ := IntentDigest(nil); none != empty {
+		t.Fatal("nil and empty params should hash alike")
+	}
+}
+
+func TestVerifyRejectsTamperedIntentDigest(t *testing.T) {
+	issuer := NewIssuer("secret")
+	digest, _ := IntentDigest(map[string]interface{}{"path": "/work/a"})
+	tok, _ := issuer.IssueGrant(Grant{SessionID: "sess_1", Subject: "agent", Tool: "file.read", IntentDigest: digest})
+	other, _ := IntentDigest(map[string]interface{}{"path": "/work/b"})
+	tok.IntentDigest = other
+	if NewVerifier("secret").Verify(tok) == nil {
+		t.Fatal("expected verify to fail for a rebound intent digest")
+	}
+}
+
+// staticKeys is a PublicKeySource with fixed keys.
+type staticKeys map[string]ed25519.PublicKey
+
+func (k staticKeys) PublicKey(kid string) (ed25519.PublicKey, bool) {
+	pub, ok := k[kid]
+	return pub, ok
+}
+
+// TestTokenGoldenVectors checks testdata/token_vectors.json, which the Python and TypeScript
+// verifiers also use: JCS payloads, Ed25519 and HMAC signatures, and intent digests.
+func TestTokenGoldenVectors(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("testdata", "token_vectors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors struct {
+		Seed          string `json:"ed25519_seed_hex"`
+		PublicKey     []byte `json:"ed25519_public_key"`
+		HMACSecret    string `json:"hmac_secret"`
+		IntentDigests []struct {
+			Params map[string]interface{} `json:"params"`
+			Digest string                 `json:"digest"`
+		} `json:"intent_digests"`
+		Tokens []struct {
+			Name    string               `json:"name"`
+			Token   core.CapabilityToken `json:"token"`
+			Payload string               `json:"payload"`
+			Ed25519 string               `json:"ed25519_signature"`
+			HMAC    string               `json:"hmac_sha256_signature"`
+		} `json:"tokens"`
+	}
+	if err := json.Unmarshal(raw, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	seed, _ := hex.DecodeString(vectors.Seed)
+	priv := ed25519.NewKeyFromSeed(seed)
+	if !bytes.Equal(priv.Public().(ed25519.PublicKey), vectors.PublicKey) {
+		t.Fatal("public key does not match seed")
+	}
+	for _, d := range vectors.IntentDigests {
+		if got, _ := IntentDigest(d.Params); got != d.Digest {
+			t.Errorf("intent digest = %s, want %s", got, d.Digest)
+		}
+	}
+	verifier := NewKeyringVerifier(staticKeys{"k_test": vectors.PublicKey})
+	verifier.Now = func() time.Time { return time.Unix(1700000030, 0) }
+	for _, v := range vectors.Tokens {
+		tok := v.Token
+		payload, err := tokenPayload(&tok)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(payload) != v.Payload {
+			t.Errorf("%s: payload\n got  %s\n want %s", v.Name, payload, v.Payload)
+		}
+		if sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, payload)); sig != v.Ed25519 {
+			t.Errorf("%s: ed25519 signature = %s, want %s", v.Name, sig, v.Ed25519)
+		}
+		if sig, _ := signToken(&tok, []byte(vectors.HMACSecret)); sig != v.HMAC {
+			t.Errorf("%s: hmac signature = %s, want %s", v.Name, sig, v.HMAC)
+		}
+		if err := verifier.Verify(&tok); err != nil {
+			t.Errorf("%s: verify: %v", v.Name, err)
+		}
+	}
+}
+
+func TestVerifyLeewayToleratesClockSkew(t *testing.T) {
+	issuer := NewIssuer("secret")
+	tok, _ := issuer.Issue("sess_1", "agent", "file.read", nil, 60)
+
+	// The verifier's clock runs 3s behind the issuer's, so iat is in its future.
+	behind := &Verifier{Secret: []byte("secret"), Now: func() time.Time { return time.Now().Add(-3 * time.Second) }}
+	if behind.Verify(tok) == nil {
+		t.Fatal("expected a token from the future to be rejected without leeway")
+	}
+	behind.Leeway = 5 * time.Second
+	if err := behind.Verify(tok); err != nil {
+		t.Fatalf("verify with leeway: %v", err)
+	}
+
+	// Leeway also extends expiry by at most the tolerance.
+	ahead := &Verifier{Secret: []byte("secret"), Leeway: 5 * time.Second, Now: func() time.Time { return time.Now().Add(63 * time.Second) }}
+	if err := ahead.Verify(tok); err != nil {
+		t.Fatalf("verify just after expiry with leeway: %v", err)
+	}
+	ahead.Now = func() time.Time { return time.Now().Add(70 * time.Second) }
+	if ahead.Verify(tok) == nil {
+		t.Fatal("expected a token expired beyond the leeway to be rejected")
+	}
+}
@@ -0,0 +1,90 @@
+package policy
+
+import (
+	"strings"
+
+	"securetalon/internal/core"
+)
+
+// WorkspaceResolver resolves relative file paths inside a session's workspace directory
+// (workspace.Manager implements it). Absolute paths are returned unchanged.
+type WorkspaceResolver interface {
+	Resolve(sessionID, path string) string
+}
+
+// pathParams are the intent params that name files, per tool.
+var pathParams = map[string][]string{
+	"file.read":   {"path"},
+	"file.write":  {"path"},
+	"file.list":   {"path"},
+	"file.stat":   {"path"},
+	"file.delete": {"path"},
+	"file.move":   {"path", "dest"},
+}
+
+// ResolveIntent returns intent with relative file paths resolved inside the session's workspace.
+// The params map is copied, never modified. Without Workspaces the intent is returned as is.
+func (e *Engine) ResolveIntent(intent core.ToolIntent, sessionID string) core.ToolIntent {
+	if e.Workspaces == nil {
+		return intent
+	}
+	var params map[string]interface{}
+	for _, key := range pathParams[intent.Tool] {
+		p, ok := intent.Params[key].(string)
+		if !ok {
+			continue
+		}
+		resolved := e.Workspaces.Resolve(sessionID, p)
+		if resolved == p {
+			continue
+		}
+		if params == nil {
+			params = copyConstraints(intent.Params)
+		}
+		params[key] = resolved
+	}
+	if params != nil {
+		intent.Params = params
+	}
+	return intent
+}
+
+// resolveRoots returns constraints with relative roots resolved inside the session's workspace, so
+// issued tokens only carry absolute roots. "workspace" and "." name the workspace itself and
+// "workspace/<dir>" a directory in it, the same one a relative path "<dir>/..." in an intent or a
+// workspace upload names. constraints is copied when a root changes.
+func (e *Engine) resolveRoots(constraints map[string]interface{}, sessionID string) map[string]interface{} {
+	if e.Workspaces == nil {
+		return constraints
+	}
+	roots, ok := stringList(constraints["roots"])
+	if !ok {
+		return constraints
+	}
+	roots = append([]string(nil), roots...)
+	changed := false
+	for i, r := range roots {
+		if resolved := e.Workspaces.Resolve(sessionID, workspaceRoot(r)); resolved != r {
+			roots[i] = resolved
+			changed = true
+		}
+	}
+	if !changed {
+		return constraints
+	}
+	out := copyConstraints(constraints)
+	out["roots"] = toInterfaceList(roots)
+	return out
+}
+
+// workspaceRoot maps a root that names the workspace, "workspace" or ".", to "." and
+// "workspace/<dir>" to "<dir>", relative to the session's workspace. Other roots are returned as is.
+func workspaceRoot(r string) string {
+	switch {
+	case r == "workspace" || r == "workspace/" || r == ".":
+		return "."
+	case strings.HasPrefix(r, "workspace/"):
+		return strings.TrimPrefix(r, "workspace/")
+	}
+	return r
+}
@@ -0,0 +1,221 @@
+//go:build linux
+
+package safefs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// atRemoveDir is AT_REMOVEDIR, which package syscall does not export for Linux.
+const atRemoveDir = 0x200
+
+// openInRoot opens root/rel without following symlinks. root is opened normally (roots are trusted
+// policy), then every component of rel is opened relative to its parent directory with openat and
+// O_NOFOLLOW, so no symlink below root is ever traversed.
+func openInRoot(root, rel string, flag int, perm os.FileMode) (*os.File, error) {
+	dirfd, cur, name, err := parentInRoot(root, rel, flag&os.O_CREATE != 0)
+	if err != nil {
+		return nil, err
+	}
+	cur = filepath.Join(cur, name)
+	// O_NONBLOCK keeps a FIFO planted under the root from blocking the open; it is rejected as
+	// not a regular file afterwards.
+	fd, err := syscall.Openat(dirfd, name, flag|syscall.O_NOFOLLOW|syscall.O_NONBLOCK|syscall.O_CLOEXEC, uint32(perm.Perm()))
+	syscall.Close(dirfd)
+	if err != nil {
+		return nil, walkError(cur, err)
+	}
+	if err := syscall.SetNonblock(fd, false); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), cur), nil
+}
+
+// openDirInRoot opens the directory root/rel ("." for root itself) without following symlinks.
+func openDirInRoot(root, rel string) (*os.File, error) {
+	if rel == "." {
+		return os.Open(root)
+	}
+	dirfd, cur, name, err := parentInRoot(root, rel, false)
+	if err != nil {
+		return nil, err
+	}
+	cur = filepath.Join(cur, name)
+	fd, err := openDirAt(dirfd, name)
+	syscall.Close(dirfd)
+	if err != nil {
+		return nil, walkError(cur, err)
+	}
+	return os.NewFile(uintptr(fd), cur), nil
+}
+
+// lstatInRoot returns the FileInfo of root/rel without following a symlink in any component. The
+// entry itself is opened O_NOFOLLOW and fstat'ed; a symlink or socket, which cannot be opened that
+// way, is described by Lstat once its parent directory has been walked.
+func lstatInRoot(root, rel string) (os.FileInfo, error) {
+	dirfd, cur, name, err := parentInRoot(root, rel, false)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(dirfd)
+	cur = filepath.Join(cur, name)
+	fd, err := syscall.Openat(dirfd, name, syscall.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err == syscall.ELOOP || err == syscall.ENXIO {
+		return os.Lstat(cur)
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: cur, Err: err}
+	}
+	f := os.NewFile(uintptr(fd), cur)
+	defer f.Close()
+	return f.Stat()
+}
+
+// removeInRoot removes the file, symlink or empty directory root/rel with unlinkat relative to its
+// walked parent directory. A symlink is removed itself, never its target.
+func removeInRoot(root, rel string) error {
+	dirfd, cur, name, err := parentInRoot(root, rel, false)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(dirfd)
+	cur = filepath.Join(cur, name)
+	err = syscall.Unlinkat(dirfd, name)
+	if err == syscall.EISDIR {
+		err = unlinkDirAt(dirfd, name)
+	}
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: cur, Err: err}
+	}
+	return nil
+}
+
+// renameInRoot renames srcRoot/srcRel to dstRoot/dstRel with renameat between the two walked parent
+// directories, creating missing destination directories.
+func renameInRoot(srcRoot, srcRel, dstRoot, dstRel string) error {
+	srcfd, src, srcName, err := parentInRoot(srcRoot, srcRel, false)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(srcfd)
+	dstfd, dst, dstName, err := parentInRoot(dstRoot, dstRel, true)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(dstfd)
+	if err := syscall.Renameat(srcfd, srcName, dstfd, dstName); err != nil {
+		return &os.LinkError{Op: "rename", Old: filepath.Join(src, srcName), New: filepath.Join(dst, dstName), Err: err}
+	}
+	return nil
+}
+
+// writeInRoot writes data to a temporary file in the walked parent directory of root/rel and renames
+// it over the last component with renameat. An existing symlink there is refused, not replaced.
+func writeInRoot(root, rel string, data []byte) error {
+	dirfd, dir, name, err := parentInRoot(root, rel, true)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(dirfd)
+	path := filepath.Join(dir, name)
+	perm := uint32(0600)
+	fd, err := syscall.Openat(dirfd, name, syscall.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	switch {
+	case err == nil:
+		var st syscall.Stat_t
+		err = syscall.Fstat(fd, &st)
+		syscall.Close(fd)
+		if err != nil {
+			return &os.PathError{Op: "stat", Path: path, Err: err}
+		}
+		if st.Mode&syscall.S_IFMT != syscall.S_IFREG {
+			return fmt.Errorf("path %s is not a regular file", path)
+		}
+		perm = uint32(st.Mode) & 0777
+	case err != syscall.ENOENT:
+		return walkError(path, err)
+	}
+	tmp := tempName(name)
+	fd, err = syscall.Openat(dirfd, tmp, syscall.O_WRONLY|syscall.O_CREAT|syscall.O_EXCL|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, perm)
+	if err != nil {
+		return &os.PathError{Op: "create", Path: filepath.Join(dir, tmp), Err: err}
+	}
+	f := os.NewFile(uintptr(fd), filepath.Join(dir, tmp))
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if err = syscall.Renameat(dirfd, tmp, dirfd, name); err != nil {
+			err = &os.LinkError{Op: "rename", Old: filepath.Join(dir, tmp), New: path, Err: err}
+		}
+	}
+	if err != nil {
+		syscall.Unlinkat(dirfd, tmp)
+		return err
+	}
+	// Sync the directory so the rename survives a crash.
+	syscall.Fsync(dirfd)
+	return nil
+}
+
+// parentInRoot opens the parent directory of root/rel by walking from root one component at a time
+// with O_NOFOLLOW, creating missing directories when create is set. It returns the directory's fd
+// (the caller closes it), its path and the last component of rel.
+func parentInRoot(root, rel string, create bool) (dirfd int, dir, name string, err error) {
+	dirfd, err = syscall.Open(root, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, "", "", &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	parts := splitRel(rel)
+	dir = root
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		fd, err := openDirAt(dirfd, part)
+		if err == syscall.ENOENT && create {
+			if err = syscall.Mkdirat(dirfd, part, 0700); err == nil || err == syscall.EEXIST {
+				fd, err = openDirAt(dirfd, part)
+			}
+		}
+		syscall.Close(dirfd)
+		if err != nil {
+			return -1, "", "", walkError(dir, err)
+		}
+		dirfd = fd
+	}
+	return dirfd, dir, parts[len(parts)-1], nil
+}
+
+func openDirAt(dirfd int, name string) (int, error) {
+	return syscall.Openat(dirfd, name, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0)
+}
+
+func unlinkDirAt(dirfd int, name string) error {
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_UNLINKAT, uintptr(dirfd), uintptr(unsafe.Pointer(p)), atRemoveDir)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// walkError reports a symlink refused by O_NOFOLLOW as ErrSymlink.
+func walkError(path string, err error) error {
+	if err == syscall.ELOOP || err == syscall.ENOTDIR {
+		if fi, lerr := os.Lstat(path); lerr == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s", ErrSymlink, path)
+		}
+	}
+	return &os.PathError{Op: "open", Path: path, Err: err}
+}
@@ -0,0 +1,144 @@
+//go:build !linux
+
+package safefs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The functions below check with Lstat that no component below root is a symlink before operating on
+// the path. Unlike the openat walk on Linux this is subject to a race if the tree is modified
+// concurrently.
+
+// openInRoot opens root/rel after checking that no component below root is a symlink.
+func openInRoot(root, rel string, flag int, perm os.FileMode) (*os.File, error) {
+	cur, err := parentInRoot(root, rel, flag&os.O_CREATE != 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := notSymlink(cur); err != nil && !(os.IsNotExist(err) && flag&os.O_CREATE != 0) {
+		return nil, err
+	}
+	return os.OpenFile(cur, flag, perm)
+}
+
+// openDirInRoot opens the directory root/rel ("." for root itself).
+func openDirInRoot(root, rel string) (*os.File, error) {
+	if rel == "." {
+		return os.Open(root)
+	}
+	cur, err := parentInRoot(root, rel, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := notSymlink(cur); err != nil {
+		return nil, err
+	}
+	return os.Open(cur)
+}
+
+// lstatInRoot returns the FileInfo of root/rel without following a symlink in any component.
+func lstatInRoot(root, rel string) (os.FileInfo, error) {
+	cur, err := parentInRoot(root, rel, false)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(cur)
+}
+
+// removeInRoot removes the file, symlink or empty directory root/rel. A symlink is removed itself,
+// never its target.
+func removeInRoot(root, rel string) error {
+	cur, err := parentInRoot(root, rel, false)
+	if err != nil {
+		return err
+	}
+	return os.Remove(cur)
+}
+
+// renameInRoot renames srcRoot/srcRel to dstRoot/dstRel, creating missing destination directories.
+func renameInRoot(srcRoot, srcRel, dstRoot, dstRel string) error {
+	src, err := parentInRoot(srcRoot, srcRel, false)
+	if err != nil {
+		return err
+	}
+	dst, err := parentInRoot(dstRoot, dstRel, true)
+	if err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+// writeInRoot writes data to a temporary file next to root/rel and renames it over root/rel. An
+// existing symlink there is refused, not replaced.
+func writeInRoot(root, rel string, data []byte) error {
+	path, err := parentInRoot(root, rel, true)
+	if err != nil {
+		return err
+	}
+	perm := os.FileMode(0600)
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s", ErrSymlink, path)
+		}
+		if !fi.Mode().IsRegular() {
+			return fmt.Errorf("path %s is not a regular file", path)
+		}
+		perm = fi.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), tempName(filepath.Base(path)))
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// parentInRoot checks that no directory between root and the last component of rel is a symlink,
+// creating missing directories when create is set, and returns root/rel.
+func parentInRoot(root, rel string, create bool) (string, error) {
+	parts := splitRel(rel)
+	cur := root
+	for _, name := range parts[:len(parts)-1] {
+		cur = filepath.Join(cur, name)
+		err := notSymlink(cur)
+		if os.IsNotExist(err) && create {
+			if err := os.Mkdir(cur, 0700); err != nil && !os.IsExist(err) {
+				return "", err
+			}
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(cur, parts[len(parts)-1]), nil
+}
+
+func notSymlink(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%w: %s", ErrSymlink, path)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+// Package safefs opens files under allowed root directories, enforcing the roots against the real
+// filesystem rather than the path's spelling. A path with a ".." component is rejected outright, and
+// the file is opened by walking from the root one component at a time without following symlinks
+// (openat with O_NOFOLLOW on Linux), so a symlink inside a root, or one swapped in while the path is
+// opened, cannot lead outside it. Listing, stat, removal and rename walk the same way. The broker's
+// file tools and session workspaces use it.
+package safefs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrSymlink is returned when a path crosses a symlink and following symlinks is not allowed, or when
+// a followed symlink resolves outside the allowed roots.
+var ErrSymlink = errors.New("symlink not allowed")
+
+// HasDotDot reports whether path has a ".." component.
+func HasDotDot(path string) bool {
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// Under reports whether the cleaned path equals the cleaned root or lies beneath it.
+func Under(path, root string) bool {
+	if root == "" || path == "" {
+		return false
+	}
+	path, root = filepath.Clean(path), filepath.Clean(root)
+	if !strings.HasPrefix(path, root) {
+		return false
+	}
+	if len(path) == len(root) || strings.HasSuffix(root, string(filepath.Separator)) {
+		return true
+	}
+	return path[len(root)] == '/' || path[len(root)] == '\\'
+}
+
+// Resolve returns the root path lies under (the deepest, if several) and path relative to it. A path
+// with a ".." component is rejected outright. With follow, symlinks are resolved first and the
+// resolved path must still lie under the resolved root.
+func Resolve(path string, roots []string, follow bool) (root, rel string, err error) {
+	if HasDotDot(path) {
+		return "", "", fmt.Errorf("path %s contains '..'", path)
+	}
+	clean := filepath.Clean(path)
+	for _, r := range roots {
+		if Under(clean, r) && len(filepath.Clean(r)) > len(root) {
+			root = filepath.Clean(r)
+		}
+	}
+	if root == "" {
+		return "", "", fmt.Errorf("path %s not under allowed roots", path)
+	}
+	if follow {
+		real, err := evalExisting(clean)
+		if err != nil {
+			return "", "", err
+		}
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return "", "", err
+		}
+		if !Under(real, realRoot) {
+			return "", "", fmt.Errorf("%w: %s resolves outside allowed roots", ErrSymlink, path)
+		}
+		root, clean = realRoot, real
+	}
+	rel, err = filepath.Rel(root, clean)
+	if err != nil {
+		return "", "", err
+	}
+	return root, rel, nil
+}
+
+// evalExisting resolves symlinks in the longest existing prefix of path and appends the rest, so a
+// file (or directories) about to be created can be resolved.
+func evalExisting(path string) (string, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return real, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	dir, base := filepath.Split(path)
+	dir = filepath.Clean(dir)
+	if dir == path {
+		return "", err
+	}
+	parent, err := evalExisting(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, base), nil
+}
+
+// Open opens path, which must lie under one of roots. With os.O_CREATE in flag, the root and missing
+// parent directories are created (mode 0700). Only regular files can be opened.
+func Open(path string, roots []string, follow bool, flag int, perm os.FileMode) (*os.File, error) {
+	root, rel, err := Resolve(path, roots, follow)
+	if err != nil {
+		return nil, err
+	}
+	if rel == "." {
+		return nil, fmt.Errorf("path %s is a directory", path)
+	}
+	if flag&os.O_CREATE != 0 {
+		if err := os.MkdirAll(root, 0700); err != nil {
+			return nil, err
+		}
+	}
+	f, err := openInRoot(root, rel, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		f.Close()
+		return nil, fmt.Errorf("path %s is not a regular file", path)
+	}
+	return f, nil
+}
+
+// WriteFile atomically replaces path, which must lie under one of roots, with data: the data is
+// written and synced to a temporary file in the same directory, which is then renamed over path. A
+// reader sees the old or the new content, never a torn file. Missing directories are created; an
+// existing file keeps its permissions (new files get 0600).
+func WriteFile(path string, roots []string, follow bool, data []byte) error {
+	root, rel, err := Resolve(path, roots, follow)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return fmt.Errorf("path %s is a directory", path)
+	}
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return err
+	}
+	return writeInRoot(root, rel, data)
+}
+
+// tempName returns a name for a temporary file next to name.
+func tempName(name string) string {
+	var b [8]byte
+	rand.Read(b[:])
+	return "." + name + ".tmp-" + hex.EncodeToString(b[:])
+}
+
+// OpenDir opens the directory path, which must be one of roots or lie under one.
+func OpenDir(path string, roots []string, follow bool) (*os.File, error) {
+	root, rel, err := Resolve(path, roots, follow)
+	if err != nil {
+		return nil, err
+	}
+	f, err := openDirInRoot(root, rel)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !fi.IsDir() {
+		f.Close()
+		return nil, fmt.Errorf("path %s is not a directory", path)
+	}
+	return f, nil
+}
+
+// Lstat describes path, which must be one of roots or lie under one. A symlink as the last component
+// is described itself, even with follow (which only applies to the directories leading to it).
+func Lstat(path string, roots []string, follow bool) (os.FileInfo, error) {
+	root, rel, err := resolveEntry(path, roots, follow)
+	if err != nil {
+		return nil, err
+	}
+	if rel == "." {
+		return os.Stat(root)
+	}
+	return lstatInRoot(root, rel)
+}
+
+// Remove deletes the file, symlink or empty directory path under one of roots. A root itself cannot
+// be removed, and a symlink is removed rather than its target.
+func Remove(path string, roots []string, follow bool) error {
+	root, rel, err := resolveEntry(path, roots, follow)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return fmt.Errorf("path %s is an allowed root and cannot be removed", path)
+	}
+	return removeInRoot(root, rel)
+}
+
+// Rename moves src to dst, both under roots, creating missing directories for dst. An existing dst
+// is replaced (a symlink at dst is replaced itself). Roots cannot be moved or replaced.
+func Rename(src, dst string, roots []string, follow bool) error {
+	srcRoot, srcRel, err := resolveEntry(src, roots, follow)
+	if err != nil {
+		return err
+	}
+	dstRoot, dstRel, err := resolveEntry(dst, roots, follow)
+	if err != nil {
+		return err
+	}
+	if srcRel == "." || dstRel == "." {
+		return fmt.Errorf("an allowed root cannot be moved or replaced")
+	}
+	return renameInRoot(srcRoot, srcRel, dstRoot, dstRel)
+}
+
+// resolveEntry is Resolve for operations on a directory entry itself: with follow, only the
+// directories leading to the last component are resolved, so a symlink there is not followed.
+func resolveEntry(path string, roots []string, follow bool) (root, rel string, err error) {
+	root, rel, err = Resolve(path, roots, false)
+	if err != nil || !follow || rel == "." {
+		return root, rel, err
+	}
+	// path lies strictly below root, so its directory is under root too.
+	root, relDir, err := Resolve(filepath.Dir(filepath.Clean(path)), roots, true)
+	if err != nil {
+		return "", "", err
+	}
+	return root, filepath.Join(relDir, filepath.Base(path)), nil
+}
+
+// splitRel splits a relative path into its components.
+func splitRel(rel string) []string {
+	return strings.FieldsFunc(filepath.ToSlash(rel), func(r rune) bool { return r == '/' })
+}
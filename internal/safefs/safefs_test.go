@@ -0,0 +1,33 @@
+package safefs
+
+import "testing"
+
+func TestHasDotDot(t *testing.T) {
+	for p, want := range map[string]bool{
+		"/work/a/../b": true, "..": true, `C:\work\..\x`: true, "/work/..a/b": false,
+		"/work/a..": false, "/work/a/./b": false, "/work/...": false,
+	} {
+		if got := HasDotDot(p); got != want {
+			t.Errorf("HasDotDot(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestUnder(t *testing.T) {
+	cases := []struct {
+		path, root string
+		want       bool
+	}{
+		{"/work/a", "/work", true},
+		{"/work", "/work/", true},
+		{"/work-evil/a", "/work", false},
+		{"/etc/passwd", "/", true},
+		{"/work//a/./b", "/work/a", true},
+		{"/work/a", "", false},
+	}
+	for _, c := range cases {
+		if got := Under(c.path, c.root); got != c.want {
+			t.Errorf("Under(%q, %q) = %v, want %v", c.path, c.root, got, c.want)
+		}
+	}
+}
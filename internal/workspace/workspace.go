@@ -0,0 +1,172 @@
+// Package workspace manages per-session working directories under DATA_DIR/workspaces. Relative file
+// roots in session policies and relative paths in file.read/file.write intents resolve inside the
+// session's workspace, so policies such as "roots": ["workspace"] mean the same on every deployment.
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"securetalon/internal/safefs"
+)
+
+var (
+	// ErrInvalidSession is returned for session IDs that cannot name a workspace directory.
+	ErrInvalidSession = errors.New("invalid session id")
+	// ErrInvalidPath is returned for workspace file paths that are empty, absolute or contain "..".
+	ErrInvalidPath = errors.New("invalid workspace path")
+	// ErrTooLarge is returned by Write when the content exceeds the limit.
+	ErrTooLarge = errors.New("file too large")
+)
+
+var reSessionID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// File is one regular file in a workspace.
+type File struct {
+	Path    string    `json:"path"` // relative to the workspace, slash-separated
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Manager owns the workspace directories, one per session (e.g. data/workspaces/sess_123).
+type Manager struct {
+	Dir string
+}
+
+// NewManager creates the workspaces directory if missing. dir is made absolute so resolved paths do
+// not depend on the process's working directory.
+func NewManager(dir string) (*Manager, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0700); err != nil {
+		return nil, err
+	}
+	return &Manager{Dir: abs}, nil
+}
+
+// Root returns the workspace directory of a session, or "" for an invalid session ID.
+func (m *Manager) Root(sessionID string) string {
+	if !reSessionID.MatchString(sessionID) {
+		return ""
+	}
+	return filepath.Join(m.Dir, sessionID)
+}
+
+// Ensure creates the session's workspace directory if missing and returns it.
+func (m *Manager) Ensure(sessionID string) (string, error) {
+	root := m.Root(sessionID)
+	if root == "" {
+		return "", ErrInvalidSession
+	}
+	return root, os.MkdirAll(root, 0700)
+}
+
+// Resolve returns p unchanged when it is absolute, and otherwise joined under the session's
+// workspace. Paths with ".." components are returned unchanged so the ".." check downstream still
+// rejects them.
+func (m *Manager) Resolve(sessionID, p string) string {
+	root := m.Root(sessionID)
+	if p == "" || root == "" || filepath.IsAbs(p) || safefs.HasDotDot(p) {
+		return p
+	}
+	return filepath.Join(root, p)
+}
+
+// List returns the regular files in the session's workspace, sorted by path. Symlinks and other
+// special files are skipped. A missing workspace is empty.
+func (m *Manager) List(sessionID string) ([]File, error) {
+	root := m.Root(sessionID)
+	if root == "" {
+		return nil, ErrInvalidSession
+	}
+	files := []File{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, File{Path: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime().UTC()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// Open opens a workspace file for reading. rel must be relative; symlinks are never followed.
+func (m *Manager) Open(sessionID, rel string) (*os.File, error) {
+	path, root, err := m.filePath(sessionID, rel)
+	if err != nil {
+		return nil, err
+	}
+	return safefs.Open(path, []string{root}, false, os.O_RDONLY, 0)
+}
+
+// Write stores r as a workspace file, creating parent directories, and returns the file's size.
+// At most limit bytes are accepted (0 means no limit). The upload is read in full before the file is
+// atomically replaced (see safefs.WriteFile), so a failed upload keeps the previous file and readers
+// never see a partial one.
+func (m *Manager) Write(sessionID, rel string, r io.Reader, limit int64) (int64, error) {
+	path, root, err := m.filePath(sessionID, rel)
+	if err != nil {
+		return 0, err
+	}
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return 0, fmt.Errorf("%w: exceeds %d bytes", ErrTooLarge, limit)
+	}
+	if err := safefs.WriteFile(path, []string{root}, false, data); err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+// Wipe deletes the session's workspace and everything in it.
+func (m *Manager) Wipe(sessionID string) error {
+	root := m.Root(sessionID)
+	if root == "" {
+		return ErrInvalidSession
+	}
+	return os.RemoveAll(root)
+}
+
+func (m *Manager) filePath(sessionID, rel string) (path, root string, err error) {
+	root = m.Root(sessionID)
+	if root == "" {
+		return "", "", ErrInvalidSession
+	}
+	if rel == "" || filepath.IsAbs(rel) || safefs.HasDotDot(rel) {
+		return "", "", fmt.Errorf("%w %q", ErrInvalidPath, rel)
+	}
+	return filepath.Join(root, rel), root, nil
+}
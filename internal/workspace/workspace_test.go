@@ -0,0 +1,134 @@
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m, err := NewManager(filepath.Join(t.TempDir(), "workspaces"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestResolve(t *testing.T) {
+	m := newTestManager(t)
+	root := filepath.Join(m.Dir, "sess_1")
+	abs := filepath.Join(string(filepath.Separator), "etc", "hosts")
+	cases := []struct{ in, want string }{
+		{"workspace", filepath.Join(root, "workspace")},
+		{"a/b.txt", filepath.Join(root, "a", "b.txt")},
+		{abs, abs},
+		{"../escape", "../escape"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		if got := m.Resolve("sess_1", c.in); got != c.want {
+			t.Errorf("Resolve(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+	if got := m.Resolve("../sess", "x"); got != "x" {
+		t.Errorf("invalid session resolved to %q", got)
+	}
+}
+
+func TestWriteListOpenWipe(t *testing.T) {
+	m := newTestManager(t)
+	if files, err := m.List("sess_1"); err != nil || len(files) != 0 {
+		t.Fatalf("missing workspace: %v, %v", files, err)
+	}
+	if _, err := m.Write("sess_1", "b/data.txt", strings.NewReader("hello"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Write("sess_1", "a.txt", strings.NewReader("x"), 0); err != nil {
+		t.Fatal(err)
+	}
+	files, err := m.List("sess_1")
+	if err != nil || len(files) != 2 || files[0].Path != "a.txt" || files[1].Path != "b/data.txt" || files[1].Size != 5 {
+		t.Fatalf("List = %+v, %v", files, err)
+	}
+	f, err := m.Open("sess_1", "b/data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 16)
+	n, _ := f.Read(b)
+	f.Close()
+	if string(b[:n]) != "hello" {
+		t.Fatalf("content = %q", b[:n])
+	}
+	if err := m.Wipe("sess_1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(m.Dir, "sess_1")); !os.IsNotExist(err) {
+		t.Fatal("workspace still exists after Wipe")
+	}
+}
+
+func TestWriteRejectsEscapesAndLimit(t *testing.T) {
+	m := newTestManager(t)
+	for _, p := range []string{"../x.txt", "a/../../x.txt", "/tmp/x.txt", ""} {
+		if _, err := m.Write("sess_1", p, strings.NewReader("x"), 0); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("Write(%q): got %v, want ErrInvalidPath", p, err)
+		}
+	}
+	if _, err := m.Write("sess_1", "big.bin", strings.NewReader("0123456789"), 4); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("oversized write: got %v, want ErrTooLarge", err)
+	}
+	if _, err := os.Stat(filepath.Join(m.Dir, "sess_1", "big.bin")); !os.IsNotExist(err) {
+		t.Fatal("oversized file was kept")
+	}
+	if _, err := m.Write("../sess", "x.txt", strings.NewReader("x"), 0); !errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("invalid session: got %v", err)
+	}
+}
+
+func TestFailedWriteKeepsPreviousFile(t *testing.T) {
+	m := newTestManager(t)
+	if _, err := m.Write("sess_1", "notes.md", strings.NewReader("v1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Write("sess_1", "notes.md", strings.NewReader("0123456789"), 4); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("oversized write: got %v, want ErrTooLarge", err)
+	}
+	if _, err := m.Write("sess_1", "notes.md", iotest.ErrReader(errors.New("connection reset")), 0); err == nil {
+		t.Fatal("expected the reader's error")
+	}
+	data, err := os.ReadFile(filepath.Join(m.Dir, "sess_1", "notes.md"))
+	if err != nil || string(data) != "v1" {
+		t.Fatalf("previous file = %q, %v; want it kept", data, err)
+	}
+	files, _ := m.List("sess_1")
+	if len(files) != 1 {
+		t.Fatalf("expected only notes.md, got %v", files)
+	}
+}
+
+func TestOpenRejectsSymlinks(t *testing.T) {
+	m := newTestManager(t)
+	root, err := m.Ensure("sess_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(filepath.Dir(m.Dir), "secret.txt")
+	if err := os.WriteFile(secret, []byte("TOP SECRET"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(root, "leak.txt")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if f, err := m.Open("sess_1", "leak.txt"); err == nil {
+		f.Close()
+		t.Fatal("opened a file through a symlink")
+	}
+	if files, _ := m.List("sess_1"); len(files) != 0 {
+		t.Fatalf("List includes symlinks: %+v", files)
+	}
+}